@@ -16,6 +16,7 @@ import (
 	"github.com/simple-auth-roles/internal/auth"
 	"github.com/simple-auth-roles/internal/config"
 	"github.com/simple-auth-roles/internal/middleware"
+	"github.com/simple-auth-roles/pkg/authenticators"
 	"github.com/simple-auth-roles/pkg/cache"
 	"github.com/simple-auth-roles/pkg/database"
 	"github.com/simple-auth-roles/pkg/email"
@@ -39,6 +40,8 @@ func main() {
 		runMigrations = flag.Bool("migrate", false, "Run migrations before starting server")
 		migrateOnly   = flag.Bool("migrate-only", false, "Run migrations only and exit")
 		seedOnly      = flag.Bool("seed-only", false, "Run admin seeding only and exit")
+		rotateKeys    = flag.Bool("rotate-keys", false, "Promote a new signing key, retire the current one and exit")
+		refreshAAGUID = flag.Bool("refresh-authenticator-metadata", false, "Download the authenticator metadata file and exit")
 		showHelp      = flag.Bool("help", false, "Show help message")
 	)
 	flag.Parse()
@@ -65,6 +68,19 @@ func main() {
 		Level: slog.LevelInfo,
 	}))
 
+	// Refresh authenticator metadata only if requested; the server never downloads it itself
+	if *refreshAAGUID {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+		defer cancel()
+		registry, err := authenticators.Refresh(ctx, cfg.WebAuthn.AuthenticatorMetadataURL, cfg.WebAuthn.AuthenticatorMetadataFile)
+		if err != nil {
+			logger.Error("Failed to refresh authenticator metadata", "error", err)
+			os.Exit(1)
+		}
+		logger.Info("Authenticator metadata refreshed, exiting...", "file", cfg.WebAuthn.AuthenticatorMetadataFile, "authenticators", registry.Len())
+		os.Exit(0)
+	}
+
 	// Initialize database
 	db, err := database.Connect(cfg.Database.URL)
 	if err != nil {
@@ -127,7 +143,24 @@ func main() {
 	emailService := email.NewEmailService(cfg, logger)
 
 	// Initialize auth domain
-	authDomain := auth.NewDomain(db, cacheService, emailService, logger, cfg)
+	authDomain, err := auth.NewDomain(db, cacheService, emailService, logger, cfg)
+	if err != nil {
+		logger.Error("Failed to initialize auth domain", "error", err)
+		os.Exit(1)
+	}
+
+	// Rotate signing keys only if requested
+	if *rotateKeys {
+		key, err := authDomain.Service().KeyRing().Rotate(ctx)
+		if err != nil {
+			logger.Error("Failed to rotate signing keys", "error", err)
+			os.Exit(1)
+		}
+		logger.Info("Signing key rotated, exiting...", "kid", key.KID, "alg", key.Algorithm)
+		os.Exit(0)
+	}
+
+	authDomain.StartBackgroundJobs(ctx)
 
 	// Setup router
 	if cfg.IsProduction() {
@@ -135,6 +168,14 @@ func main() {
 	}
 
 	router := gin.New()
+	// Client IPs key the login lockouts, so only trust forwarding headers set by our own proxies
+	if err := router.SetTrustedProxies(cfg.Server.TrustedProxies); err != nil {
+		logger.Error("Invalid TRUSTED_PROXIES", "error", err)
+		os.Exit(1)
+	}
+	if len(cfg.Server.TrustedProxies) == 0 {
+		logger.Warn("TRUSTED_PROXIES is empty: behind a reverse proxy or the front-end, every client shares the proxy's IP and LOGIN_MAX_IP_ATTEMPTS locks them out together")
+	}
 
 	// Add middleware
 	router.Use(middleware.LoggingMiddleware(logger))
@@ -194,6 +235,9 @@ func setupRoutes(router *gin.Engine, authDomain *auth.Domain) {
 		})
 	})
 
+	// Discovery documents (JWKS, OpenID configuration)
+	authDomain.RegisterWellKnownRoutes(router)
+
 	// API routes
 	api := router.Group("/api/v1")
 	authDomain.RegisterRoutes(api)
@@ -1,7 +1,10 @@
 package auth
 
 import (
+	"context"
+	"fmt"
 	"log/slog"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/simple-auth-roles/internal/auth/handlers"
@@ -15,27 +18,61 @@ import (
 
 // Domain represents the authentication domain
 type Domain struct {
-	service *service.AuthService
-	handler *handlers.AuthHandler
-	logger  *slog.Logger
+	service     *service.AuthService
+	handler     *handlers.AuthHandler
+	oidcHandler *handlers.OIDCHandler // nil when OIDC_ENABLED=false
+	roleHandler *handlers.RoleHandler
+	orgHandler  *handlers.OrgHandler
+	logger      *slog.Logger
 }
 
 // NewDomain creates a new authentication domain
-func NewDomain(db *gorm.DB, cacheService cache.CacheService, emailService email.EmailService, logger *slog.Logger, cfg *config.Config) *Domain {
-	// Create repository
+func NewDomain(db *gorm.DB, cacheService cache.CacheService, emailService email.EmailService, logger *slog.Logger, cfg *config.Config) (*Domain, error) {
+	// Create repositories
 	userRepo := repository.NewUserRepository(db)
+	tokenRepo := repository.NewTokenRepository(db)
+	signingKeyRepo := repository.NewSigningKeyRepository(db)
+	oauthClientRepo := repository.NewOAuthClientRepository(db)
+	securityEventRepo := repository.NewSecurityEventRepository(db)
+	roleRepo := repository.NewRoleRepository(db)
+	elevationRequestRepo := repository.NewElevationRequestRepository(db)
+	orgRepo := repository.NewOrgRepository(db)
+	invitationRepo := repository.NewInvitationRepository(db)
 
-	// Create service
-	authService := service.NewAuthService(userRepo, cacheService, emailService, logger, cfg)
+	// Load token signing keys
+	keyRing, err := service.NewKeyRing(context.Background(), signingKeyRepo, cfg, logger)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load signing keys: %w", err)
+	}
+
+	// Load roles and their permissions
+	roleService, err := service.NewRoleService(context.Background(), roleRepo, userRepo, elevationRequestRepo, securityEventRepo, cfg, logger)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load roles: %w", err)
+	}
 
-	// Create handler
+	// Create services
+	orgService := service.NewOrgService(orgRepo, invitationRepo, userRepo, roleService, cacheService, emailService, logger, cfg)
+	authService := service.NewAuthService(userRepo, tokenRepo, securityEventRepo, cacheService, emailService, keyRing, roleService, orgService, logger, cfg)
+
+	// Create handlers
 	authHandler := handlers.NewAuthHandler(authService, logger)
+	var oidcHandler *handlers.OIDCHandler
+	if cfg.OIDC.Enabled {
+		oidcService := service.NewOIDCService(authService, oauthClientRepo, cacheService, logger, cfg)
+		oidcHandler = handlers.NewOIDCHandler(authService, oidcService, logger)
+	}
+	roleHandler := handlers.NewRoleHandler(authService, roleService, logger)
+	orgHandler := handlers.NewOrgHandler(authService, orgService, logger)
 
 	return &Domain{
-		service: authService,
-		handler: authHandler,
-		logger:  logger.With("domain", "auth"),
-	}
+		service:     authService,
+		handler:     authHandler,
+		oidcHandler: oidcHandler,
+		roleHandler: roleHandler,
+		orgHandler:  orgHandler,
+		logger:      logger.With("domain", "auth"),
+	}, nil
 }
 
 // Service returns the auth service
@@ -46,4 +83,23 @@ func (d *Domain) Service() *service.AuthService {
 // RegisterRoutes registers authentication routes
 func (d *Domain) RegisterRoutes(router *gin.RouterGroup) {
 	d.handler.RegisterRoutes(router)
+	if d.oidcHandler != nil {
+		d.oidcHandler.RegisterRoutes(router)
+	}
+	d.roleHandler.RegisterRoutes(router)
+	d.orgHandler.RegisterRoutes(router)
+}
+
+// RegisterWellKnownRoutes registers discovery documents served from the server root
+func (d *Domain) RegisterWellKnownRoutes(router gin.IRouter) {
+	d.handler.RegisterWellKnownRoutes(router)
+	if d.oidcHandler != nil {
+		d.oidcHandler.RegisterWellKnownRoutes(router)
+	}
+}
+
+// StartBackgroundJobs starts the domain's periodic jobs until ctx is cancelled
+func (d *Domain) StartBackgroundJobs(ctx context.Context) {
+	go d.service.KeyRing().Run(ctx, time.Minute)
+	go d.service.Roles().Run(ctx, time.Minute)
 }
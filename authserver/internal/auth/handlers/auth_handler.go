@@ -4,13 +4,18 @@ import (
 	"bytes"
 	"encoding/base64"
 	"encoding/json"
+	"errors"
+	"io"
 	"log/slog"
+	"math"
 	"net/http"
 	"strconv"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/go-webauthn/webauthn/protocol"
 	"github.com/simple-auth-roles/internal/auth/service"
+	"github.com/simple-auth-roles/internal/middleware"
 	"github.com/simple-auth-roles/internal/types"
 	"github.com/simple-auth-roles/pkg/clientdetection"
 	"github.com/simple-auth-roles/pkg/csrf"
@@ -29,74 +34,159 @@ func NewAuthHandler(authService *service.AuthService, logger *slog.Logger) *Auth
 }
 
 func (h *AuthHandler) RegisterRoutes(router *gin.RouterGroup) {
+	// Sensitive actions need a recent sign-in or step-up
+	maxAge, methods := h.authService.StepUpPolicy()
+	recentAuth := middleware.RequireRecentAuth(maxAge, methods...)
+
 	auth := router.Group("/auth")
 	{
 		auth.POST("/send-code", h.SendLoginCode)
 		auth.POST("/verify-code", h.VerifyLoginCode)
-		auth.POST("/check-user", h.CheckUser)
-		auth.POST("/create-user", h.CreateUser)       // Admin only
-		auth.PUT("/users/:id/role", h.UpdateUserRole) // Admin only
+		auth.POST("/magic", h.VerifyMagicLink)
+		auth.GET("/pending/:id", h.PollPendingLogin)
+		auth.GET("/pending/:id/events", h.StreamPendingLogin)
+		auth.GET("/approve", h.GetLoginApproval)
+		auth.POST("/approve", h.ApproveLogin)
+		auth.POST("/refresh", h.RefreshSession)
+		auth.POST("/logout", middleware.RequireAuth(h.authService), h.Logout)
+		auth.POST("/logout-all", middleware.RequireAuth(h.authService), recentAuth, h.LogoutAll)
+		auth.POST("/users/:id/logout-all", middleware.RequireAuth(h.authService), middleware.RequireRole(types.RoleAdmin), recentAuth, h.LogoutUserEverywhere)
+		auth.POST("/step-up/passkey/begin", middleware.RequireAuth(h.authService), h.BeginPasskeyStepUp)
+		auth.POST("/step-up/passkey/finish", middleware.RequireAuth(h.authService), h.FinishPasskeyStepUp)
+		auth.POST("/step-up/email/send", middleware.RequireAuth(h.authService), h.SendEmailStepUp)
+		auth.POST("/step-up/email/verify", middleware.RequireAuth(h.authService), h.VerifyEmailStepUp)
+		auth.POST("/switch-org", middleware.RequireAuth(h.authService), h.SwitchOrg)
+		auth.DELETE("/account", middleware.RequireAuth(h.authService), recentAuth, h.DeleteAccount)
+		auth.POST("/check-user", middleware.RequireAuth(h.authService), h.CheckUser)
+		auth.POST("/create-user", middleware.RequireAuth(h.authService), middleware.RequireRole(types.RoleAdmin), recentAuth, h.CreateUser)
+		auth.PUT("/users/:id/role", middleware.RequireAuth(h.authService), middleware.RequireRole(types.RoleAdmin), recentAuth, h.UpdateUserRole)
+		auth.PUT("/users/:id/roles", middleware.RequireAuth(h.authService), middleware.RequireRole(types.RoleAdmin), recentAuth, h.SetUserRoles)
+	}
+	admin := router.Group("/admin")
+	admin.Use(middleware.RequireAuth(h.authService), middleware.RequireRole(types.RoleAdmin))
+	{
+		admin.GET("/signing-keys", h.ListSigningKeys)
+		admin.POST("/signing-keys/rotate", recentAuth, h.RotateSigningKeys)
+		admin.POST("/users/:id/webauthn/begin-registration", recentAuth, h.AdminBeginWebAuthnRegistration)
+		admin.POST("/users/:id/webauthn/finish-registration", recentAuth, h.AdminFinishWebAuthnRegistration)
+		admin.GET("/users/:id/webauthn/credentials", h.AdminListWebAuthnCredentials)
+		admin.DELETE("/users/:id/webauthn/credentials/:credentialId", recentAuth, h.AdminDeleteWebAuthnCredential)
+		admin.PUT("/users/:id/passkey-required", recentAuth, h.SetPasskeyRequired)
 	}
 	webauthn := router.Group("/webauthn")
 	{
-		webauthn.POST("/begin-registration", h.BeginWebAuthnRegistration)
-		webauthn.POST("/finish-registration", h.FinishWebAuthnRegistration)
 		webauthn.POST("/begin-login", h.BeginWebAuthnLogin)
 		webauthn.POST("/finish-login", h.FinishWebAuthnLogin)
-		webauthn.POST("/list-credentials", h.ListWebAuthnCredentials)
-		webauthn.POST("/delete-credential", h.DeleteWebAuthnCredential)
 	}
+	// Passkey management acts on the signed-in user
+	passkeys := router.Group("/webauthn")
+	passkeys.Use(middleware.RequireAuth(h.authService))
+	{
+		passkeys.POST("/begin-registration", h.BeginWebAuthnRegistration)
+		passkeys.POST("/finish-registration", h.FinishWebAuthnRegistration)
+		passkeys.POST("/list-credentials", h.ListWebAuthnCredentials)
+		passkeys.POST("/delete-credential", recentAuth, h.DeleteWebAuthnCredential)
+		passkeys.PATCH("/credentials/:id", h.RenameWebAuthnCredential)
+	}
+}
+
+func (h *AuthHandler) RegisterWellKnownRoutes(router gin.IRouter) {
+	router.GET("/.well-known/jwks.json", h.JWKS)
 }
 
 type SendCodeRequest struct {
-	Email string `json:"email" binding:"required,email"`
-	Name  string `json:"name,omitempty"`
+	Email  string `json:"email" binding:"required,email"`
+	Name   string `json:"name,omitempty"`
+	Origin string `json:"origin,omitempty"` // Front-end the magic link should open, defaults to the Origin header
+}
+
+type MagicLinkRequest struct {
+	Token string `json:"token" binding:"required"`
+}
+
+type ApproveLoginRequest struct {
+	Token   string `json:"token" binding:"required"`
+	Approve bool   `json:"approve"`
 }
 
 type VerifyCodeRequest struct {
 	Email string `json:"email" binding:"required,email"`
+	Nonce string `json:"nonce" binding:"required"` // Returned by send-code
 	Code  string `json:"code" binding:"required"`
 }
 
+// UpdateRoleRequest sets a single role, for clients from before users had several
 type UpdateRoleRequest struct {
 	Role string `json:"role" binding:"required"`
 }
 
 // --- WebAuthn Handlers ---
-type BeginRegistrationRequest struct {
-	UserID uint `json:"user_id" binding:"required"`
-}
-
 type FinishRegistrationRequest struct {
-	UserID   uint        `json:"user_id" binding:"required"`
+	Name     string      `json:"name,omitempty"` // Defaults to the authenticator model
 	Response interface{} `json:"credential" binding:"required"`
 }
 
 type BeginLoginRequest struct {
-	Email string `json:"email" binding:"required,email"`
+	Email string `json:"email" binding:"omitempty,email"` // Empty for a discoverable (usernameless) login
 }
 
 type FinishLoginRequest struct {
-	UserID   uint        `json:"user_id" binding:"required"`
-	Response interface{} `json:"assertion" binding:"required"`
+	CeremonyID string      `json:"ceremony_id" binding:"required"` // Returned by begin-login
+	Response   interface{} `json:"assertion" binding:"required"`
 }
 
+// BeginWebAuthnRegistration starts adding a passkey to the signed-in user
 func (h *AuthHandler) BeginWebAuthnRegistration(c *gin.Context) {
-	var req BeginRegistrationRequest
-	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+	user := middleware.GetCurrentUser(c)
+	if user == nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
 		return
 	}
-	// Note: Add authentication check for user registration in production
-	options, err := h.authService.WebAuthnService().BeginRegistration(c.Request.Context(), req.UserID)
+	h.beginWebAuthnRegistration(c, user.ID)
+}
+
+// AdminBeginWebAuthnRegistration starts adding a passkey to another user (admin only)
+func (h *AuthHandler) AdminBeginWebAuthnRegistration(c *gin.Context) {
+	userID, ok := userIDParam(c)
+	if !ok {
+		return
+	}
+	h.beginWebAuthnRegistration(c, userID)
+}
+
+func (h *AuthHandler) beginWebAuthnRegistration(c *gin.Context, userID uint) {
+	options, err := h.authService.WebAuthnService().BeginRegistration(c.Request.Context(), userID)
 	if err != nil {
+		if errors.Is(err, service.ErrUserNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 	c.JSON(http.StatusOK, options.Response)
 }
 
+// FinishWebAuthnRegistration stores a new passkey for the signed-in user
 func (h *AuthHandler) FinishWebAuthnRegistration(c *gin.Context) {
+	user := middleware.GetCurrentUser(c)
+	if user == nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+	h.finishWebAuthnRegistration(c, user.ID, user.ID)
+}
+
+// AdminFinishWebAuthnRegistration stores a new passkey for another user (admin only)
+func (h *AuthHandler) AdminFinishWebAuthnRegistration(c *gin.Context) {
+	userID, ok := userIDParam(c)
+	if !ok {
+		return
+	}
+	h.finishWebAuthnRegistration(c, middleware.GetCurrentUser(c).ID, userID)
+}
+
+func (h *AuthHandler) finishWebAuthnRegistration(c *gin.Context, actorID, userID uint) {
 	var req FinishRegistrationRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
@@ -110,21 +200,34 @@ func (h *AuthHandler) FinishWebAuthnRegistration(c *gin.Context) {
 	}
 
 	// Log the credential data to see what's being sent
-	h.logger.Info("Received credential data", "userID", req.UserID, "credentialData", string(credBytes))
+	h.logger.Info("Received credential data", "userID", userID, "credentialData", string(credBytes))
 
 	parsed, err := protocol.ParseCredentialCreationResponseBody(bytes.NewReader(credBytes))
 	if err != nil {
-		h.logger.Error("Failed to parse credential", "error", err, "userID", req.UserID)
+		h.logger.Error("Failed to parse credential", "error", err, "userID", userID)
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to parse credential"})
 		return
 	}
 
 	// Log the parsed challenge
-	h.logger.Info("Parsed credential challenge", "userID", req.UserID, "challenge", parsed.Response.CollectedClientData.Challenge)
+	h.logger.Info("Parsed credential challenge", "userID", userID, "challenge", parsed.Response.CollectedClientData.Challenge)
 
-	err = h.authService.WebAuthnService().FinishRegistration(c.Request.Context(), req.UserID, parsed)
+	err = h.authService.WebAuthnService().FinishRegistration(c.Request.Context(), actorID, userID, req.Name, parsed, requestMeta(c, clientdetection.DetectClient(c)))
 	if err != nil {
-		h.logger.Error("Failed to finish registration", "error", err, "userID", req.UserID)
+		if errors.Is(err, service.ErrInvalidCredentialName) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		var policyErr *service.RegistrationPolicyError
+		if errors.As(err, &policyErr) {
+			c.JSON(http.StatusForbidden, gin.H{"error": policyErr.Message, "errorCode": policyErr.Code})
+			return
+		}
+		if errors.Is(err, service.ErrUserNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+			return
+		}
+		h.logger.Error("Failed to finish registration", "error", err, "userID", userID)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
@@ -137,12 +240,15 @@ func (h *AuthHandler) BeginWebAuthnLogin(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
 		return
 	}
-	options, err := h.authService.WebAuthnService().BeginLogin(c.Request.Context(), req.Email)
+	options, ceremonyID, err := h.authService.WebAuthnService().BeginLogin(c.Request.Context(), req.Email)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
-	c.JSON(http.StatusOK, options)
+	c.JSON(http.StatusOK, gin.H{
+		"publicKey":  options.Response,
+		"ceremonyId": ceremonyID,
+	})
 }
 
 func (h *AuthHandler) FinishWebAuthnLogin(c *gin.Context) {
@@ -162,23 +268,31 @@ func (h *AuthHandler) FinishWebAuthnLogin(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to parse assertion"})
 		return
 	}
-	user, err := h.authService.WebAuthnService().FinishLogin(c.Request.Context(), req.UserID, parsed)
+
+	// Detect client type
+	clientInfo := clientdetection.DetectClient(c)
+	meta := requestMeta(c, clientInfo)
+
+	user, err := h.authService.WebAuthnService().FinishLogin(c.Request.Context(), req.CeremonyID, parsed, meta)
 	if err != nil {
+		var passkeyErr *service.PasskeyLoginError
+		if errors.As(err, &passkeyErr) {
+			h.writePasskeyLoginError(c, passkeyErr, meta)
+			return
+		}
 		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
 		return
 	}
 
-	// Generate JWT token for the authenticated user
-	token, err := h.authService.GenerateJWT(user)
+	// Issue access and refresh tokens for the authenticated user
+	meta.AMR = []string{types.AMRPasskey}
+	session, err := h.authService.CreateSession(c.Request.Context(), user, meta)
 	if err != nil {
-		h.logger.Error("Failed to generate JWT token", "error", err, "userID", user.ID)
+		h.logger.Error("Failed to create session", "error", err, "userID", user.ID)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate session token"})
 		return
 	}
 
-	// Detect client type
-	clientInfo := clientdetection.DetectClient(c)
-
 	// Build response based on client type
 	responseData := gin.H{
 		"success": true,
@@ -187,17 +301,49 @@ func (h *AuthHandler) FinishWebAuthnLogin(c *gin.Context) {
 			"id":         user.ID,
 			"email":      user.Email,
 			"name":       user.Name,
-			"role":       user.Role,
+			"roles":      user.Roles,
 			"is_active":  user.IsActive,
 			"created_at": user.CreatedAt,
 		},
-		"sessionToken": token,
+		"sessionToken": session.Token,
+		"refreshToken": session.RefreshToken,
+		"expiresIn":    session.ExpiresIn,
 		"clientType":   string(clientInfo.Type),
 	}
 
 	c.JSON(http.StatusOK, responseData)
 }
 
+// writePasskeyLoginError responds to a passkey that can't be used on its own. For a step-up
+// a login code is emailed and the client finishes with verify-code, like after send-code.
+func (h *AuthHandler) writePasskeyLoginError(c *gin.Context, err *service.PasskeyLoginError, meta types.RequestMeta) {
+	if err.Code != service.PasskeyErrorStepUpRequired {
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Message, "errorCode": err.Code})
+		return
+	}
+
+	challenge, sendErr := h.authService.SendPasskeyStepUpCode(c.Request.Context(), err, c.GetHeader("Origin"), meta)
+	if sendErr != nil {
+		var codeErr *service.LoginCodeError
+		if errors.As(sendErr, &codeErr) {
+			writeLoginCodeError(c, codeErr)
+			return
+		}
+		h.logger.Error("Failed to send step-up code", "error", sendErr, "userID", err.User.ID)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to send login code"})
+		return
+	}
+
+	c.JSON(http.StatusUnauthorized, gin.H{
+		"error":          err.Message,
+		"errorCode":      err.Code,
+		"email":          err.User.Email,
+		"nonce":          challenge.Nonce,
+		"pendingLoginId": challenge.PendingLoginID,
+		"expiresAt":      challenge.ExpiresAt,
+	})
+}
+
 // SendLoginCode sends a magic link code to the user's email
 func (h *AuthHandler) SendLoginCode(c *gin.Context) {
 	var req SendCodeRequest
@@ -206,19 +352,33 @@ func (h *AuthHandler) SendLoginCode(c *gin.Context) {
 		return
 	}
 
-	if err := h.authService.SendLoginCode(c.Request.Context(), req.Email, req.Name); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-		return
+	origin := req.Origin
+	if origin == "" {
+		origin = c.GetHeader("Origin")
 	}
 
 	// Detect client type
 	clientInfo := clientdetection.DetectClient(c)
 
+	challenge, err := h.authService.SendLoginCode(c.Request.Context(), req.Email, req.Name, origin, requestMeta(c, clientInfo))
+	if err != nil {
+		var codeErr *service.LoginCodeError
+		if errors.As(err, &codeErr) {
+			writeLoginCodeError(c, codeErr)
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
 	// Build response based on client type
 	responseData := gin.H{
-		"success":    true,
-		"message":    "Login code sent to your email",
-		"clientType": string(clientInfo.Type),
+		"success":        true,
+		"message":        "Login code sent to your email",
+		"nonce":          challenge.Nonce,
+		"pendingLoginId": challenge.PendingLoginID,
+		"expiresAt":      challenge.ExpiresAt,
+		"clientType":     string(clientInfo.Type),
 	}
 
 	// Only include CSRF token for clients that require it
@@ -259,13 +419,177 @@ func (h *AuthHandler) VerifyLoginCode(c *gin.Context) {
 		return
 	}
 
-	response, err := h.authService.VerifyLoginCode(c.Request.Context(), req.Email, req.Code)
+	response, err := h.authService.VerifyLoginCode(c.Request.Context(), req.Email, req.Nonce, req.Code, requestMeta(c, clientInfo))
 	if err != nil {
+		var codeErr *service.LoginCodeError
+		if errors.As(err, &codeErr) {
+			writeLoginCodeError(c, codeErr)
+			return
+		}
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired code"})
 		return
 	}
 
-	// Build response based on client type
+	h.writeLoginResponse(c, clientInfo, response)
+}
+
+// VerifyMagicLink exchanges a magic link token for a session.
+// There is no GET route: mail scanners follow links and would use the token up.
+func (h *AuthHandler) VerifyMagicLink(c *gin.Context) {
+	var req MagicLinkRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+
+	// No CSRF check: the single-use token in the request is itself the proof
+	clientInfo := clientdetection.DetectClient(c)
+	response, err := h.authService.VerifyMagicLink(c.Request.Context(), req.Token, requestMeta(c, clientInfo))
+	if err != nil {
+		var codeErr *service.LoginCodeError
+		if errors.As(err, &codeErr) {
+			writeLoginCodeError(c, codeErr)
+			return
+		}
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired link"})
+		return
+	}
+
+	h.writeLoginResponse(c, clientInfo, response)
+}
+
+// writeLoginResponse renders a successful email login
+func (h *AuthHandler) writeLoginResponse(c *gin.Context, clientInfo clientdetection.ClientInfo, response *types.AuthResponse) {
+	responseData, err := loginResponseData(clientInfo, response)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate CSRF token"})
+		return
+	}
+
+	c.JSON(http.StatusOK, responseData)
+}
+
+// PollPendingLogin reports whether a login was approved from another device, returning the session once it is
+func (h *AuthHandler) PollPendingLogin(c *gin.Context) {
+	clientInfo := clientdetection.DetectClient(c)
+	pending, response, err := h.authService.PollPendingLogin(c.Request.Context(), c.Param("id"), requestMeta(c, clientInfo))
+	if err != nil {
+		var codeErr *service.LoginCodeError
+		if errors.As(err, &codeErr) {
+			writeLoginCodeError(c, codeErr)
+			return
+		}
+		h.logger.Error("Failed to poll pending login", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check sign-in status"})
+		return
+	}
+
+	if response == nil {
+		c.JSON(http.StatusAccepted, gin.H{"status": pending.Status, "expiresAt": pending.ExpiresAt})
+		return
+	}
+	h.writeLoginResponse(c, clientInfo, response)
+}
+
+// StreamPendingLogin is PollPendingLogin as server-sent events: "pending" every second,
+// then a final "approved" with the session or "error"
+func (h *AuthHandler) StreamPendingLogin(c *gin.Context) {
+	clientInfo := clientdetection.DetectClient(c)
+	meta := requestMeta(c, clientInfo)
+	id := c.Param("id")
+
+	c.Header("Cache-Control", "no-cache")
+	c.Header("X-Accel-Buffering", "no")
+
+	// The stream outlives the server's write timeout
+	controller := http.NewResponseController(c.Writer)
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	c.Stream(func(w io.Writer) bool {
+		_ = controller.SetWriteDeadline(time.Now().Add(30 * time.Second))
+
+		pending, response, err := h.authService.PollPendingLogin(c.Request.Context(), id, meta)
+		if err != nil {
+			event := gin.H{"error": "Failed to check sign-in status"}
+			var codeErr *service.LoginCodeError
+			if errors.As(err, &codeErr) {
+				event = gin.H{"error": codeErr.Message, "errorCode": codeErr.Code}
+			}
+			c.SSEvent("error", event)
+			return false
+		}
+
+		if response != nil {
+			responseData, err := loginResponseData(clientInfo, response)
+			if err != nil {
+				c.SSEvent("error", gin.H{"error": "Failed to generate CSRF token"})
+				return false
+			}
+			c.SSEvent("approved", responseData)
+			return false
+		}
+
+		c.SSEvent("pending", gin.H{"status": pending.Status, "expiresAt": pending.ExpiresAt})
+		select {
+		case <-ticker.C:
+			return true
+		case <-c.Request.Context().Done():
+			return false
+		}
+	})
+}
+
+// GetLoginApproval shows where a login waiting for approval was requested from
+func (h *AuthHandler) GetLoginApproval(c *gin.Context) {
+	pending, err := h.authService.GetLoginApproval(c.Request.Context(), c.Query("token"))
+	if err != nil {
+		var codeErr *service.LoginCodeError
+		if errors.As(err, &codeErr) {
+			writeLoginCodeError(c, codeErr)
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load sign-in request"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"email":       pending.Email,
+		"ipAddress":   pending.IPAddress,
+		"userAgent":   pending.UserAgent,
+		"requestedAt": pending.CreatedAt,
+		"expiresAt":   pending.ExpiresAt,
+	})
+}
+
+// ApproveLogin approves or denies a login from the link in the login email
+func (h *AuthHandler) ApproveLogin(c *gin.Context) {
+	var req ApproveLoginRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+
+	pending, err := h.authService.ApproveLogin(c.Request.Context(), req.Token, req.Approve)
+	if err != nil {
+		var codeErr *service.LoginCodeError
+		if errors.As(err, &codeErr) {
+			writeLoginCodeError(c, codeErr)
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update sign-in request"})
+		return
+	}
+
+	message := "Sign-in approved"
+	if !req.Approve {
+		message = "Sign-in denied"
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": message, "status": pending.Status})
+}
+
+// loginResponseData builds the body of a successful login response based on client type
+func loginResponseData(clientInfo clientdetection.ClientInfo, response *types.AuthResponse) (gin.H, error) {
 	responseData := gin.H{
 		"success": true,
 		"message": "Login successful",
@@ -273,11 +597,13 @@ func (h *AuthHandler) VerifyLoginCode(c *gin.Context) {
 			"id":         response.User.ID,
 			"email":      response.User.Email,
 			"name":       response.User.Name,
-			"role":       response.User.Role,
+			"roles":      response.User.Roles,
 			"is_active":  response.User.IsActive,
 			"created_at": response.User.CreatedAt,
 		},
 		"sessionToken": response.Token,
+		"refreshToken": response.RefreshToken,
+		"expiresIn":    response.ExpiresIn,
 		"clientType":   string(clientInfo.Type),
 	}
 
@@ -285,26 +611,320 @@ func (h *AuthHandler) VerifyLoginCode(c *gin.Context) {
 	if clientInfo.RequiresCSRF() {
 		newCSRFToken, err := csrf.GenerateToken()
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate CSRF token"})
-			return
+			return nil, err
 		}
 		responseData["csrfToken"] = newCSRFToken
 	}
+	return responseData, nil
+}
 
-	c.JSON(http.StatusOK, responseData)
+// RefreshSession rotates a refresh token and returns a new token pair
+func (h *AuthHandler) RefreshSession(c *gin.Context) {
+	var req types.RefreshRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+
+	clientInfo := clientdetection.DetectClient(c)
+
+	response, err := h.authService.RefreshSession(c.Request.Context(), req.RefreshToken, requestMeta(c, clientInfo))
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidRefreshToken) || errors.Is(err, service.ErrRefreshTokenReused) {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+			return
+		}
+		h.logger.Error("Failed to refresh session", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to refresh session"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success":      true,
+		"sessionToken": response.Token,
+		"refreshToken": response.RefreshToken,
+		"expiresIn":    response.ExpiresIn,
+		"clientType":   string(clientInfo.Type),
+	})
+}
+
+type StepUpPasskeyRequest struct {
+	CeremonyID string      `json:"ceremony_id" binding:"required"` // Returned by step-up/passkey/begin
+	Response   interface{} `json:"assertion" binding:"required"`
+}
+
+type StepUpEmailRequest struct {
+	Nonce string `json:"nonce" binding:"required"` // Returned by step-up/email/send
+	Code  string `json:"code" binding:"required"`
+}
+
+// BeginPasskeyStepUp starts a passkey assertion to re-authenticate the signed-in user
+func (h *AuthHandler) BeginPasskeyStepUp(c *gin.Context) {
+	user := middleware.GetCurrentUser(c)
+	if user == nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	options, ceremonyID, err := h.authService.BeginPasskeyStepUp(c.Request.Context(), user)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"publicKey": options.Response, "ceremonyId": ceremonyID})
+}
+
+// FinishPasskeyStepUp verifies the assertion and returns tokens with a fresh auth_time
+func (h *AuthHandler) FinishPasskeyStepUp(c *gin.Context) {
+	user, claims := middleware.GetCurrentUser(c), middleware.GetCurrentClaims(c)
+	if user == nil || claims == nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	var req StepUpPasskeyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+	assertionBytes, err := json.Marshal(req.Response)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid assertion data"})
+		return
+	}
+	parsed, err := protocol.ParseCredentialRequestResponseBody(bytes.NewReader(assertionBytes))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to parse assertion"})
+		return
+	}
+
+	clientInfo := clientdetection.DetectClient(c)
+	meta := requestMeta(c, clientInfo)
+
+	response, err := h.authService.FinishPasskeyStepUp(c.Request.Context(), user, claims, req.CeremonyID, parsed, meta)
+	if err != nil {
+		var passkeyErr *service.PasskeyLoginError
+		switch {
+		case errors.As(err, &passkeyErr):
+			h.writePasskeyLoginError(c, passkeyErr, meta)
+		case errors.Is(err, service.ErrStepUpWrongUser):
+			c.JSON(http.StatusForbidden, gin.H{"error": "Use a passkey for your own account"})
+		default:
+			c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	h.writeLoginResponse(c, clientInfo, response)
+}
+
+// SendEmailStepUp emails the signed-in user a code to re-authenticate with
+func (h *AuthHandler) SendEmailStepUp(c *gin.Context) {
+	user := middleware.GetCurrentUser(c)
+	if user == nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	meta := requestMeta(c, clientdetection.DetectClient(c))
+	challenge, err := h.authService.SendLoginCode(c.Request.Context(), user.Email, "", c.GetHeader("Origin"), meta)
+	if err != nil {
+		var codeErr *service.LoginCodeError
+		if errors.As(err, &codeErr) {
+			writeLoginCodeError(c, codeErr)
+			return
+		}
+		h.logger.Error("Failed to send step-up code", "error", err, "userID", user.ID)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to send code"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":   "Code sent to your email",
+		"nonce":     challenge.Nonce,
+		"expiresAt": challenge.ExpiresAt,
+	})
+}
+
+// VerifyEmailStepUp verifies the emailed code and returns tokens with a fresh auth_time
+func (h *AuthHandler) VerifyEmailStepUp(c *gin.Context) {
+	user, claims := middleware.GetCurrentUser(c), middleware.GetCurrentClaims(c)
+	if user == nil || claims == nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	var req StepUpEmailRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+
+	clientInfo := clientdetection.DetectClient(c)
+	response, err := h.authService.VerifyEmailStepUp(c.Request.Context(), user, claims, req.Nonce, req.Code, requestMeta(c, clientInfo))
+	if err != nil {
+		var codeErr *service.LoginCodeError
+		if errors.As(err, &codeErr) {
+			writeLoginCodeError(c, codeErr)
+			return
+		}
+		if errors.Is(err, service.ErrInvalidRefreshToken) {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Session has ended, sign in again"})
+			return
+		}
+		h.logger.Error("Failed to verify step-up code", "error", err, "userID", user.ID)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify code"})
+		return
+	}
+
+	h.writeLoginResponse(c, clientInfo, response)
+}
+
+// SwitchOrg issues tokens whose org_id claim names the given organization, or none when org_id is null
+func (h *AuthHandler) SwitchOrg(c *gin.Context) {
+	user, claims := middleware.GetCurrentUser(c), middleware.GetCurrentClaims(c)
+	if user == nil || claims == nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	var req types.SwitchOrgRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+
+	clientInfo := clientdetection.DetectClient(c)
+	response, err := h.authService.SwitchOrg(c.Request.Context(), user, claims, req.OrgID, requestMeta(c, clientInfo))
+	if err != nil {
+		if errors.Is(err, service.ErrNotOrgMember) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Not a member of this organization"})
+			return
+		}
+		if errors.Is(err, service.ErrInvalidRefreshToken) {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Session has ended, sign in again"})
+			return
+		}
+		h.logger.Error("Failed to switch organization", "error", err, "userID", user.ID)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to switch organization"})
+		return
+	}
+
+	h.writeLoginResponse(c, clientInfo, response)
+}
+
+// DeleteAccount deletes the signed-in user's account
+func (h *AuthHandler) DeleteAccount(c *gin.Context) {
+	user := middleware.GetCurrentUser(c)
+	if user == nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	if err := h.authService.DeleteAccount(c.Request.Context(), user.ID); err != nil {
+		if errors.Is(err, service.ErrLastOrgAdmin) {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
+		h.logger.Error("Failed to delete account", "error", err, "userID", user.ID)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete account"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": "Account deleted"})
+}
+
+// JWKS publishes the public keys that verify access tokens
+func (h *AuthHandler) JWKS(c *gin.Context) {
+	c.Header("Cache-Control", "public, max-age=300")
+	c.JSON(http.StatusOK, h.authService.JWKS())
+}
+
+// ListSigningKeys lists the signing key ring without private material (admin only)
+func (h *AuthHandler) ListSigningKeys(c *gin.Context) {
+	keys, err := h.authService.KeyRing().List(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"keys": keys})
+}
+
+// RotateSigningKeys promotes a new signing key and schedules the current one for retirement (admin only)
+func (h *AuthHandler) RotateSigningKeys(c *gin.Context) {
+	key, err := h.authService.KeyRing().Rotate(c.Request.Context())
+	if err != nil {
+		h.logger.Error("Failed to rotate signing keys", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to rotate signing keys"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"key":     key,
+		"message": "Signing key rotated",
+	})
+}
+
+// Logout revokes the current access token and its refresh token family
+func (h *AuthHandler) Logout(c *gin.Context) {
+	claims := middleware.GetCurrentClaims(c)
+	if claims == nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	if err := h.authService.Logout(c.Request.Context(), claims); err != nil {
+		h.logger.Error("Failed to log out", "error", err, "userID", claims.UserID)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to log out"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": "Logged out"})
+}
+
+// LogoutAll revokes every session of the current user
+func (h *AuthHandler) LogoutAll(c *gin.Context) {
+	user := middleware.GetCurrentUser(c)
+	if user == nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	if err := h.authService.LogoutAll(c.Request.Context(), user.ID); err != nil {
+		h.logger.Error("Failed to log out all sessions", "error", err, "userID", user.ID)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to log out"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": "Logged out of all sessions"})
+}
+
+// LogoutUserEverywhere revokes every session of another user (admin only)
+func (h *AuthHandler) LogoutUserEverywhere(c *gin.Context) {
+	userID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	if err := h.authService.LogoutAll(c.Request.Context(), uint(userID)); err != nil {
+		h.logger.Error("Failed to revoke user sessions", "error", err, "userID", userID)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke sessions"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": "User sessions revoked"})
 }
 
 // CreateUser creates a new user (admin only)
 func (h *AuthHandler) CreateUser(c *gin.Context) {
-	// Note: Add admin authentication middleware in production
-
 	var req types.CreateUserRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	user, err := h.authService.CreateUser(c.Request.Context(), &req)
+	actor := middleware.GetCurrentUser(c)
+	user, err := h.authService.CreateUser(c.Request.Context(), actor.ID, &req, requestMeta(c, clientdetection.DetectClient(c)))
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
@@ -316,14 +936,10 @@ func (h *AuthHandler) CreateUser(c *gin.Context) {
 	})
 }
 
-// UpdateUserRole updates a user's role (admin only)
+// UpdateUserRole replaces a user's roles with a single role (admin only)
 func (h *AuthHandler) UpdateUserRole(c *gin.Context) {
-	// Note: Add admin authentication middleware in production
-
-	userIDStr := c.Param("id")
-	userID, err := strconv.ParseUint(userIDStr, 10, 32)
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+	userID, ok := userIDParam(c)
+	if !ok {
 		return
 	}
 
@@ -332,28 +948,66 @@ func (h *AuthHandler) UpdateUserRole(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	h.setUserRoles(c, userID, []string{req.Role})
+}
+
+// SetUserRoles replaces the roles assigned to a user (admin only)
+func (h *AuthHandler) SetUserRoles(c *gin.Context) {
+	userID, ok := userIDParam(c)
+	if !ok {
+		return
+	}
 
-	if err := h.authService.UpdateUserRole(c.Request.Context(), uint(userID), req.Role); err != nil {
+	var req types.SetUserRolesRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	h.setUserRoles(c, userID, req.Roles)
+}
+
+func (h *AuthHandler) setUserRoles(c *gin.Context, userID uint, roles []string) {
+	actor := middleware.GetCurrentUser(c)
+	meta := requestMeta(c, clientdetection.DetectClient(c))
+	if err := h.authService.Roles().SetUserRoles(c.Request.Context(), actor.ID, userID, roles, meta); err != nil {
+		switch {
+		case errors.Is(err, service.ErrUserNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		case errors.Is(err, service.ErrInvalidRole):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		default:
+			h.logger.Error("Failed to update user roles", "error", err, "userID", userID)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update user roles"})
+		}
+		return
+	}
 
 	c.JSON(http.StatusOK, gin.H{
-		"message": "User role updated successfully",
+		"message": "User roles updated successfully",
 	})
 }
 
-type ListCredentialsRequest struct {
-	UserID uint `json:"user_id" binding:"required"`
+// ListWebAuthnCredentials lists the signed-in user's passkeys
+func (h *AuthHandler) ListWebAuthnCredentials(c *gin.Context) {
+	user := middleware.GetCurrentUser(c)
+	if user == nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+	h.listWebAuthnCredentials(c, user.ID)
 }
 
-func (h *AuthHandler) ListWebAuthnCredentials(c *gin.Context) {
-	var req ListCredentialsRequest
-	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+// AdminListWebAuthnCredentials lists another user's passkeys (admin only)
+func (h *AuthHandler) AdminListWebAuthnCredentials(c *gin.Context) {
+	userID, ok := userIDParam(c)
+	if !ok {
 		return
 	}
-	creds, err := h.authService.WebAuthnService().ListCredentials(c.Request.Context(), req.UserID)
+	h.listWebAuthnCredentials(c, userID)
+}
+
+func (h *AuthHandler) listWebAuthnCredentials(c *gin.Context, userID uint) {
+	creds, err := h.authService.WebAuthnService().ListCredentials(c.Request.Context(), userID)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -361,74 +1015,191 @@ func (h *AuthHandler) ListWebAuthnCredentials(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"credentials": creds})
 }
 
+type RenameCredentialRequest struct {
+	Name string `json:"name" binding:"required"`
+}
+
+// RenameWebAuthnCredential renames one of the signed-in user's passkeys; :id is the base64url credential ID
+func (h *AuthHandler) RenameWebAuthnCredential(c *gin.Context) {
+	user := middleware.GetCurrentUser(c)
+	if user == nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	var req RenameCredentialRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+	credID, err := base64.RawURLEncoding.DecodeString(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid credential_id encoding"})
+		return
+	}
+
+	if err := h.authService.WebAuthnService().RenameCredential(c.Request.Context(), user.ID, credID, req.Name); err != nil {
+		switch {
+		case errors.Is(err, service.ErrInvalidCredentialName):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		case errors.Is(err, service.ErrCredentialNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		default:
+			h.logger.Error("Failed to rename passkey", "error", err, "userID", user.ID)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to rename passkey"})
+		}
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true})
+}
+
 type DeleteCredentialRequest struct {
-	UserID       uint   `json:"user_id" binding:"required"`
 	CredentialID string `json:"credential_id" binding:"required"`
 }
 
+// DeleteWebAuthnCredential removes one of the signed-in user's passkeys
 func (h *AuthHandler) DeleteWebAuthnCredential(c *gin.Context) {
+	user := middleware.GetCurrentUser(c)
+	if user == nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
 	var req DeleteCredentialRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
 		return
 	}
+	h.deleteWebAuthnCredential(c, user.ID, req.CredentialID, false)
+}
+
+// AdminDeleteWebAuthnCredential removes another user's passkey (admin only)
+func (h *AuthHandler) AdminDeleteWebAuthnCredential(c *gin.Context) {
+	userID, ok := userIDParam(c)
+	if !ok {
+		return
+	}
+	h.deleteWebAuthnCredential(c, userID, c.Param("credentialId"), true)
+}
+
+func (h *AuthHandler) deleteWebAuthnCredential(c *gin.Context, userID uint, credentialID string, allowLast bool) {
 	// Decode credential_id from base64url to []byte
-	credID, err := base64.RawURLEncoding.DecodeString(req.CredentialID)
+	credID, err := base64.RawURLEncoding.DecodeString(credentialID)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid credential_id encoding"})
 		return
 	}
-	if err := h.authService.WebAuthnService().DeleteCredential(c.Request.Context(), req.UserID, credID); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	if err := h.authService.WebAuthnService().DeleteCredential(c.Request.Context(), userID, credID, allowLast); err != nil {
+		var policyErr *service.CredentialPolicyError
+		switch {
+		case errors.As(err, &policyErr):
+			c.JSON(http.StatusConflict, gin.H{"error": policyErr.Message, "errorCode": policyErr.Code})
+		case errors.Is(err, service.ErrUserNotFound), errors.Is(err, service.ErrCredentialNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		default:
+			h.logger.Error("Failed to delete passkey", "error", err, "userID", userID)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete passkey"})
+		}
 		return
 	}
 	c.JSON(http.StatusOK, gin.H{"success": true})
 }
 
-type CheckUserRequest struct {
-	Email string `json:"email" binding:"required,email"`
+type SetPasskeyRequiredRequest struct {
+	Required *bool `json:"required" binding:"required"`
 }
 
-type CheckUserResponse struct {
-	UserExists  bool `json:"user_exists"`
-	HasPasskeys bool `json:"has_passkeys"`
-	UserID      uint `json:"user_id,omitempty"`
-}
+// SetPasskeyRequired sets whether a user must keep at least one passkey (admin only)
+func (h *AuthHandler) SetPasskeyRequired(c *gin.Context) {
+	userID, ok := userIDParam(c)
+	if !ok {
+		return
+	}
 
-func (h *AuthHandler) CheckUser(c *gin.Context) {
-	var req CheckUserRequest
+	var req SetPasskeyRequiredRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid email"})
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
 		return
 	}
 
-	// Check if user exists
-	user, err := h.authService.UserRepository().FindByEmail(c.Request.Context(), req.Email)
-	if err != nil {
-		h.logger.Error("Failed to find user", "error", err, "email", req.Email)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check user"})
+	if err := h.authService.WebAuthnService().SetPasskeyRequired(c.Request.Context(), middleware.GetCurrentUser(c).ID, userID, *req.Required, requestMeta(c, clientdetection.DetectClient(c))); err != nil {
+		if errors.Is(err, service.ErrUserNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+			return
+		}
+		h.logger.Error("Failed to update passkey requirement", "error", err, "userID", userID)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update passkey requirement"})
 		return
 	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "passkeyRequired": *req.Required})
+}
 
+type CheckUserResponse struct {
+	HasPasskeys bool `json:"has_passkeys"`
+	UserID      uint `json:"user_id"`
+}
+
+// CheckUser reports on the signed-in user only, so it can't be used to find out who has an account
+func (h *AuthHandler) CheckUser(c *gin.Context) {
+	user := middleware.GetCurrentUser(c)
 	if user == nil {
-		c.JSON(http.StatusOK, CheckUserResponse{
-			UserExists:  false,
-			HasPasskeys: false,
-		})
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
 		return
 	}
 
-	// Check if user has passkeys
-	hasPasskeys, err := h.authService.WebAuthnService().HasWebAuthnCredentials(c.Request.Context(), req.Email)
+	hasPasskeys, err := h.authService.WebAuthnService().HasWebAuthnCredentials(c.Request.Context(), user.Email)
 	if err != nil {
-		h.logger.Error("Failed to check passkeys", "error", err, "email", req.Email)
+		h.logger.Error("Failed to check passkeys", "error", err, "userID", user.ID)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check passkeys"})
 		return
 	}
 
 	c.JSON(http.StatusOK, CheckUserResponse{
-		UserExists:  true,
 		HasPasskeys: hasPasskeys,
 		UserID:      user.ID,
 	})
 }
+
+// userIDParam parses the :id route parameter, writing a 400 response when it is invalid
+func userIDParam(c *gin.Context) (uint, bool) {
+	userID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return 0, false
+	}
+	return uint(userID), true
+}
+
+// requestMeta collects the client details stored alongside a session
+func requestMeta(c *gin.Context, clientInfo clientdetection.ClientInfo) types.RequestMeta {
+	return types.RequestMeta{
+		ClientType: string(clientInfo.Type),
+		IPAddress:  c.ClientIP(),
+		UserAgent:  c.Request.UserAgent(),
+	}
+}
+
+// writeLoginCodeError tells the client why a code was rejected and whether to request a new one
+func writeLoginCodeError(c *gin.Context, err *service.LoginCodeError) {
+	response := gin.H{
+		"error":     err.Message,
+		"errorCode": err.Code,
+	}
+	if err.AttemptsRemaining > 0 {
+		response["attemptsRemaining"] = err.AttemptsRemaining
+	}
+
+	status := http.StatusUnauthorized
+	if err.RetryAfter > 0 {
+		retryAfter := int(math.Ceil(err.RetryAfter.Seconds()))
+		response["retryAfter"] = retryAfter
+		c.Header("Retry-After", strconv.Itoa(retryAfter))
+	}
+	switch err.Code {
+	case service.LoginErrorLockedOut:
+		status = http.StatusTooManyRequests
+	case service.LoginErrorDenied:
+		status = http.StatusForbidden
+	}
+	c.JSON(status, response)
+}
@@ -0,0 +1,313 @@
+package handlers
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/simple-auth-roles/internal/auth/service"
+	"github.com/simple-auth-roles/internal/middleware"
+	"github.com/simple-auth-roles/internal/types"
+	"github.com/simple-auth-roles/pkg/clientdetection"
+)
+
+type OIDCHandler struct {
+	authService *service.AuthService
+	oidcService *service.OIDCService
+	logger      *slog.Logger
+}
+
+func NewOIDCHandler(authService *service.AuthService, oidcService *service.OIDCService, logger *slog.Logger) *OIDCHandler {
+	return &OIDCHandler{
+		authService: authService,
+		oidcService: oidcService,
+		logger:      logger.With("handler", "oidc"),
+	}
+}
+
+func (h *OIDCHandler) RegisterRoutes(router *gin.RouterGroup) {
+	oauth := router.Group("/oauth")
+	{
+		oauth.GET("/authorize", h.Authorize)
+		oauth.GET("/authorize/requests/:id", h.GetAuthorizationRequest)
+		oauth.POST("/authorize/decision", middleware.RequireAuth(h.authService), h.AuthorizeDecision)
+		oauth.POST("/token", h.Token)
+		oauth.POST("/device/code", h.DeviceAuthorization)
+		oauth.GET("/device/requests/:user_code", middleware.RequireAuth(h.authService), h.GetDeviceAuthorization)
+		oauth.POST("/device/decision", middleware.RequireAuth(h.authService), h.DeviceDecision)
+		oauth.GET("/userinfo", middleware.RequireClientScope(h.authService, types.ScopeOpenID), h.UserInfo)
+		oauth.POST("/userinfo", middleware.RequireClientScope(h.authService, types.ScopeOpenID), h.UserInfo)
+	}
+	clients := router.Group("/admin/oauth/clients")
+	clients.Use(middleware.RequireAuth(h.authService), middleware.RequireRole(types.RoleAdmin))
+	{
+		clients.GET("", h.ListClients)
+		clients.POST("", h.CreateClient)
+		clients.DELETE("/:client_id", h.DeactivateClient)
+	}
+}
+
+func (h *OIDCHandler) RegisterWellKnownRoutes(router gin.IRouter) {
+	router.GET("/.well-known/openid-configuration", h.Discovery)
+}
+
+type AuthorizeQuery struct {
+	ResponseType        string `form:"response_type"`
+	ClientID            string `form:"client_id"`
+	RedirectURI         string `form:"redirect_uri"`
+	Scope               string `form:"scope"`
+	State               string `form:"state"`
+	Nonce               string `form:"nonce"`
+	CodeChallenge       string `form:"code_challenge"`
+	CodeChallengeMethod string `form:"code_challenge_method"`
+}
+
+type AuthorizeDecisionRequest struct {
+	RequestID string `json:"request_id" binding:"required"`
+	Approve   bool   `json:"approve"`
+}
+
+type DeviceDecisionRequest struct {
+	UserCode string `json:"user_code" binding:"required"`
+	Approve  bool   `json:"approve"`
+}
+
+// Discovery serves the OpenID Provider configuration
+func (h *OIDCHandler) Discovery(c *gin.Context) {
+	c.Header("Cache-Control", "public, max-age=300")
+	c.JSON(http.StatusOK, h.oidcService.Discovery())
+}
+
+// Authorize validates the request and sends the browser to the front-end login page
+func (h *OIDCHandler) Authorize(c *gin.Context) {
+	var query AuthorizeQuery
+	if err := c.ShouldBindQuery(&query); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_request"})
+		return
+	}
+
+	// Never redirect to an unverified redirect_uri
+	client, err := h.oidcService.ValidateRedirect(c.Request.Context(), query.ClientID, query.RedirectURI)
+	if err != nil {
+		h.writeOAuthError(c, err)
+		return
+	}
+
+	req := &types.AuthorizationRequest{
+		RedirectURI:         query.RedirectURI,
+		Scope:               query.Scope,
+		State:               query.State,
+		Nonce:               query.Nonce,
+		CodeChallenge:       query.CodeChallenge,
+		CodeChallengeMethod: query.CodeChallengeMethod,
+	}
+	if err := h.oidcService.Authorize(c.Request.Context(), client, query.ResponseType, req); err != nil {
+		var oauthErr *service.OAuthError
+		if errors.As(err, &oauthErr) {
+			c.Redirect(http.StatusFound, h.oidcService.ErrorRedirectURL(query.RedirectURI, query.State, oauthErr))
+			return
+		}
+		h.logger.Error("Failed to start authorization", "error", err, "client_id", query.ClientID)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "server_error"})
+		return
+	}
+
+	c.Redirect(http.StatusFound, h.oidcService.LoginURL(req))
+}
+
+// GetAuthorizationRequest returns what a pending request asks for, so the front-end can show a consent screen
+func (h *OIDCHandler) GetAuthorizationRequest(c *gin.Context) {
+	req, client, err := h.oidcService.GetAuthorizationRequest(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"request_id":  req.ID,
+		"client_id":   client.ClientID,
+		"client_name": client.Name,
+		"scope":       req.Scope,
+		"expires_at":  req.ExpiresAt,
+	})
+}
+
+// AuthorizeDecision completes a pending request for the signed-in user
+func (h *OIDCHandler) AuthorizeDecision(c *gin.Context) {
+	var req AuthorizeDecisionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+
+	user := middleware.GetCurrentUser(c)
+	claims := middleware.GetCurrentClaims(c)
+	authTime := time.Now()
+	if claims != nil && !claims.AuthenticatedAt().IsZero() {
+		authTime = claims.AuthenticatedAt()
+	}
+
+	redirectTo, err := h.oidcService.CompleteAuthorization(c.Request.Context(), req.RequestID, user, authTime, req.Approve)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"redirect_to": redirectTo})
+}
+
+// Token implements the OAuth 2.0 token endpoint
+func (h *OIDCHandler) Token(c *gin.Context) {
+	c.Header("Cache-Control", "no-store")
+	c.Header("Pragma", "no-cache")
+
+	req := &service.TokenRequest{
+		GrantType:    c.PostForm("grant_type"),
+		ClientID:     c.PostForm("client_id"),
+		ClientSecret: c.PostForm("client_secret"),
+		Code:         c.PostForm("code"),
+		RedirectURI:  c.PostForm("redirect_uri"),
+		CodeVerifier: c.PostForm("code_verifier"),
+		RefreshToken: c.PostForm("refresh_token"),
+		DeviceCode:   c.PostForm("device_code"),
+	}
+	if clientID, clientSecret, ok := c.Request.BasicAuth(); ok {
+		req.ClientID = clientID
+		req.ClientSecret = clientSecret
+	}
+
+	clientInfo := clientdetection.DetectClient(c)
+	response, err := h.oidcService.Token(c.Request.Context(), req, requestMeta(c, clientInfo))
+	if err != nil {
+		h.writeOAuthError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// DeviceAuthorization starts the device flow for clients that can't open a browser
+func (h *OIDCHandler) DeviceAuthorization(c *gin.Context) {
+	c.Header("Cache-Control", "no-store")
+
+	clientID, clientSecret := c.PostForm("client_id"), c.PostForm("client_secret")
+	if basicID, basicSecret, ok := c.Request.BasicAuth(); ok {
+		clientID, clientSecret = basicID, basicSecret
+	}
+
+	response, err := h.oidcService.StartDeviceAuthorization(c.Request.Context(), clientID, clientSecret, c.PostForm("scope"))
+	if err != nil {
+		h.writeOAuthError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// GetDeviceAuthorization returns what a user code asks for, so the front-end can ask the user to confirm
+func (h *OIDCHandler) GetDeviceAuthorization(c *gin.Context) {
+	authorization, client, err := h.oidcService.GetDeviceAuthorization(c.Request.Context(), c.Param("user_code"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"user_code":   authorization.UserCode,
+		"client_id":   client.ClientID,
+		"client_name": client.Name,
+		"scope":       authorization.Scope,
+		"expires_at":  authorization.ExpiresAt,
+	})
+}
+
+// DeviceDecision approves or denies a device for the signed-in user
+func (h *OIDCHandler) DeviceDecision(c *gin.Context) {
+	var req DeviceDecisionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+
+	user := middleware.GetCurrentUser(c)
+	claims := middleware.GetCurrentClaims(c)
+	authTime := time.Now()
+	if claims != nil && !claims.AuthenticatedAt().IsZero() {
+		authTime = claims.AuthenticatedAt()
+	}
+
+	if err := h.oidcService.CompleteDeviceAuthorization(c.Request.Context(), req.UserCode, user, authTime, req.Approve); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	message := "Device approved"
+	if !req.Approve {
+		message = "Device denied"
+	}
+	c.JSON(http.StatusOK, gin.H{"message": message})
+}
+
+// UserInfo returns claims about the user the access token belongs to
+func (h *OIDCHandler) UserInfo(c *gin.Context) {
+	user := middleware.GetCurrentUser(c)
+	claims := middleware.GetCurrentClaims(c)
+	c.JSON(http.StatusOK, h.oidcService.UserInfo(user, claims))
+}
+
+// CreateClient registers a new OAuth client (admin only)
+func (h *OIDCHandler) CreateClient(c *gin.Context) {
+	var req types.CreateOAuthClientRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	client, secret, err := h.oidcService.CreateClient(c.Request.Context(), &req)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	response := gin.H{
+		"client":  client,
+		"message": "Client registered successfully",
+	}
+	if secret != "" {
+		// Shown once; only a hash is stored
+		response["client_secret"] = secret
+	}
+	c.JSON(http.StatusCreated, response)
+}
+
+// ListClients lists registered OAuth clients (admin only)
+func (h *OIDCHandler) ListClients(c *gin.Context) {
+	clients, err := h.oidcService.ListClients(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"clients": clients})
+}
+
+// DeactivateClient disables an OAuth client (admin only)
+func (h *OIDCHandler) DeactivateClient(c *gin.Context) {
+	if err := h.oidcService.DeactivateClient(c.Request.Context(), c.Param("client_id")); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Client deactivated"})
+}
+
+// writeOAuthError renders an RFC 6749 error body, hiding internal errors
+func (h *OIDCHandler) writeOAuthError(c *gin.Context, err error) {
+	var oauthErr *service.OAuthError
+	if errors.As(err, &oauthErr) {
+		c.JSON(oauthErr.Status, oauthErr)
+		return
+	}
+	h.logger.Error("OAuth request failed", "error", err)
+	c.JSON(http.StatusInternalServerError, gin.H{"error": "server_error"})
+}
@@ -0,0 +1,290 @@
+package handlers
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/simple-auth-roles/internal/auth/service"
+	"github.com/simple-auth-roles/internal/middleware"
+	"github.com/simple-auth-roles/internal/types"
+)
+
+type OrgHandler struct {
+	authService *service.AuthService
+	orgService  *service.OrgService
+	logger      *slog.Logger
+}
+
+func NewOrgHandler(authService *service.AuthService, orgService *service.OrgService, logger *slog.Logger) *OrgHandler {
+	return &OrgHandler{
+		authService: authService,
+		orgService:  orgService,
+		logger:      logger.With("handler", "orgs"),
+	}
+}
+
+func (h *OrgHandler) RegisterRoutes(router *gin.RouterGroup) {
+	orgs := router.Group("/orgs")
+	orgs.Use(middleware.RequireAuth(h.authService))
+	{
+		orgs.POST("", h.CreateOrg)
+		orgs.GET("", h.ListMyOrgs)
+		orgs.GET("/:orgId", middleware.RequireOrgRole(h.authService, types.RoleUser), h.GetOrg)
+		orgs.GET("/:orgId/members", middleware.RequireOrgRole(h.authService, types.RoleUser), h.ListOrgMembers)
+		orgs.PUT("/:orgId/members/:id", middleware.RequireOrgRole(h.authService, types.RoleAdmin), h.SetOrgMember)
+		orgs.DELETE("/:orgId/members/:id", middleware.RequireOrgRole(h.authService, types.RoleAdmin), h.RemoveOrgMember)
+		orgs.POST("/:orgId/invitations", middleware.RequireOrgRole(h.authService, types.RoleAdmin), h.CreateInvitation)
+		orgs.GET("/:orgId/invitations", middleware.RequireOrgRole(h.authService, types.RoleAdmin), h.ListInvitations)
+		orgs.POST("/:orgId/invitations/:invitationId/resend", middleware.RequireOrgRole(h.authService, types.RoleAdmin), h.ResendInvitation)
+		orgs.DELETE("/:orgId/invitations/:invitationId", middleware.RequireOrgRole(h.authService, types.RoleAdmin), h.RevokeInvitation)
+	}
+
+	invitations := router.Group("/invitations")
+	{
+		invitations.GET("/preview", h.PreviewInvitation)
+		invitations.POST("/accept", middleware.RequireAuth(h.authService), h.AcceptInvitation)
+	}
+
+	admin := router.Group("/admin")
+	admin.Use(middleware.RequireAuth(h.authService), middleware.RequireRole(types.RoleAdmin))
+	{
+		admin.GET("/orgs", h.ListOrgs)
+	}
+}
+
+// CreateOrg creates an organization with the signed-in user as its admin
+func (h *OrgHandler) CreateOrg(c *gin.Context) {
+	var req types.CreateOrgRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	user := middleware.GetCurrentUser(c)
+	org, err := h.orgService.CreateOrg(c.Request.Context(), user.ID, middleware.GetCurrentRoles(c), &req)
+	if err != nil {
+		h.writeOrgError(c, err)
+		return
+	}
+	c.JSON(http.StatusCreated, gin.H{
+		"organization": org,
+		"message":      "Organization created successfully",
+	})
+}
+
+// ListMyOrgs lists the organizations the signed-in user belongs to with their role in each
+func (h *OrgHandler) ListMyOrgs(c *gin.Context) {
+	user := middleware.GetCurrentUser(c)
+	orgs, err := h.orgService.ListUserOrgs(c.Request.Context(), user.ID)
+	if err != nil {
+		h.writeOrgError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"organizations": orgs})
+}
+
+// GetOrg returns an organization with the caller's role in it (members only)
+func (h *OrgHandler) GetOrg(c *gin.Context) {
+	membership := middleware.GetCurrentOrgMembership(c)
+	org, err := h.orgService.GetOrg(c.Request.Context(), membership.OrgID)
+	if err != nil {
+		h.writeOrgError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"organization": org,
+		"role":         membership.Role,
+	})
+}
+
+// ListOrgMembers lists an organization's members (members only)
+func (h *OrgHandler) ListOrgMembers(c *gin.Context) {
+	membership := middleware.GetCurrentOrgMembership(c)
+	members, err := h.orgService.ListMembers(c.Request.Context(), membership.OrgID)
+	if err != nil {
+		h.writeOrgError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"members": members})
+}
+
+// SetOrgMember changes a member's role in the organization (org admins only)
+func (h *OrgHandler) SetOrgMember(c *gin.Context) {
+	userID, ok := userIDParam(c)
+	if !ok {
+		return
+	}
+
+	var req types.SetOrgMemberRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	actor, membership := middleware.GetCurrentUser(c), middleware.GetCurrentOrgMembership(c)
+	member, err := h.orgService.SetMemberRole(c.Request.Context(), actor.ID, membership.OrgID, userID, req.Role)
+	if err != nil {
+		h.writeOrgError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"membership": member,
+		"message":    "Member updated successfully",
+	})
+}
+
+// RemoveOrgMember removes a user from the organization (org admins only)
+func (h *OrgHandler) RemoveOrgMember(c *gin.Context) {
+	userID, ok := userIDParam(c)
+	if !ok {
+		return
+	}
+
+	actor, membership := middleware.GetCurrentUser(c), middleware.GetCurrentOrgMembership(c)
+	if err := h.orgService.RemoveMember(c.Request.Context(), actor.ID, membership.OrgID, userID); err != nil {
+		h.writeOrgError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Member removed successfully"})
+}
+
+// ListOrgs lists every organization (admin only)
+func (h *OrgHandler) ListOrgs(c *gin.Context) {
+	orgs, err := h.orgService.ListOrgs(c.Request.Context())
+	if err != nil {
+		h.writeOrgError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"organizations": orgs})
+}
+
+// CreateInvitation emails an invite link for the organization (org admins only)
+func (h *OrgHandler) CreateInvitation(c *gin.Context) {
+	var req types.CreateInvitationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	inviter, membership := middleware.GetCurrentUser(c), middleware.GetCurrentOrgMembership(c)
+	invitation, err := h.orgService.Invite(c.Request.Context(), inviter, membership.OrgID, &req)
+	if err != nil {
+		h.writeOrgError(c, err)
+		return
+	}
+	c.JSON(http.StatusCreated, gin.H{
+		"invitation": invitation,
+		"message":    "Invitation sent",
+	})
+}
+
+// ListInvitations lists the organization's invitations (org admins only)
+func (h *OrgHandler) ListInvitations(c *gin.Context) {
+	membership := middleware.GetCurrentOrgMembership(c)
+	invitations, err := h.orgService.ListInvitations(c.Request.Context(), membership.OrgID)
+	if err != nil {
+		h.writeOrgError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"invitations": invitations})
+}
+
+// ResendInvitation emails a fresh invite link, replacing the previous one (org admins only)
+func (h *OrgHandler) ResendInvitation(c *gin.Context) {
+	invitationID, ok := invitationIDParam(c)
+	if !ok {
+		return
+	}
+
+	inviter, membership := middleware.GetCurrentUser(c), middleware.GetCurrentOrgMembership(c)
+	invitation, err := h.orgService.ResendInvitation(c.Request.Context(), inviter, membership.OrgID, invitationID)
+	if err != nil {
+		h.writeOrgError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"invitation": invitation,
+		"message":    "Invitation resent",
+	})
+}
+
+// RevokeInvitation cancels a pending invitation (org admins only)
+func (h *OrgHandler) RevokeInvitation(c *gin.Context) {
+	invitationID, ok := invitationIDParam(c)
+	if !ok {
+		return
+	}
+
+	actor, membership := middleware.GetCurrentUser(c), middleware.GetCurrentOrgMembership(c)
+	if err := h.orgService.RevokeInvitation(c.Request.Context(), actor.ID, membership.OrgID, invitationID); err != nil {
+		h.writeOrgError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Invitation revoked"})
+}
+
+// PreviewInvitation shows which organization and role an invite link is for
+func (h *OrgHandler) PreviewInvitation(c *gin.Context) {
+	preview, err := h.orgService.PreviewInvitation(c.Request.Context(), c.Query("token"))
+	if err != nil {
+		h.writeOrgError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, preview)
+}
+
+// AcceptInvitation adds the signed-in user to the organization in an invite link
+func (h *OrgHandler) AcceptInvitation(c *gin.Context) {
+	var req types.AcceptInvitationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	user := middleware.GetCurrentUser(c)
+	membership, err := h.orgService.AcceptInvitation(c.Request.Context(), user, req.Token)
+	if err != nil {
+		h.writeOrgError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"membership": membership,
+		"message":    "Invitation accepted",
+	})
+}
+
+func invitationIDParam(c *gin.Context) (uint, bool) {
+	invitationID, err := strconv.ParseUint(c.Param("invitationId"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid invitation ID"})
+		return 0, false
+	}
+	return uint(invitationID), true
+}
+
+// writeOrgError maps organization service errors to responses, hiding internal errors
+func (h *OrgHandler) writeOrgError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, service.ErrOrgNotFound), errors.Is(err, service.ErrUserNotFound), errors.Is(err, service.ErrNotOrgMember),
+		errors.Is(err, service.ErrInvitationNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, service.ErrOrgSlugTaken), errors.Is(err, service.ErrInvitationExists), errors.Is(err, service.ErrInvitationNotPending),
+		errors.Is(err, service.ErrAlreadyOrgMember):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case errors.Is(err, service.ErrInvalidInvitation):
+		c.JSON(http.StatusGone, gin.H{"error": err.Error()})
+	case errors.Is(err, service.ErrTooManyInvitations):
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": err.Error()})
+	case errors.Is(err, service.ErrInvitationWrongEmail), errors.Is(err, service.ErrOrgCreationNotAllowed):
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+	case errors.Is(err, service.ErrInvalidOrgName), errors.Is(err, service.ErrInvalidOrgSlug), errors.Is(err, service.ErrLastOrgAdmin),
+		errors.Is(err, service.ErrInvalidRole):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		h.logger.Error("Organization request failed", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to process organization request"})
+	}
+}
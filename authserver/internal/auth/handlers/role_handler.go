@@ -0,0 +1,331 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/simple-auth-roles/internal/auth/service"
+	"github.com/simple-auth-roles/internal/middleware"
+	"github.com/simple-auth-roles/internal/types"
+	"github.com/simple-auth-roles/pkg/clientdetection"
+)
+
+type RoleHandler struct {
+	authService *service.AuthService
+	roleService *service.RoleService
+	logger      *slog.Logger
+}
+
+func NewRoleHandler(authService *service.AuthService, roleService *service.RoleService, logger *slog.Logger) *RoleHandler {
+	return &RoleHandler{
+		authService: authService,
+		roleService: roleService,
+		logger:      logger.With("handler", "roles"),
+	}
+}
+
+func (h *RoleHandler) RegisterRoutes(router *gin.RouterGroup) {
+	// Changing what roles allow is as sensitive as changing a user's role
+	maxAge, methods := h.authService.StepUpPolicy()
+	recentAuth := middleware.RequireRecentAuth(maxAge, methods...)
+
+	auth := router.Group("/auth")
+	auth.Use(middleware.RequireAuth(h.authService))
+	{
+		auth.POST("/elevation-requests", h.RequestElevation)
+		auth.GET("/elevation-requests", h.ListMyElevationRequests)
+	}
+
+	admin := router.Group("/admin")
+	admin.Use(middleware.RequireAuth(h.authService), middleware.RequireRole(types.RoleAdmin))
+	{
+		admin.GET("/roles", h.ListRoles)
+		admin.POST("/roles", recentAuth, h.CreateRole)
+		admin.PUT("/roles/:name/permissions/:permission", recentAuth, h.AddRolePermission)
+		admin.DELETE("/roles/:name/permissions/:permission", recentAuth, h.RemoveRolePermission)
+		admin.PUT("/roles/:name/inherits/:inherited", recentAuth, h.AddRoleInheritance)
+		admin.DELETE("/roles/:name/inherits/:inherited", recentAuth, h.RemoveRoleInheritance)
+		admin.GET("/permissions", h.ListPermissions)
+		admin.POST("/permissions", recentAuth, h.CreatePermission)
+		admin.GET("/users/:id/roles", h.ListUserRoleGrants)
+		admin.POST("/users/:id/roles", recentAuth, h.GrantUserRole)
+		admin.DELETE("/users/:id/roles/:role", recentAuth, h.RevokeUserRole)
+		admin.GET("/users/:id/security-events", h.ListUserSecurityEvents)
+		admin.GET("/elevation-requests", h.ListElevationRequests)
+		admin.POST("/elevation-requests/:id/approve", recentAuth, h.ApproveElevationRequest)
+		admin.POST("/elevation-requests/:id/deny", recentAuth, h.DenyElevationRequest)
+	}
+}
+
+// ListRoles lists roles with their permissions (admin only)
+func (h *RoleHandler) ListRoles(c *gin.Context) {
+	roles, err := h.roleService.ListRoles(c.Request.Context())
+	if err != nil {
+		h.logger.Error("Failed to list roles", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list roles"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"roles": roles})
+}
+
+// CreateRole creates a role with existing permissions (admin only)
+func (h *RoleHandler) CreateRole(c *gin.Context) {
+	var req types.CreateRoleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	role, err := h.roleService.CreateRole(c.Request.Context(), &req)
+	if err != nil {
+		h.writeRoleError(c, err)
+		return
+	}
+	c.JSON(http.StatusCreated, gin.H{
+		"role":    role,
+		"message": "Role created successfully",
+	})
+}
+
+// AddRolePermission grants a permission to a role (admin only)
+func (h *RoleHandler) AddRolePermission(c *gin.Context) {
+	if err := h.roleService.AddPermission(c.Request.Context(), c.Param("name"), c.Param("permission")); err != nil {
+		h.writeRoleError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Permission granted"})
+}
+
+// RemoveRolePermission revokes a permission from a role (admin only)
+func (h *RoleHandler) RemoveRolePermission(c *gin.Context) {
+	if err := h.roleService.RemovePermission(c.Request.Context(), c.Param("name"), c.Param("permission")); err != nil {
+		h.writeRoleError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Permission revoked"})
+}
+
+// AddRoleInheritance makes a role include another role (admin only)
+func (h *RoleHandler) AddRoleInheritance(c *gin.Context) {
+	if err := h.roleService.AddInheritance(c.Request.Context(), c.Param("name"), c.Param("inherited")); err != nil {
+		h.writeRoleError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Role inheritance added"})
+}
+
+// RemoveRoleInheritance stops a role including another role (admin only)
+func (h *RoleHandler) RemoveRoleInheritance(c *gin.Context) {
+	if err := h.roleService.RemoveInheritance(c.Request.Context(), c.Param("name"), c.Param("inherited")); err != nil {
+		h.writeRoleError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Role inheritance removed"})
+}
+
+// ListPermissions lists every permission (admin only)
+func (h *RoleHandler) ListPermissions(c *gin.Context) {
+	permissions, err := h.roleService.ListPermissions(c.Request.Context())
+	if err != nil {
+		h.logger.Error("Failed to list permissions", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list permissions"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"permissions": permissions})
+}
+
+// CreatePermission creates a permission that roles can be granted (admin only)
+func (h *RoleHandler) CreatePermission(c *gin.Context) {
+	var req types.CreatePermissionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	permission, err := h.roleService.CreatePermission(c.Request.Context(), &req)
+	if err != nil {
+		h.writeRoleError(c, err)
+		return
+	}
+	c.JSON(http.StatusCreated, gin.H{
+		"permission": permission,
+		"message":    "Permission created successfully",
+	})
+}
+
+// ListUserRoleGrants lists a user's roles with when each expires (admin only)
+func (h *RoleHandler) ListUserRoleGrants(c *gin.Context) {
+	userID, ok := userIDParam(c)
+	if !ok {
+		return
+	}
+
+	grants, err := h.roleService.ListGrants(c.Request.Context(), userID)
+	if err != nil {
+		h.writeRoleError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"roles": grants})
+}
+
+// GrantUserRole grants a user a role, until the given duration has passed when one is set (admin only)
+func (h *RoleHandler) GrantUserRole(c *gin.Context) {
+	userID, ok := userIDParam(c)
+	if !ok {
+		return
+	}
+
+	var req types.GrantRoleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	var duration time.Duration
+	if req.Duration != "" {
+		var err error
+		if duration, err = time.ParseDuration(req.Duration); err != nil || duration <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "duration must be a positive duration, e.g. 24h"})
+			return
+		}
+	}
+
+	actor := middleware.GetCurrentUser(c)
+	meta := requestMeta(c, clientdetection.DetectClient(c))
+	grant, err := h.roleService.GrantRole(c.Request.Context(), actor.ID, userID, req.Role, duration, meta)
+	if err != nil {
+		h.writeRoleError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"role":    grant,
+		"message": "Role granted",
+	})
+}
+
+// RevokeUserRole removes a role from a user (admin only)
+func (h *RoleHandler) RevokeUserRole(c *gin.Context) {
+	userID, ok := userIDParam(c)
+	if !ok {
+		return
+	}
+
+	actor := middleware.GetCurrentUser(c)
+	meta := requestMeta(c, clientdetection.DetectClient(c))
+	if err := h.roleService.RevokeRole(c.Request.Context(), actor.ID, userID, c.Param("role"), meta); err != nil {
+		h.writeRoleError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Role revoked"})
+}
+
+// ListUserSecurityEvents lists a user's recent security events, including every role change (admin only)
+func (h *RoleHandler) ListUserSecurityEvents(c *gin.Context) {
+	userID, ok := userIDParam(c)
+	if !ok {
+		return
+	}
+
+	events, err := h.roleService.ListSecurityEvents(c.Request.Context(), userID)
+	if err != nil {
+		h.writeRoleError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"events": events})
+}
+
+// RequestElevation asks for a role for a limited time, to be approved by an admin
+func (h *RoleHandler) RequestElevation(c *gin.Context) {
+	var req types.CreateElevationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	user := middleware.GetCurrentUser(c)
+	meta := requestMeta(c, clientdetection.DetectClient(c))
+	request, err := h.roleService.RequestElevation(c.Request.Context(), user.ID, &req, meta)
+	if err != nil {
+		h.writeRoleError(c, err)
+		return
+	}
+	c.JSON(http.StatusCreated, gin.H{
+		"request": request,
+		"message": "Elevation requested; an admin must approve it",
+	})
+}
+
+// ListMyElevationRequests lists the signed-in user's elevation requests
+func (h *RoleHandler) ListMyElevationRequests(c *gin.Context) {
+	user := middleware.GetCurrentUser(c)
+	requests, err := h.roleService.ListUserElevationRequests(c.Request.Context(), user.ID)
+	if err != nil {
+		h.writeRoleError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"requests": requests})
+}
+
+// ListElevationRequests lists elevation requests, optionally only those with ?status= (admin only)
+func (h *RoleHandler) ListElevationRequests(c *gin.Context) {
+	requests, err := h.roleService.ListElevationRequests(c.Request.Context(), c.Query("status"))
+	if err != nil {
+		h.writeRoleError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"requests": requests})
+}
+
+// ApproveElevationRequest grants the requested role for the requested time (admin only)
+func (h *RoleHandler) ApproveElevationRequest(c *gin.Context) {
+	h.reviewElevationRequest(c, h.roleService.ApproveElevation, "Elevation approved")
+}
+
+// DenyElevationRequest rejects an elevation request (admin only)
+func (h *RoleHandler) DenyElevationRequest(c *gin.Context) {
+	h.reviewElevationRequest(c, h.roleService.DenyElevation, "Elevation denied")
+}
+
+func (h *RoleHandler) reviewElevationRequest(c *gin.Context, review func(context.Context, uint, uint, types.RequestMeta) (*types.ElevationRequest, error), message string) {
+	requestID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid elevation request ID"})
+		return
+	}
+
+	reviewer := middleware.GetCurrentUser(c)
+	meta := requestMeta(c, clientdetection.DetectClient(c))
+	request, err := review(c.Request.Context(), reviewer.ID, uint(requestID), meta)
+	if err != nil {
+		h.writeRoleError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"request": request,
+		"message": message,
+	})
+}
+
+// writeRoleError maps role service errors to responses, hiding internal errors
+func (h *RoleHandler) writeRoleError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, service.ErrInvalidRole), errors.Is(err, service.ErrPermissionNotFound), errors.Is(err, service.ErrUserNotFound),
+		errors.Is(err, service.ErrRoleNotAssigned), errors.Is(err, service.ErrElevationRequestNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, service.ErrRoleExists), errors.Is(err, service.ErrPermissionExists), errors.Is(err, service.ErrRoleAlreadyAssigned),
+		errors.Is(err, service.ErrElevationPending), errors.Is(err, service.ErrElevationNotPending):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case errors.Is(err, service.ErrSelfApproval):
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+	case errors.Is(err, service.ErrInvalidRoleName), errors.Is(err, service.ErrInvalidPermissionName), errors.Is(err, service.ErrAdminRolePermissions), errors.Is(err, service.ErrRoleCycle),
+		errors.Is(err, service.ErrInvalidDuration), errors.Is(err, service.ErrInvalidElevationStatus):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		h.logger.Error("Role request failed", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update roles"})
+	}
+}
@@ -0,0 +1,124 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/simple-auth-roles/internal/types"
+	"gorm.io/gorm"
+)
+
+type ElevationRequestRepository struct {
+	db *gorm.DB
+}
+
+func NewElevationRequestRepository(db *gorm.DB) *ElevationRequestRepository {
+	return &ElevationRequestRepository{db: db}
+}
+
+func (r *ElevationRequestRepository) Create(ctx context.Context, request *types.ElevationRequest) error {
+	if err := r.db.WithContext(ctx).Create(request).Error; err != nil {
+		return fmt.Errorf("failed to create elevation request: %w", err)
+	}
+	return nil
+}
+
+func (r *ElevationRequestRepository) FindByID(ctx context.Context, id uint) (*types.ElevationRequest, error) {
+	var request types.ElevationRequest
+	if err := r.db.WithContext(ctx).First(&request, id).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to find elevation request: %w", err)
+	}
+	return &request, nil
+}
+
+// HasPending reports whether the user already has an unexpired request for role awaiting review
+func (r *ElevationRequestRepository) HasPending(ctx context.Context, userID uint, role string) (bool, error) {
+	var count int64
+	if err := r.db.WithContext(ctx).Model(&types.ElevationRequest{}).
+		Where("user_id = ? AND role = ? AND status = ? AND expires_at > ?", userID, role, types.ElevationStatusPending, time.Now()).
+		Count(&count).Error; err != nil {
+		return false, fmt.Errorf("failed to check elevation requests: %w", err)
+	}
+	return count > 0, nil
+}
+
+// List returns requests with status, or every request when status is empty, newest first
+func (r *ElevationRequestRepository) List(ctx context.Context, status string, limit int) ([]types.ElevationRequest, error) {
+	requests := []types.ElevationRequest{}
+	query := r.db.WithContext(ctx).Order("created_at DESC").Limit(limit)
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+	if err := query.Find(&requests).Error; err != nil {
+		return nil, fmt.Errorf("failed to list elevation requests: %w", err)
+	}
+	return requests, nil
+}
+
+// ListByUser returns the user's requests, newest first
+func (r *ElevationRequestRepository) ListByUser(ctx context.Context, userID uint, limit int) ([]types.ElevationRequest, error) {
+	requests := []types.ElevationRequest{}
+	if err := r.db.WithContext(ctx).Where("user_id = ?", userID).
+		Order("created_at DESC").Limit(limit).Find(&requests).Error; err != nil {
+		return nil, fmt.Errorf("failed to list elevation requests: %w", err)
+	}
+	return requests, nil
+}
+
+// Approve marks a pending, unexpired request approved and grants its role until expiresAt, in one
+// transaction. It reports false without changing anything when the request can no longer be approved.
+func (r *ElevationRequestRepository) Approve(ctx context.Context, request *types.ElevationRequest, reviewerID uint, expiresAt time.Time) (bool, error) {
+	approved := false
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		ok, err := review(tx, request, types.ElevationStatusApproved, reviewerID)
+		if err != nil || !ok {
+			return err
+		}
+		approved = true
+		return grantRoles(tx, request.UserID, []string{request.Role}, &expiresAt, &reviewerID)
+	})
+	return approved, err
+}
+
+// Deny marks a pending, unexpired request denied, reporting false when it can no longer be reviewed
+func (r *ElevationRequestRepository) Deny(ctx context.Context, request *types.ElevationRequest, reviewerID uint) (bool, error) {
+	return review(r.db.WithContext(ctx), request, types.ElevationStatusDenied, reviewerID)
+}
+
+// ExpirePending marks requests that were not reviewed in time expired, returning how many were
+func (r *ElevationRequestRepository) ExpirePending(ctx context.Context, now time.Time) (int64, error) {
+	result := r.db.WithContext(ctx).Model(&types.ElevationRequest{}).
+		Where("status = ? AND expires_at <= ?", types.ElevationStatusPending, now).
+		Update("status", types.ElevationStatusExpired)
+	if result.Error != nil {
+		return 0, fmt.Errorf("failed to expire elevation requests: %w", result.Error)
+	}
+	return result.RowsAffected, nil
+}
+
+// review records the decision on a request that is still pending and unexpired
+func review(tx *gorm.DB, request *types.ElevationRequest, status string, reviewerID uint) (bool, error) {
+	now := time.Now()
+	result := tx.Model(&types.ElevationRequest{}).
+		Where("id = ? AND status = ? AND expires_at > ?", request.ID, types.ElevationStatusPending, now).
+		Updates(map[string]interface{}{
+			"status":      status,
+			"reviewed_by": reviewerID,
+			"reviewed_at": now,
+		})
+	if result.Error != nil {
+		return false, fmt.Errorf("failed to review elevation request: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return false, nil
+	}
+
+	request.Status = status
+	request.ReviewedBy = &reviewerID
+	request.ReviewedAt = &now
+	return true, nil
+}
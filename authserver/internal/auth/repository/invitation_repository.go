@@ -0,0 +1,140 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/simple-auth-roles/internal/types"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type InvitationRepository struct {
+	db *gorm.DB
+}
+
+func NewInvitationRepository(db *gorm.DB) *InvitationRepository {
+	return &InvitationRepository{db: db}
+}
+
+func (r *InvitationRepository) Create(ctx context.Context, invitation *types.OrgInvitation) error {
+	if err := r.db.WithContext(ctx).Create(invitation).Error; err != nil {
+		return fmt.Errorf("failed to create invitation: %w", err)
+	}
+	return nil
+}
+
+func (r *InvitationRepository) FindByID(ctx context.Context, id uint) (*types.OrgInvitation, error) {
+	var invitation types.OrgInvitation
+	if err := r.db.WithContext(ctx).First(&invitation, id).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to find invitation: %w", err)
+	}
+	return &invitation, nil
+}
+
+// FindPending returns the organization's unexpired pending invitation for email, if any
+func (r *InvitationRepository) FindPending(ctx context.Context, orgID uint, email string) (*types.OrgInvitation, error) {
+	var invitation types.OrgInvitation
+	if err := r.db.WithContext(ctx).
+		Where("org_id = ? AND email = ? AND status = ? AND expires_at > ?", orgID, email, types.InvitationStatusPending, time.Now()).
+		First(&invitation).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to find invitation: %w", err)
+	}
+	return &invitation, nil
+}
+
+// HasPendingForEmail reports whether any organization has an unexpired pending invitation for email
+func (r *InvitationRepository) HasPendingForEmail(ctx context.Context, email string) (bool, error) {
+	var count int64
+	if err := r.db.WithContext(ctx).Model(&types.OrgInvitation{}).
+		Where("email = ? AND status = ? AND expires_at > ?", email, types.InvitationStatusPending, time.Now()).
+		Count(&count).Error; err != nil {
+		return false, fmt.Errorf("failed to check invitations: %w", err)
+	}
+	return count > 0, nil
+}
+
+// ListByOrg returns the organization's invitations, newest first
+func (r *InvitationRepository) ListByOrg(ctx context.Context, orgID uint) ([]types.OrgInvitation, error) {
+	invitations := []types.OrgInvitation{}
+	if err := r.db.WithContext(ctx).Where("org_id = ?", orgID).
+		Order("created_at DESC").Find(&invitations).Error; err != nil {
+		return nil, fmt.Errorf("failed to list invitations: %w", err)
+	}
+	return invitations, nil
+}
+
+// Renew replaces a pending invitation's link and restarts its expiry, reporting false when it is no longer pending
+func (r *InvitationRepository) Renew(ctx context.Context, invitation *types.OrgInvitation, linkID string, sentAt, expiresAt time.Time) (bool, error) {
+	result := r.db.WithContext(ctx).Model(&types.OrgInvitation{}).
+		Where("id = ? AND status = ?", invitation.ID, types.InvitationStatusPending).
+		Updates(map[string]interface{}{
+			"link_id":    linkID,
+			"sent_at":    sentAt,
+			"expires_at": expiresAt,
+		})
+	if result.Error != nil {
+		return false, fmt.Errorf("failed to renew invitation: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return false, nil
+	}
+
+	invitation.LinkID = linkID
+	invitation.SentAt = sentAt
+	invitation.ExpiresAt = expiresAt
+	return true, nil
+}
+
+// Revoke cancels a pending invitation of the organization, reporting false when there is none
+func (r *InvitationRepository) Revoke(ctx context.Context, orgID, id uint) (bool, error) {
+	result := r.db.WithContext(ctx).Model(&types.OrgInvitation{}).
+		Where("id = ? AND org_id = ? AND status = ?", id, orgID, types.InvitationStatusPending).
+		Update("status", types.InvitationStatusRevoked)
+	if result.Error != nil {
+		return false, fmt.Errorf("failed to revoke invitation: %w", result.Error)
+	}
+	return result.RowsAffected == 1, nil
+}
+
+// Accept marks the invitation accepted by the user and adds them to the organization with its role,
+// in one transaction. A user who is already a member keeps their role. It reports false without
+// changing anything when the invitation is no longer pending, has expired or its link was replaced.
+func (r *InvitationRepository) Accept(ctx context.Context, invitation *types.OrgInvitation, userID uint) (bool, error) {
+	accepted := false
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+		result := tx.Model(&types.OrgInvitation{}).
+			Where("id = ? AND link_id = ? AND status = ? AND expires_at > ?", invitation.ID, invitation.LinkID, types.InvitationStatusPending, now).
+			Updates(map[string]interface{}{
+				"status":      types.InvitationStatusAccepted,
+				"accepted_by": userID,
+				"accepted_at": now,
+			})
+		if result.Error != nil {
+			return fmt.Errorf("failed to accept invitation: %w", result.Error)
+		}
+		if result.RowsAffected == 0 {
+			return nil
+		}
+		accepted = true
+
+		membership := types.OrgMembership{OrgID: invitation.OrgID, UserID: userID, Role: invitation.Role}
+		if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&membership).Error; err != nil {
+			return fmt.Errorf("failed to add organization member: %w", err)
+		}
+
+		invitation.Status = types.InvitationStatusAccepted
+		invitation.AcceptedBy = &userID
+		invitation.AcceptedAt = &now
+		return nil
+	})
+	return accepted, err
+}
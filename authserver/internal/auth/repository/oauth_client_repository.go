@@ -0,0 +1,56 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/simple-auth-roles/internal/types"
+	"gorm.io/gorm"
+)
+
+type OAuthClientRepository struct {
+	db *gorm.DB
+}
+
+func NewOAuthClientRepository(db *gorm.DB) *OAuthClientRepository {
+	return &OAuthClientRepository{db: db}
+}
+
+func (r *OAuthClientRepository) Create(ctx context.Context, client *types.OAuthClient) error {
+	if err := r.db.WithContext(ctx).Create(client).Error; err != nil {
+		return fmt.Errorf("failed to create oauth client: %w", err)
+	}
+	return nil
+}
+
+func (r *OAuthClientRepository) FindByClientID(ctx context.Context, clientID string) (*types.OAuthClient, error) {
+	var client types.OAuthClient
+	if err := r.db.WithContext(ctx).Where("client_id = ?", clientID).First(&client).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to find oauth client: %w", err)
+	}
+	return &client, nil
+}
+
+func (r *OAuthClientRepository) FindAll(ctx context.Context) ([]*types.OAuthClient, error) {
+	var clients []*types.OAuthClient
+	if err := r.db.WithContext(ctx).Order("created_at").Find(&clients).Error; err != nil {
+		return nil, fmt.Errorf("failed to find oauth clients: %w", err)
+	}
+	return clients, nil
+}
+
+func (r *OAuthClientRepository) Deactivate(ctx context.Context, clientID string) error {
+	result := r.db.WithContext(ctx).Model(&types.OAuthClient{}).
+		Where("client_id = ?", clientID).
+		Update("is_active", false)
+	if result.Error != nil {
+		return fmt.Errorf("failed to deactivate oauth client: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("oauth client not found")
+	}
+	return nil
+}
@@ -0,0 +1,131 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/simple-auth-roles/internal/types"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type OrgRepository struct {
+	db *gorm.DB
+}
+
+func NewOrgRepository(db *gorm.DB) *OrgRepository {
+	return &OrgRepository{db: db}
+}
+
+// CreateWithMember creates an organization with its first member, reporting false without
+// changing anything when the slug is taken
+func (r *OrgRepository) CreateWithMember(ctx context.Context, org *types.Organization, userID uint, role string) (bool, error) {
+	created := false
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		result := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(org)
+		if result.Error != nil {
+			return fmt.Errorf("failed to create organization: %w", result.Error)
+		}
+		if result.RowsAffected == 0 {
+			return nil
+		}
+		created = true
+
+		membership := types.OrgMembership{OrgID: org.ID, UserID: userID, Role: role}
+		if err := tx.Create(&membership).Error; err != nil {
+			return fmt.Errorf("failed to add organization member: %w", err)
+		}
+		return nil
+	})
+	return created, err
+}
+
+func (r *OrgRepository) FindByID(ctx context.Context, id uint) (*types.Organization, error) {
+	var org types.Organization
+	if err := r.db.WithContext(ctx).First(&org, id).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to find organization: %w", err)
+	}
+	return &org, nil
+}
+
+// List returns every organization
+func (r *OrgRepository) List(ctx context.Context) ([]types.Organization, error) {
+	orgs := []types.Organization{}
+	if err := r.db.WithContext(ctx).Order("name").Find(&orgs).Error; err != nil {
+		return nil, fmt.Errorf("failed to list organizations: %w", err)
+	}
+	return orgs, nil
+}
+
+// ListForUser returns the organizations the user belongs to with their role in each
+func (r *OrgRepository) ListForUser(ctx context.Context, userID uint) ([]types.UserOrg, error) {
+	orgs := []types.UserOrg{}
+	if err := r.db.WithContext(ctx).Model(&types.OrgMembership{}).
+		Select("organizations.id, organizations.name, organizations.slug, org_memberships.role").
+		Joins("JOIN organizations ON organizations.id = org_memberships.org_id").
+		Where("org_memberships.user_id = ?", userID).
+		Order("organizations.name").
+		Scan(&orgs).Error; err != nil {
+		return nil, fmt.Errorf("failed to list user organizations: %w", err)
+	}
+	return orgs, nil
+}
+
+func (r *OrgRepository) FindMembership(ctx context.Context, orgID, userID uint) (*types.OrgMembership, error) {
+	var membership types.OrgMembership
+	if err := r.db.WithContext(ctx).Where("org_id = ? AND user_id = ?", orgID, userID).First(&membership).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to find organization membership: %w", err)
+	}
+	return &membership, nil
+}
+
+// ListMembers returns the organization's members with their details
+func (r *OrgRepository) ListMembers(ctx context.Context, orgID uint) ([]types.OrgMember, error) {
+	members := []types.OrgMember{}
+	if err := r.db.WithContext(ctx).Model(&types.OrgMembership{}).
+		Select("users.id AS user_id, users.email, users.name, org_memberships.role, org_memberships.created_at").
+		Joins("JOIN users ON users.id = org_memberships.user_id").
+		Where("org_memberships.org_id = ?", orgID).
+		Order("users.email").
+		Scan(&members).Error; err != nil {
+		return nil, fmt.Errorf("failed to list organization members: %w", err)
+	}
+	return members, nil
+}
+
+// CountMembersWithRole counts the organization's members holding exactly role
+func (r *OrgRepository) CountMembersWithRole(ctx context.Context, orgID uint, role string) (int64, error) {
+	var count int64
+	if err := r.db.WithContext(ctx).Model(&types.OrgMembership{}).
+		Where("org_id = ? AND role = ?", orgID, role).
+		Count(&count).Error; err != nil {
+		return 0, fmt.Errorf("failed to count organization members: %w", err)
+	}
+	return count, nil
+}
+
+// UpdateMembershipRole changes a member's role, reporting false when the user isn't a member
+func (r *OrgRepository) UpdateMembershipRole(ctx context.Context, membership *types.OrgMembership) (bool, error) {
+	result := r.db.WithContext(ctx).Model(&types.OrgMembership{}).
+		Where("org_id = ? AND user_id = ?", membership.OrgID, membership.UserID).
+		Update("role", membership.Role)
+	if result.Error != nil {
+		return false, fmt.Errorf("failed to update organization membership: %w", result.Error)
+	}
+	return result.RowsAffected > 0, nil
+}
+
+// DeleteMembership removes a member, reporting whether they belonged to the organization
+func (r *OrgRepository) DeleteMembership(ctx context.Context, orgID, userID uint) (bool, error) {
+	result := r.db.WithContext(ctx).Where("org_id = ? AND user_id = ?", orgID, userID).Delete(&types.OrgMembership{})
+	if result.Error != nil {
+		return false, fmt.Errorf("failed to delete organization membership: %w", result.Error)
+	}
+	return result.RowsAffected > 0, nil
+}
@@ -0,0 +1,157 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/simple-auth-roles/internal/types"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type RoleRepository struct {
+	db *gorm.DB
+}
+
+func NewRoleRepository(db *gorm.DB) *RoleRepository {
+	return &RoleRepository{db: db}
+}
+
+// ListRoles returns every role with its permissions and the roles it directly inherits
+func (r *RoleRepository) ListRoles(ctx context.Context) ([]types.Role, error) {
+	var roles []types.Role
+	if err := r.db.WithContext(ctx).Preload("Permissions").Order("name").Find(&roles).Error; err != nil {
+		return nil, fmt.Errorf("failed to list roles: %w", err)
+	}
+
+	var links []types.RoleInheritance
+	if err := r.db.WithContext(ctx).Find(&links).Error; err != nil {
+		return nil, fmt.Errorf("failed to list role inheritance: %w", err)
+	}
+	names := make(map[uint]string, len(roles))
+	for _, role := range roles {
+		names[role.ID] = role.Name
+	}
+	inherits := make(map[uint][]string, len(roles))
+	for _, link := range links {
+		inherits[link.RoleID] = append(inherits[link.RoleID], names[link.InheritedRoleID])
+	}
+	for i := range roles {
+		roles[i].Inherits = inherits[roles[i].ID]
+		if roles[i].Inherits == nil {
+			roles[i].Inherits = []string{}
+		}
+	}
+	return roles, nil
+}
+
+func (r *RoleRepository) FindRoleByName(ctx context.Context, name string) (*types.Role, error) {
+	var role types.Role
+	if err := r.db.WithContext(ctx).Preload("Permissions").Where("name = ?", name).First(&role).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to find role: %w", err)
+	}
+	return &role, nil
+}
+
+func (r *RoleRepository) RoleExists(ctx context.Context, name string) (bool, error) {
+	var count int64
+	if err := r.db.WithContext(ctx).Model(&types.Role{}).Where("name = ?", name).Count(&count).Error; err != nil {
+		return false, fmt.Errorf("failed to check role: %w", err)
+	}
+	return count > 0, nil
+}
+
+// CreateRole creates a role with its permissions and inherited roles, which must already exist.
+// It reports false without changing anything when the name is taken.
+func (r *RoleRepository) CreateRole(ctx context.Context, role *types.Role) (bool, error) {
+	created := false
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		result := tx.Clauses(clause.OnConflict{DoNothing: true}).Omit(clause.Associations).Create(role)
+		if result.Error != nil {
+			return fmt.Errorf("failed to create role: %w", result.Error)
+		}
+		if result.RowsAffected == 0 {
+			return nil
+		}
+		created = true
+
+		if len(role.Permissions) > 0 {
+			if err := tx.Model(role).Omit("Permissions.*").Association("Permissions").Append(role.Permissions); err != nil {
+				return fmt.Errorf("failed to add role permissions: %w", err)
+			}
+		}
+		if len(role.Inherits) > 0 {
+			if err := tx.Exec(`INSERT INTO role_inheritances (role_id, inherited_role_id)
+				SELECT ?, id FROM roles WHERE name IN ?`, role.ID, role.Inherits).Error; err != nil {
+				return fmt.Errorf("failed to add inherited roles: %w", err)
+			}
+		}
+		return nil
+	})
+	return created, err
+}
+
+// ListPermissions returns every permission
+func (r *RoleRepository) ListPermissions(ctx context.Context) ([]types.Permission, error) {
+	var permissions []types.Permission
+	if err := r.db.WithContext(ctx).Order("name").Find(&permissions).Error; err != nil {
+		return nil, fmt.Errorf("failed to list permissions: %w", err)
+	}
+	return permissions, nil
+}
+
+// FindPermissionsByName returns the permissions that exist among names
+func (r *RoleRepository) FindPermissionsByName(ctx context.Context, names []string) ([]types.Permission, error) {
+	var permissions []types.Permission
+	if err := r.db.WithContext(ctx).Where("name IN ?", names).Find(&permissions).Error; err != nil {
+		return nil, fmt.Errorf("failed to find permissions: %w", err)
+	}
+	return permissions, nil
+}
+
+// CreatePermission creates a permission, reporting false without changing anything when the name is taken
+func (r *RoleRepository) CreatePermission(ctx context.Context, permission *types.Permission) (bool, error) {
+	result := r.db.WithContext(ctx).Clauses(clause.OnConflict{DoNothing: true}).Create(permission)
+	if result.Error != nil {
+		return false, fmt.Errorf("failed to create permission: %w", result.Error)
+	}
+	return result.RowsAffected == 1, nil
+}
+
+// AddRolePermission grants a permission to a role; granting it twice is not an error
+func (r *RoleRepository) AddRolePermission(ctx context.Context, role *types.Role, permission *types.Permission) error {
+	if err := r.db.WithContext(ctx).Model(role).Omit("Permissions.*").Association("Permissions").Append(permission); err != nil {
+		return fmt.Errorf("failed to add role permission: %w", err)
+	}
+	return nil
+}
+
+// RemoveRolePermission revokes a permission from a role
+func (r *RoleRepository) RemoveRolePermission(ctx context.Context, role *types.Role, permission *types.Permission) error {
+	if err := r.db.WithContext(ctx).Model(role).Association("Permissions").Delete(permission); err != nil {
+		return fmt.Errorf("failed to remove role permission: %w", err)
+	}
+	return nil
+}
+
+// AddRoleInheritance makes role include inherited; adding it twice is not an error
+func (r *RoleRepository) AddRoleInheritance(ctx context.Context, role, inherited *types.Role) error {
+	link := types.RoleInheritance{RoleID: role.ID, InheritedRoleID: inherited.ID}
+	if err := r.db.WithContext(ctx).Clauses(clause.OnConflict{DoNothing: true}).Create(&link).Error; err != nil {
+		return fmt.Errorf("failed to add inherited role: %w", err)
+	}
+	return nil
+}
+
+// RemoveRoleInheritance stops role including inherited
+func (r *RoleRepository) RemoveRoleInheritance(ctx context.Context, role, inherited *types.Role) error {
+	if err := r.db.WithContext(ctx).
+		Where("role_id = ? AND inherited_role_id = ?", role.ID, inherited.ID).
+		Delete(&types.RoleInheritance{}).Error; err != nil {
+		return fmt.Errorf("failed to remove inherited role: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,34 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/simple-auth-roles/internal/types"
+	"gorm.io/gorm"
+)
+
+type SecurityEventRepository struct {
+	db *gorm.DB
+}
+
+func NewSecurityEventRepository(db *gorm.DB) *SecurityEventRepository {
+	return &SecurityEventRepository{db: db}
+}
+
+func (r *SecurityEventRepository) Create(ctx context.Context, event *types.SecurityEvent) error {
+	if err := r.db.WithContext(ctx).Create(event).Error; err != nil {
+		return fmt.Errorf("failed to create security event: %w", err)
+	}
+	return nil
+}
+
+// ListByUser returns the user's most recent security events first
+func (r *SecurityEventRepository) ListByUser(ctx context.Context, userID uint, limit int) ([]types.SecurityEvent, error) {
+	var events []types.SecurityEvent
+	if err := r.db.WithContext(ctx).Where("user_id = ?", userID).
+		Order("created_at DESC").Limit(limit).Find(&events).Error; err != nil {
+		return nil, fmt.Errorf("failed to list security events: %w", err)
+	}
+	return events, nil
+}
@@ -0,0 +1,78 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/simple-auth-roles/internal/types"
+	"gorm.io/gorm"
+)
+
+type SigningKeyRepository struct {
+	db *gorm.DB
+}
+
+func NewSigningKeyRepository(db *gorm.DB) *SigningKeyRepository {
+	return &SigningKeyRepository{db: db}
+}
+
+// ListUsable returns the active key and every retired key that has not passed its not-after date
+func (r *SigningKeyRepository) ListUsable(ctx context.Context, now time.Time) ([]types.SigningKey, error) {
+	var keys []types.SigningKey
+	if err := r.db.WithContext(ctx).
+		Where("status = ? OR (status = ? AND not_after > ?)", types.SigningKeyStatusActive, types.SigningKeyStatusRetired, now).
+		Order("activated_at DESC").
+		Find(&keys).Error; err != nil {
+		return nil, fmt.Errorf("failed to list signing keys: %w", err)
+	}
+	return keys, nil
+}
+
+func (r *SigningKeyRepository) ListAll(ctx context.Context) ([]types.SigningKey, error) {
+	var keys []types.SigningKey
+	if err := r.db.WithContext(ctx).Order("activated_at DESC").Find(&keys).Error; err != nil {
+		return nil, fmt.Errorf("failed to list signing keys: %w", err)
+	}
+	return keys, nil
+}
+
+func (r *SigningKeyRepository) ExistsByKID(ctx context.Context, kid string) (bool, error) {
+	var count int64
+	if err := r.db.WithContext(ctx).Model(&types.SigningKey{}).Where("kid = ?", kid).Count(&count).Error; err != nil {
+		return false, fmt.Errorf("failed to check signing key: %w", err)
+	}
+	return count > 0, nil
+}
+
+// UpdatePrivateKey replaces the stored key material, used to encrypt keys stored in plaintext
+func (r *SigningKeyRepository) UpdatePrivateKey(ctx context.Context, id uint, material []byte) error {
+	if err := r.db.WithContext(ctx).Model(&types.SigningKey{}).Where("id = ?", id).
+		Update("private_key", material).Error; err != nil {
+		return fmt.Errorf("failed to update signing key: %w", err)
+	}
+	return nil
+}
+
+// Promote makes key the active signing key and retires the previous one, keeping it valid until notAfter
+func (r *SigningKeyRepository) Promote(ctx context.Context, key *types.SigningKey, notAfter time.Time) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+		if err := tx.Model(&types.SigningKey{}).
+			Where("status = ?", types.SigningKeyStatusActive).
+			Updates(map[string]interface{}{
+				"status":     types.SigningKeyStatusRetired,
+				"retired_at": now,
+				"not_after":  notAfter,
+			}).Error; err != nil {
+			return fmt.Errorf("failed to retire signing key: %w", err)
+		}
+
+		key.Status = types.SigningKeyStatusActive
+		key.ActivatedAt = now
+		if err := tx.Create(key).Error; err != nil {
+			return fmt.Errorf("failed to create signing key: %w", err)
+		}
+		return nil
+	})
+}
@@ -0,0 +1,79 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/simple-auth-roles/internal/types"
+	"gorm.io/gorm"
+)
+
+type TokenRepository struct {
+	db *gorm.DB
+}
+
+func NewTokenRepository(db *gorm.DB) *TokenRepository {
+	return &TokenRepository{db: db}
+}
+
+func (r *TokenRepository) CreateRefreshToken(ctx context.Context, token *types.RefreshToken) error {
+	if err := r.db.WithContext(ctx).Create(token).Error; err != nil {
+		return fmt.Errorf("failed to create refresh token: %w", err)
+	}
+	return nil
+}
+
+func (r *TokenRepository) FindRefreshTokenByHash(ctx context.Context, hash string) (*types.RefreshToken, error) {
+	var token types.RefreshToken
+	if err := r.db.WithContext(ctx).Where("token_hash = ?", hash).First(&token).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to find refresh token: %w", err)
+	}
+	return &token, nil
+}
+
+// MarkRefreshTokenUsed marks the token as used and reports whether this call was the one that did it.
+// A false result means the token was already consumed by a concurrent request.
+func (r *TokenRepository) MarkRefreshTokenUsed(ctx context.Context, id uint) (bool, error) {
+	result := r.db.WithContext(ctx).Model(&types.RefreshToken{}).
+		Where("id = ? AND used_at IS NULL", id).
+		Update("used_at", time.Now())
+	if result.Error != nil {
+		return false, fmt.Errorf("failed to mark refresh token used: %w", result.Error)
+	}
+	return result.RowsAffected == 1, nil
+}
+
+// MarkFamilyUsed marks the user's live first-party refresh token in a family as used, reporting
+// false when the family has no live token, e.g. after logout or expiry
+func (r *TokenRepository) MarkFamilyUsed(ctx context.Context, userID uint, familyID string) (bool, error) {
+	now := time.Now()
+	result := r.db.WithContext(ctx).Model(&types.RefreshToken{}).
+		Where("user_id = ? AND family_id = ? AND (client_id = '' OR client_id IS NULL) AND used_at IS NULL AND revoked_at IS NULL AND expires_at > ?", userID, familyID, now).
+		Update("used_at", now)
+	if result.Error != nil {
+		return false, fmt.Errorf("failed to mark refresh token used: %w", result.Error)
+	}
+	return result.RowsAffected > 0, nil
+}
+
+func (r *TokenRepository) RevokeRefreshTokenFamily(ctx context.Context, familyID string) error {
+	if err := r.db.WithContext(ctx).Model(&types.RefreshToken{}).
+		Where("family_id = ? AND revoked_at IS NULL", familyID).
+		Update("revoked_at", time.Now()).Error; err != nil {
+		return fmt.Errorf("failed to revoke refresh token family: %w", err)
+	}
+	return nil
+}
+
+func (r *TokenRepository) RevokeAllRefreshTokensForUser(ctx context.Context, userID uint) error {
+	if err := r.db.WithContext(ctx).Model(&types.RefreshToken{}).
+		Where("user_id = ? AND revoked_at IS NULL", userID).
+		Update("revoked_at", time.Now()).Error; err != nil {
+		return fmt.Errorf("failed to revoke refresh tokens: %w", err)
+	}
+	return nil
+}
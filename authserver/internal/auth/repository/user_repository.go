@@ -3,7 +3,11 @@ package repository
 import (
 	"context"
 	"fmt"
+	"maps"
+	"slices"
+	"time"
 
+	"github.com/go-webauthn/webauthn/webauthn"
 	"github.com/simple-auth-roles/internal/types"
 	"gorm.io/gorm"
 )
@@ -16,11 +20,15 @@ func NewUserRepository(db *gorm.DB) *UserRepository {
 	return &UserRepository{db: db}
 }
 
-func (r *UserRepository) Create(ctx context.Context, user *types.User) error {
-	if err := r.db.WithContext(ctx).Create(user).Error; err != nil {
-		return fmt.Errorf("failed to create user: %w", err)
-	}
-	return nil
+// Create creates a user with their roles as permanent grants, recording the admin who granted
+// them when grantedBy is set
+func (r *UserRepository) Create(ctx context.Context, user *types.User, grantedBy *uint) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(user).Error; err != nil {
+			return fmt.Errorf("failed to create user: %w", err)
+		}
+		return grantRoles(tx, user.ID, user.Roles, nil, grantedBy)
+	})
 }
 
 func (r *UserRepository) FindByEmail(ctx context.Context, email string) (*types.User, error) {
@@ -31,6 +39,9 @@ func (r *UserRepository) FindByEmail(ctx context.Context, email string) (*types.
 		}
 		return nil, fmt.Errorf("failed to find user by email: %w", err)
 	}
+	if err := r.loadRoles(ctx, &user); err != nil {
+		return nil, err
+	}
 	return &user, nil
 }
 
@@ -42,6 +53,9 @@ func (r *UserRepository) FindByID(ctx context.Context, id uint) (*types.User, er
 		}
 		return nil, fmt.Errorf("failed to find user by ID: %w", err)
 	}
+	if err := r.loadRoles(ctx, &user); err != nil {
+		return nil, err
+	}
 	return &user, nil
 }
 
@@ -57,24 +71,178 @@ func (r *UserRepository) FindAll(ctx context.Context) ([]*types.User, error) {
 	if err := r.db.WithContext(ctx).Find(&users).Error; err != nil {
 		return nil, fmt.Errorf("failed to find all users: %w", err)
 	}
+	if err := r.loadRoles(ctx, users...); err != nil {
+		return nil, err
+	}
 	return users, nil
 }
 
+// FindByRole returns the users currently assigned role; users who only inherit it are not included
 func (r *UserRepository) FindByRole(ctx context.Context, role string) ([]*types.User, error) {
 	var users []*types.User
-	if err := r.db.WithContext(ctx).Where("role = ?", role).Find(&users).Error; err != nil {
+	if err := r.db.WithContext(ctx).
+		Where(`id IN (SELECT user_roles.user_id FROM user_roles JOIN roles ON roles.id = user_roles.role_id
+			WHERE roles.name = ? AND (user_roles.expires_at IS NULL OR user_roles.expires_at > ?))`, role, time.Now()).
+		Find(&users).Error; err != nil {
 		return nil, fmt.Errorf("failed to find users by role: %w", err)
 	}
+	if err := r.loadRoles(ctx, users...); err != nil {
+		return nil, err
+	}
 	return users, nil
 }
 
-func (r *UserRepository) Delete(ctx context.Context, id uint) error {
-	if err := r.db.WithContext(ctx).Delete(&types.User{}, id).Error; err != nil {
-		return fmt.Errorf("failed to delete user: %w", err)
+// SetRoles makes roles the user's only assignments, all permanent, reporting whether the user exists.
+// Time-boxed grants of the listed roles become permanent and grants of other roles are removed.
+func (r *UserRepository) SetRoles(ctx context.Context, userID uint, roles []string, grantedBy uint) (bool, error) {
+	found := false
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var count int64
+		if err := tx.Model(&types.User{}).Where("id = ?", userID).Count(&count).Error; err != nil {
+			return fmt.Errorf("failed to find user: %w", err)
+		}
+		if count == 0 {
+			return nil
+		}
+		found = true
+
+		if err := tx.Where("user_id = ? AND role_id NOT IN (SELECT id FROM roles WHERE name IN ?)", userID, roles).
+			Delete(&types.UserRole{}).Error; err != nil {
+			return fmt.Errorf("failed to clear user roles: %w", err)
+		}
+		return grantRoles(tx, userID, roles, nil, &grantedBy)
+	})
+	return found, err
+}
+
+// GrantRole assigns a role until expiresAt, or permanently when it is nil. A permanent assignment is
+// never shortened and of two time-boxed grants the later expiry is kept.
+func (r *UserRepository) GrantRole(ctx context.Context, userID uint, role string, expiresAt *time.Time, grantedBy uint) error {
+	return grantRoles(r.db.WithContext(ctx), userID, []string{role}, expiresAt, &grantedBy)
+}
+
+// RevokeRole removes a role assignment, reporting whether the user had it
+func (r *UserRepository) RevokeRole(ctx context.Context, userID uint, role string) (bool, error) {
+	result := r.db.WithContext(ctx).
+		Where("user_id = ? AND role_id = (SELECT id FROM roles WHERE name = ?)", userID, role).
+		Delete(&types.UserRole{})
+	if result.Error != nil {
+		return false, fmt.Errorf("failed to revoke role: %w", result.Error)
+	}
+	return result.RowsAffected > 0, nil
+}
+
+// ListRoleGrants returns the user's current role assignments with their expiry
+func (r *UserRepository) ListRoleGrants(ctx context.Context, userID uint) ([]types.RoleGrant, error) {
+	grants := []types.RoleGrant{}
+	if err := r.db.WithContext(ctx).Model(&types.UserRole{}).
+		Select("user_roles.user_id, roles.name AS role, user_roles.expires_at, user_roles.granted_by, user_roles.created_at").
+		Joins("JOIN roles ON roles.id = user_roles.role_id").
+		Where("user_roles.user_id = ? AND (user_roles.expires_at IS NULL OR user_roles.expires_at > ?)", userID, time.Now()).
+		Order("roles.name").
+		Scan(&grants).Error; err != nil {
+		return nil, fmt.Errorf("failed to list role grants: %w", err)
+	}
+	return grants, nil
+}
+
+// DeleteExpiredRoles removes the role grants that expired by now and returns them
+func (r *UserRepository) DeleteExpiredRoles(ctx context.Context, now time.Time) ([]types.RoleGrant, error) {
+	var grants []types.RoleGrant
+	if err := r.db.WithContext(ctx).Raw(`DELETE FROM user_roles USING roles
+		WHERE roles.id = user_roles.role_id AND user_roles.expires_at <= ?
+		RETURNING user_roles.user_id, roles.name AS role, user_roles.expires_at, user_roles.granted_by, user_roles.created_at`, now).
+		Scan(&grants).Error; err != nil {
+		return nil, fmt.Errorf("failed to delete expired roles: %w", err)
+	}
+	return grants, nil
+}
+
+// grantRoles assigns roles by name, see GrantRole for how existing assignments are merged; every role must exist
+func grantRoles(tx *gorm.DB, userID uint, names []string, expiresAt *time.Time, grantedBy *uint) error {
+	if len(names) == 0 {
+		return nil
+	}
+
+	result := tx.Exec(`INSERT INTO user_roles (user_id, role_id, expires_at, granted_by, created_at)
+		SELECT ?, id, ?, ?, ? FROM roles WHERE name IN ?
+		ON CONFLICT (user_id, role_id) DO UPDATE SET
+			expires_at = CASE WHEN user_roles.expires_at IS NULL OR EXCLUDED.expires_at IS NULL THEN NULL
+				ELSE GREATEST(user_roles.expires_at, EXCLUDED.expires_at) END,
+			granted_by = EXCLUDED.granted_by`, userID, expiresAt, grantedBy, time.Now(), names)
+	if result.Error != nil {
+		return fmt.Errorf("failed to assign roles: %w", result.Error)
+	}
+	if result.RowsAffected != int64(len(names)) {
+		return fmt.Errorf("unknown role in %v", names)
+	}
+	return nil
+}
+
+// loadRoles fills in the names of the roles assigned to each user, leaving out expired grants
+func (r *UserRepository) loadRoles(ctx context.Context, users ...*types.User) error {
+	if len(users) == 0 {
+		return nil
+	}
+
+	byID := make(map[uint]*types.User, len(users))
+	for _, user := range users {
+		user.Roles = []string{}
+		byID[user.ID] = user
+	}
+
+	var rows []struct {
+		UserID uint
+		Name   string
+	}
+	if err := r.db.WithContext(ctx).Model(&types.UserRole{}).
+		Select("user_roles.user_id, roles.name").
+		Joins("JOIN roles ON roles.id = user_roles.role_id").
+		Where("user_roles.user_id IN ? AND (user_roles.expires_at IS NULL OR user_roles.expires_at > ?)", slices.Collect(maps.Keys(byID)), time.Now()).
+		Order("roles.name").
+		Scan(&rows).Error; err != nil {
+		return fmt.Errorf("failed to load user roles: %w", err)
+	}
+	for _, row := range rows {
+		byID[row.UserID].Roles = append(byID[row.UserID].Roles, row.Name)
 	}
 	return nil
 }
 
+func (r *UserRepository) Delete(ctx context.Context, id uint) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ?", id).Delete(&types.UserRole{}).Error; err != nil {
+			return fmt.Errorf("failed to delete user roles: %w", err)
+		}
+		if err := tx.Where("user_id = ?", id).Delete(&types.OrgMembership{}).Error; err != nil {
+			return fmt.Errorf("failed to delete organization memberships: %w", err)
+		}
+		if err := tx.Delete(&types.User{}, id).Error; err != nil {
+			return fmt.Errorf("failed to delete user: %w", err)
+		}
+		return nil
+	})
+}
+
+// DeleteWithCredentials deletes a user with their role assignments, memberships and WebAuthn credentials
+func (r *UserRepository) DeleteWithCredentials(ctx context.Context, id uint) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ?", id).Delete(&types.UserRole{}).Error; err != nil {
+			return fmt.Errorf("failed to delete user roles: %w", err)
+		}
+		if err := tx.Where("user_id = ?", id).Delete(&types.OrgMembership{}).Error; err != nil {
+			return fmt.Errorf("failed to delete organization memberships: %w", err)
+		}
+		if err := tx.Where("user_id = ?", id).Delete(&types.WebAuthnCredential{}).Error; err != nil {
+			return fmt.Errorf("failed to delete webauthn credentials: %w", err)
+		}
+		if err := tx.Delete(&types.User{}, id).Error; err != nil {
+			return fmt.Errorf("failed to delete user: %w", err)
+		}
+		return nil
+	})
+}
+
 // GetByID is an alias for FindByID (for WebAuthn service)
 func (r *UserRepository) GetByID(ctx context.Context, id uint) (*types.User, error) {
 	return r.FindByID(ctx, id)
@@ -98,11 +266,48 @@ func (r *UserRepository) LoadWebAuthnCredentials(ctx context.Context, user *type
 	return nil
 }
 
-func (r *UserRepository) UpdateWebAuthnCredentialCounter(ctx context.Context, credentialID []byte, counter uint32) error {
+// UpdateWebAuthnCredentialAfterLogin stores the sign counter and flags reported by a login and where it came from
+func (r *UserRepository) UpdateWebAuthnCredentialAfterLogin(ctx context.Context, credentialID []byte, counter uint32, flags webauthn.CredentialFlags, meta types.RequestMeta) error {
 	if err := r.db.WithContext(ctx).Model(&types.WebAuthnCredential{}).
 		Where("credential_id = ?", credentialID).
-		Update("counter", counter).Error; err != nil {
-		return fmt.Errorf("failed to update credential counter: %w", err)
+		Updates(map[string]interface{}{
+			"counter":              counter,
+			"user_verified":        flags.UserVerified,
+			"backup_eligible":      flags.BackupEligible,
+			"backup_state":         flags.BackupState,
+			"last_used_at":         time.Now(),
+			"last_used_ip":         meta.IPAddress,
+			"last_used_user_agent": meta.UserAgent,
+		}).Error; err != nil {
+		return fmt.Errorf("failed to update credential: %w", err)
+	}
+	return nil
+}
+
+// FlagWebAuthnCredentialCloned marks a credential as possibly cloned, optionally disabling it
+func (r *UserRepository) FlagWebAuthnCredentialCloned(ctx context.Context, credentialID []byte, disable bool) error {
+	updates := map[string]interface{}{"clone_warning": true}
+	if disable {
+		updates["disabled_at"] = time.Now()
+	}
+	if err := r.db.WithContext(ctx).Model(&types.WebAuthnCredential{}).
+		Where("credential_id = ?", credentialID).
+		Updates(updates).Error; err != nil {
+		return fmt.Errorf("failed to flag credential: %w", err)
+	}
+	return nil
+}
+
+// ClearWebAuthnCredentialCloneWarning removes the clone flag from a user's credential and accepts
+// counter as its sign counter
+func (r *UserRepository) ClearWebAuthnCredentialCloneWarning(ctx context.Context, userID uint, credentialID []byte, counter uint32) error {
+	if err := r.db.WithContext(ctx).Model(&types.WebAuthnCredential{}).
+		Where("user_id = ? AND credential_id = ? AND disabled_at IS NULL", userID, credentialID).
+		Updates(map[string]interface{}{
+			"clone_warning": false,
+			"counter":       counter,
+		}).Error; err != nil {
+		return fmt.Errorf("failed to clear credential flag: %w", err)
 	}
 	return nil
 }
@@ -117,6 +322,28 @@ func (r *UserRepository) CountWebAuthnCredentials(ctx context.Context, userID ui
 	return count, nil
 }
 
+// SetPasskeyRequired sets whether the user must keep a passkey, reporting whether the user exists
+func (r *UserRepository) SetPasskeyRequired(ctx context.Context, userID uint, required bool) (bool, error) {
+	result := r.db.WithContext(ctx).Model(&types.User{}).
+		Where("id = ?", userID).
+		Update("passkey_required", required)
+	if result.Error != nil {
+		return false, fmt.Errorf("failed to update passkey requirement: %w", result.Error)
+	}
+	return result.RowsAffected == 1, nil
+}
+
+// RenameWebAuthnCredential renames one of the user's credentials, reporting whether it exists
+func (r *UserRepository) RenameWebAuthnCredential(ctx context.Context, userID uint, credentialID []byte, name string) (bool, error) {
+	result := r.db.WithContext(ctx).Model(&types.WebAuthnCredential{}).
+		Where("user_id = ? AND credential_id = ?", userID, credentialID).
+		Update("name", name)
+	if result.Error != nil {
+		return false, fmt.Errorf("failed to rename webauthn credential: %w", result.Error)
+	}
+	return result.RowsAffected == 1, nil
+}
+
 func (r *UserRepository) DeleteWebAuthnCredential(ctx context.Context, userID uint, credentialID []byte) error {
 	if err := r.db.WithContext(ctx).
 		Where("user_id = ? AND credential_id = ?", userID, credentialID).
@@ -0,0 +1,210 @@
+package service
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/webauthn"
+	"github.com/google/uuid"
+	"github.com/simple-auth-roles/internal/config"
+)
+
+// Registration error codes returned to clients
+const (
+	RegistrationErrorAuthenticatorNotAllowed = "authenticator_not_allowed" // The authenticator model is not allowed for the user's role
+	RegistrationErrorAttestationUntrusted    = "attestation_untrusted"     // The attestation does not chain to a trust anchor
+)
+
+// allRoles is the allowlist/denylist key that applies to every role
+const allRoles = "*"
+
+// RegistrationPolicyError explains why a new passkey was rejected
+type RegistrationPolicyError struct {
+	Code    string
+	Message string
+}
+
+func (e *RegistrationPolicyError) Error() string {
+	return e.Message
+}
+
+// attestationPolicy decides which authenticators may be registered
+type attestationPolicy struct {
+	trustAnchors *x509.CertPool // nil when attestation statements are not verified
+	allow        map[string]map[uuid.UUID]bool
+	deny         map[string]map[uuid.UUID]bool
+}
+
+func newAttestationPolicy(cfg config.WebAuthnConfig) (*attestationPolicy, error) {
+	allow, err := parseAAGUIDLists(cfg.AAGUIDAllowlist)
+	if err != nil {
+		return nil, fmt.Errorf("invalid WEBAUTHN_AAGUID_ALLOWLIST: %w", err)
+	}
+	deny, err := parseAAGUIDLists(cfg.AAGUIDDenylist)
+	if err != nil {
+		return nil, fmt.Errorf("invalid WEBAUTHN_AAGUID_DENYLIST: %w", err)
+	}
+
+	policy := &attestationPolicy{allow: allow, deny: deny}
+	if cfg.AttestationTrustAnchorsFile != "" {
+		if policy.trustAnchors, err = loadTrustAnchors(cfg.AttestationTrustAnchorsFile); err != nil {
+			return nil, err
+		}
+	}
+	return policy, nil
+}
+
+func parseAAGUIDLists(lists map[string][]string) (map[string]map[uuid.UUID]bool, error) {
+	parsed := make(map[string]map[uuid.UUID]bool, len(lists))
+	for role, values := range lists {
+		set := make(map[uuid.UUID]bool, len(values))
+		for _, value := range values {
+			aaguid, err := uuid.Parse(strings.TrimSpace(value))
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", value, err)
+			}
+			set[aaguid] = true
+		}
+		parsed[role] = set
+	}
+	return parsed, nil
+}
+
+// loadTrustAnchors reads a PEM bundle of root certificates
+func loadTrustAnchors(path string) (*x509.CertPool, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+
+	pool := x509.NewCertPool()
+	count := 0
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse certificate in %s: %w", path, err)
+		}
+		pool.AddCert(cert)
+		count++
+	}
+	if count == 0 {
+		return nil, fmt.Errorf("no certificates in %s", path)
+	}
+	return pool, nil
+}
+
+// check rejects a credential that any of roles may not register. name describes the authenticator in errors.
+func (p *attestationPolicy) check(roles []string, credential *webauthn.Credential, attestation protocol.AttestationObject, name string) error {
+	aaguid, err := uuid.FromBytes(credential.Authenticator.AAGUID)
+	if err != nil {
+		aaguid = uuid.Nil
+	}
+
+	if p.deny[allRoles][aaguid] || slices.ContainsFunc(roles, func(role string) bool { return p.deny[role][aaguid] }) {
+		return &RegistrationPolicyError{
+			Code:    RegistrationErrorAuthenticatorNotAllowed,
+			Message: fmt.Sprintf("%s can't be used as a passkey on this account", name),
+		}
+	}
+
+	// Every role with an allowlist must allow the model; the "*" list applies when none of them has one
+	restrictedBy := ""
+	for _, role := range roles {
+		if allowed, ok := p.allow[role]; ok {
+			restrictedBy = role
+			if !allowed[aaguid] {
+				break
+			}
+		}
+	}
+	if restrictedBy == "" {
+		if _, ok := p.allow[allRoles]; ok {
+			restrictedBy = allRoles
+		}
+	}
+	if restrictedBy != "" && !p.allow[restrictedBy][aaguid] {
+		return &RegistrationPolicyError{
+			Code:    RegistrationErrorAuthenticatorNotAllowed,
+			Message: fmt.Sprintf("%s is not approved, %s must use an approved security key", name, restrictedAccounts(restrictedBy)),
+		}
+	}
+
+	// The AAGUID is self-reported unless the attestation proves it, so with trust anchors
+	// configured every passkey must chain to one, allowlisted or not
+	if p.trustAnchors == nil {
+		return nil
+	}
+	if restrictedBy == "" {
+		restrictedBy = allRoles
+	}
+	chain, err := attestationChain(attestation)
+	if err != nil || len(chain) == 0 {
+		return &RegistrationPolicyError{
+			Code:    RegistrationErrorAttestationUntrusted,
+			Message: fmt.Sprintf("%s must use a security key with verifiable attestation", restrictedAccounts(restrictedBy)),
+		}
+	}
+	if err := p.verifyChain(chain); err != nil {
+		return &RegistrationPolicyError{
+			Code:    RegistrationErrorAttestationUntrusted,
+			Message: fmt.Sprintf("%s could not prove it was made by a trusted manufacturer", name),
+		}
+	}
+	return nil
+}
+
+// restrictedAccounts names the accounts an allowlist applies to, for error messages
+func restrictedAccounts(role string) string {
+	if role == allRoles {
+		return "accounts on this server"
+	}
+	return fmt.Sprintf("accounts with the %s role", role)
+}
+
+// attestationChain returns the x5c certificates of an attestation statement, leaf first
+func attestationChain(attestation protocol.AttestationObject) ([]*x509.Certificate, error) {
+	x5c, ok := attestation.AttStatement["x5c"].([]any)
+	if !ok {
+		return nil, nil
+	}
+
+	chain := make([]*x509.Certificate, 0, len(x5c))
+	for _, raw := range x5c {
+		der, ok := raw.([]byte)
+		if !ok {
+			return nil, fmt.Errorf("invalid attestation certificate")
+		}
+		cert, err := x509.ParseCertificate(der)
+		if err != nil {
+			return nil, fmt.Errorf("invalid attestation certificate: %w", err)
+		}
+		chain = append(chain, cert)
+	}
+	return chain, nil
+}
+
+func (p *attestationPolicy) verifyChain(chain []*x509.Certificate) error {
+	intermediates := x509.NewCertPool()
+	for _, cert := range chain[1:] {
+		intermediates.AddCert(cert)
+	}
+	_, err := chain[0].Verify(x509.VerifyOptions{
+		Roots:         p.trustAnchors,
+		Intermediates: intermediates,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+	})
+	return err
+}
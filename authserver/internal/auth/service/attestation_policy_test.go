@@ -0,0 +1,135 @@
+package service
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/webauthn"
+	"github.com/google/uuid"
+)
+
+// testCertificate creates a certificate signed by parent, or a self-signed CA when parent is nil
+func testCertificate(t *testing.T, name string, parent *x509.Certificate, parentKey *ecdsa.PrivateKey) (*x509.Certificate, *ecdsa.PrivateKey) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	if parent == nil {
+		template.IsCA = true
+		template.BasicConstraintsValid = true
+		template.KeyUsage = x509.KeyUsageCertSign
+		parent, parentKey = template, key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, parentKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert, key
+}
+
+func TestAttestationPolicyCheck(t *testing.T) {
+	yubiKey := uuid.MustParse("cb69481e-8ff7-4039-93ec-0a2729a154a8")
+	titan := uuid.MustParse("ee882879-721c-4913-9775-3dfcce97072a")
+	synced := uuid.MustParse("fbfc3007-154e-4ecc-8c0b-6e020557d7bd")
+
+	root, rootKey := testCertificate(t, "Trusted root", nil, nil)
+	leaf, _ := testCertificate(t, "Trusted authenticator", root, rootKey)
+	otherRoot, otherKey := testCertificate(t, "Other root", nil, nil)
+	untrustedLeaf, _ := testCertificate(t, "Untrusted authenticator", otherRoot, otherKey)
+	anchors := x509.NewCertPool()
+	anchors.AddCert(root)
+
+	trusted := protocol.AttestationObject{AttStatement: map[string]any{"x5c": []any{leaf.Raw}}}
+	untrusted := protocol.AttestationObject{AttStatement: map[string]any{"x5c": []any{untrustedLeaf.Raw}}}
+	malformed := protocol.AttestationObject{AttStatement: map[string]any{"x5c": []any{[]byte("not a certificate")}}}
+	none := protocol.AttestationObject{}
+
+	adminOnlyYubiKey := map[string]map[uuid.UUID]bool{"admin": {yubiKey: true}}
+
+	tests := []struct {
+		name        string
+		allow       map[string]map[uuid.UUID]bool
+		deny        map[string]map[uuid.UUID]bool
+		anchors     *x509.CertPool
+		roles       []string
+		aaguid      uuid.UUID
+		attestation protocol.AttestationObject
+		wantCode    string // Empty when the registration is allowed
+	}{
+		{name: "no policy", roles: []string{"user"}, aaguid: synced},
+		{name: "denied for every role", deny: map[string]map[uuid.UUID]bool{allRoles: {uuid.Nil: true}}, roles: []string{"user"}, aaguid: uuid.Nil, wantCode: RegistrationErrorAuthenticatorNotAllowed},
+		{name: "denied for one of the roles", deny: map[string]map[uuid.UUID]bool{"billing": {synced: true}}, roles: []string{"user", "billing"}, aaguid: synced, wantCode: RegistrationErrorAuthenticatorNotAllowed},
+		{name: "denied for another role", deny: map[string]map[uuid.UUID]bool{"billing": {synced: true}}, roles: []string{"user"}, aaguid: synced},
+		{name: "allowlisted model", allow: adminOnlyYubiKey, roles: []string{"admin", "user"}, aaguid: yubiKey},
+		{name: "model not on the role's allowlist", allow: adminOnlyYubiKey, roles: []string{"admin", "user"}, aaguid: synced, wantCode: RegistrationErrorAuthenticatorNotAllowed},
+		{name: "role without an allowlist", allow: adminOnlyYubiKey, roles: []string{"user"}, aaguid: synced},
+		{
+			name:     "model allowed by only one of two roles",
+			allow:    map[string]map[uuid.UUID]bool{"admin": {yubiKey: true, titan: true}, "billing": {titan: true}},
+			roles:    []string{"admin", "billing"},
+			aaguid:   yubiKey,
+			wantCode: RegistrationErrorAuthenticatorNotAllowed,
+		},
+		{
+			name:   "role allowlist replaces the * list",
+			allow:  map[string]map[uuid.UUID]bool{allRoles: {synced: true}, "admin": {yubiKey: true}},
+			roles:  []string{"admin"},
+			aaguid: yubiKey,
+		},
+		{
+			name:     "* list applies to unlisted roles",
+			allow:    map[string]map[uuid.UUID]bool{allRoles: {yubiKey: true}},
+			roles:    []string{"user"},
+			aaguid:   synced,
+			wantCode: RegistrationErrorAuthenticatorNotAllowed,
+		},
+		{name: "allowlisted with trusted attestation", allow: adminOnlyYubiKey, anchors: anchors, roles: []string{"admin"}, aaguid: yubiKey, attestation: trusted},
+		{name: "allowlisted without attestation", allow: adminOnlyYubiKey, anchors: anchors, roles: []string{"admin"}, aaguid: yubiKey, attestation: none, wantCode: RegistrationErrorAttestationUntrusted},
+		{name: "allowlisted with untrusted attestation", allow: adminOnlyYubiKey, anchors: anchors, roles: []string{"admin"}, aaguid: yubiKey, attestation: untrusted, wantCode: RegistrationErrorAttestationUntrusted},
+		{name: "malformed attestation certificate", anchors: anchors, roles: []string{"user"}, aaguid: yubiKey, attestation: malformed, wantCode: RegistrationErrorAttestationUntrusted},
+		{name: "anchors without allowlist, trusted", anchors: anchors, roles: []string{"user"}, aaguid: synced, attestation: trusted},
+		{name: "anchors without allowlist, no attestation", anchors: anchors, roles: []string{"user"}, aaguid: synced, attestation: none, wantCode: RegistrationErrorAttestationUntrusted},
+		{name: "anchors with unlisted role, untrusted", allow: adminOnlyYubiKey, anchors: anchors, roles: []string{"user"}, aaguid: synced, attestation: untrusted, wantCode: RegistrationErrorAttestationUntrusted},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			policy := &attestationPolicy{trustAnchors: tt.anchors, allow: tt.allow, deny: tt.deny}
+			credential := &webauthn.Credential{Authenticator: webauthn.Authenticator{AAGUID: tt.aaguid[:]}}
+
+			err := policy.check(tt.roles, credential, tt.attestation, "Test key")
+			if tt.wantCode == "" {
+				if err != nil {
+					t.Fatalf("check() error = %v", err)
+				}
+				return
+			}
+			var policyErr *RegistrationPolicyError
+			if !errors.As(err, &policyErr) {
+				t.Fatalf("check() error = %v, want a RegistrationPolicyError", err)
+			}
+			if policyErr.Code != tt.wantCode {
+				t.Errorf("check() code = %q, want %q", policyErr.Code, tt.wantCode)
+			}
+		})
+	}
+}
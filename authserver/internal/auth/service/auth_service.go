@@ -2,10 +2,15 @@ package service
 
 import (
 	"context"
+	"crypto/hmac"
 	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
 	"encoding/base32"
+	"encoding/hex"
 	"fmt"
 	"log/slog"
+	"strconv"
 	"strings"
 	"time"
 
@@ -15,29 +20,46 @@ import (
 	"github.com/simple-auth-roles/internal/types"
 	"github.com/simple-auth-roles/pkg/cache"
 	"github.com/simple-auth-roles/pkg/email"
+	"github.com/simple-auth-roles/pkg/signing"
 )
 
 type AuthService struct {
-	userRepo        *repository.UserRepository
-	cacheService    cache.CacheService
-	emailService    email.EmailService
-	logger          *slog.Logger
-	jwtSecret       string
-	jwtExpiry       time.Duration
-	webauthnService *WebAuthnService
+	userRepo            *repository.UserRepository
+	tokenRepo           *repository.TokenRepository
+	cacheService        cache.CacheService
+	emailService        email.EmailService
+	logger              *slog.Logger
+	keyRing             *KeyRing
+	issuer              string
+	jwtExpiry           time.Duration
+	refreshExpiry       time.Duration
+	mobileRefreshExpiry time.Duration
+	login               config.LoginConfig
+	codeHMACKey         []byte
+	webauthnService     *WebAuthnService
+	roles               *RoleService
+	orgs                *OrgService
 }
 
-func NewAuthService(userRepo *repository.UserRepository, cacheService cache.CacheService, emailService email.EmailService, logger *slog.Logger, cfg *config.Config) *AuthService {
-	webAuthnService := NewWebAuthnService(userRepo, cacheService, logger, cfg)
+func NewAuthService(userRepo *repository.UserRepository, tokenRepo *repository.TokenRepository, securityEventRepo *repository.SecurityEventRepository, cacheService cache.CacheService, emailService email.EmailService, keyRing *KeyRing, roles *RoleService, orgs *OrgService, logger *slog.Logger, cfg *config.Config) *AuthService {
+	webAuthnService := NewWebAuthnService(userRepo, securityEventRepo, roles, cacheService, emailService, logger, cfg)
 
 	return &AuthService{
-		userRepo:        userRepo,
-		cacheService:    cacheService,
-		emailService:    emailService,
-		logger:          logger.With("service", "auth"),
-		jwtSecret:       cfg.JWT.Secret,
-		jwtExpiry:       cfg.JWT.Expiration,
-		webauthnService: webAuthnService,
+		userRepo:            userRepo,
+		tokenRepo:           tokenRepo,
+		cacheService:        cacheService,
+		emailService:        emailService,
+		logger:              logger.With("service", "auth"),
+		keyRing:             keyRing,
+		issuer:              cfg.OIDC.Issuer,
+		jwtExpiry:           cfg.JWT.Expiration,
+		refreshExpiry:       cfg.JWT.RefreshExpiration,
+		mobileRefreshExpiry: cfg.JWT.MobileRefreshExpiration,
+		login:               cfg.Login,
+		codeHMACKey:         []byte(cfg.Login.CodeHMACKey),
+		webauthnService:     webAuthnService,
+		roles:               roles,
+		orgs:                orgs,
 	}
 }
 
@@ -45,67 +67,170 @@ func (s *AuthService) WebAuthnService() *WebAuthnService {
 	return s.webauthnService
 }
 
+func (s *AuthService) Roles() *RoleService {
+	return s.roles
+}
+
+func (s *AuthService) Orgs() *OrgService {
+	return s.orgs
+}
+
 func (s *AuthService) UserRepository() *repository.UserRepository {
 	return s.userRepo
 }
 
-// SendLoginCode creates user if needed and generates a login code
-func (s *AuthService) SendLoginCode(ctx context.Context, email string, name string) error {
+func (s *AuthService) KeyRing() *KeyRing {
+	return s.keyRing
+}
+
+// JWKS returns the public keys that verify tokens issued by this service
+func (s *AuthService) JWKS() signing.JWKSet {
+	return s.keyRing.Keys().PublicJWKS()
+}
+
+// SendLoginCode creates user if needed (and allowed) and emails a login code, magic link and approval link.
+// The returned nonce must be sent back with the code to verify it.
+func (s *AuthService) SendLoginCode(ctx context.Context, email, name, origin string, meta types.RequestMeta) (*types.LoginChallenge, error) {
+	// A locked out email gets no new codes until the lockout ends
+	if err := s.checkLoginLockout(ctx, email, ""); err != nil {
+		return nil, err
+	}
+
 	user, err := s.userRepo.FindByEmail(ctx, email)
 	if err != nil {
-		return fmt.Errorf("failed to find user: %w", err)
+		return nil, fmt.Errorf("failed to find user: %w", err)
 	}
 
-	// Create user if not found
+	// Create user if not found; invite-only deployments only create invited users. Uninvited
+	// emails go through the same steps without an email, so the response doesn't reveal which
+	// addresses have accounts.
+	sendEmail := true
 	if user == nil {
-		user = &types.User{
-			Email:    email,
-			Name:     name,           // Use provided name for new users
-			Role:     types.RoleUser, // Default role
-			IsActive: true,
+		invited := s.login.OpenSignup
+		if !invited {
+			if invited, err = s.orgs.HasPendingInvitation(ctx, email); err != nil {
+				return nil, fmt.Errorf("failed to check invitations: %w", err)
+			}
 		}
-		if err := s.userRepo.Create(ctx, user); err != nil {
-			return fmt.Errorf("failed to create user: %w", err)
+		if invited {
+			user = &types.User{
+				Email:    email,
+				Name:     name,                     // Use provided name for new users
+				Roles:    []string{types.RoleUser}, // Default role
+				IsActive: true,
+			}
+			if err := s.userRepo.Create(ctx, user, nil); err != nil {
+				return nil, fmt.Errorf("failed to create user: %w", err)
+			}
+		} else {
+			s.logger.Warn("Login code requested for an uninvited email, not sending", "email", email)
+			sendEmail = false
 		}
 	}
 
 	// Generate magic link code
 	code := s.generateCode()
+	nonce, err := randomToken(16)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate nonce: %w", err)
+	}
+	linkID, err := randomToken(16)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate link ID: %w", err)
+	}
+	link, err := s.magicLinkURL(email, linkID, origin)
+	if err != nil {
+		return nil, err
+	}
+	pending, approveLink, err := s.createPendingLogin(ctx, email, meta)
+	if err != nil {
+		return nil, err
+	}
 
-	// Store code in cache with 10 minute expiration
-	cacheKey := fmt.Sprintf("login_code:%s", strings.ToLower(email))
-	if err := s.cacheService.Set(ctx, cacheKey, code, 10*time.Minute); err != nil {
+	// Store only a MAC of the code. Wrong guesses keep counting across new codes, so
+	// requesting another code doesn't reset the email's attempts; only a sign-in does.
+	record := loginCodeRecord{
+		CodeMAC:        s.loginCodeMAC(email, nonce, code),
+		LinkID:         linkID,
+		PendingLoginID: pending.ID,
+	}
+	if err := s.storeLoginCode(ctx, email, record); err != nil {
 		s.logger.Error("Failed to store login code", "error", err, "email", email)
-		return fmt.Errorf("failed to store login code: %w", err)
+		return nil, fmt.Errorf("failed to store login code: %w", err)
 	}
 
-	// Send email with magic link code
-	if err := s.emailService.SendLoginCodeEmail(ctx, email, code); err != nil {
-		s.logger.Error("Failed to send login code email", "error", err, "email", email)
-		return fmt.Errorf("failed to send login code email: %w", err)
+	// Send email with magic link code. The send is queued for uninvited emails too and never
+	// awaited, so the response time doesn't reveal whether an email was sent.
+	go s.sendLoginCodeEmail(context.WithoutCancel(ctx), email, loginCodeEmail(code, link, approveLink, meta), sendEmail)
+	return &types.LoginChallenge{
+		Nonce:          nonce,
+		PendingLoginID: pending.ID,
+		ExpiresAt:      pending.ExpiresAt,
+	}, nil
+}
+
+// emailSendTimeout bounds a login code email sent after the request has returned
+const emailSendTimeout = 30 * time.Second
+
+// sendLoginCodeEmail sends a login code in the background; send is false for uninvited emails
+func (s *AuthService) sendLoginCodeEmail(ctx context.Context, to string, msg email.LoginCodeEmail, send bool) {
+	if !send {
+		return
+	}
+	ctx, cancel := context.WithTimeout(ctx, emailSendTimeout)
+	defer cancel()
+	if err := s.emailService.SendLoginCodeEmail(ctx, to, msg); err != nil {
+		s.logger.Error("Failed to send login code email", "error", err, "email", to)
+		return
 	}
+	s.logger.Info("Login code sent", "email", to)
+}
 
-	s.logger.Info("Login code sent", "email", email)
-	return nil
+// VerifyLoginCode verifies the login code and returns a JWT token with a refresh token
+func (s *AuthService) VerifyLoginCode(ctx context.Context, email, nonce, code string, meta types.RequestMeta) (*types.AuthResponse, error) {
+	record, err := s.checkAndUseLoginCode(ctx, email, nonce, code, meta)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.completeEmailLogin(ctx, email, record.PendingLoginID, meta)
 }
 
-// VerifyLoginCode verifies the login code and returns a JWT token
-func (s *AuthService) VerifyLoginCode(ctx context.Context, email, code string) (*types.AuthResponse, error) {
+// checkAndUseLoginCode verifies a code against the one sent to the email, counting wrong
+// guesses, and uses it up so it can't be verified again
+func (s *AuthService) checkAndUseLoginCode(ctx context.Context, email, nonce, code string, meta types.RequestMeta) (*loginCodeRecord, error) {
+	expired := &LoginCodeError{Code: LoginErrorCodeExpired, Message: "Code expired or not found, request a new code"}
+
+	if err := s.checkLoginLockout(ctx, email, meta.IPAddress); err != nil {
+		return nil, err
+	}
+
 	// Verify code from cache
-	cacheKey := fmt.Sprintf("login_code:%s", strings.ToLower(email))
-	storedCode, err := s.cacheService.Get(ctx, cacheKey)
-	if err != nil || storedCode == "" {
+	record, err := s.loadLoginCode(ctx, email)
+	if err != nil || record == nil {
 		s.logger.Warn("Login code not found or expired", "email", email)
-		return nil, fmt.Errorf("code expired or not found")
+		return nil, expired
+	}
+
+	// A code sent with the nonce of another request fails like a wrong code
+	if subtle.ConstantTimeCompare([]byte(s.loginCodeMAC(email, nonce, code)), []byte(record.CodeMAC)) != 1 {
+		s.logger.Warn("Invalid login code provided", "email", email, "ip", meta.IPAddress)
+		return nil, s.recordFailedLoginAttempt(ctx, email, meta.IPAddress)
 	}
 
-	if storedCode != code {
-		s.logger.Warn("Invalid login code provided", "email", email)
-		return nil, fmt.Errorf("invalid code")
+	if used, err := s.useLoginCode(ctx, email, record); err != nil {
+		return nil, err
+	} else if !used {
+		s.logger.Warn("Login code used by a concurrent request", "email", email)
+		return nil, expired
 	}
+	return record, nil
+}
 
-	// Delete the used code
-	_ = s.cacheService.Delete(ctx, cacheKey)
+// completeEmailLogin signs the user in once the code, link or approval of a pending login has
+// been used up
+func (s *AuthService) completeEmailLogin(ctx context.Context, email, pendingLoginID string, meta types.RequestMeta) (*types.AuthResponse, error) {
+	s.clearLoginAttempts(ctx, email)
 
 	user, err := s.userRepo.FindByEmail(ctx, email)
 	if err != nil {
@@ -115,71 +240,70 @@ func (s *AuthService) VerifyLoginCode(ctx context.Context, email, code string) (
 		return nil, fmt.Errorf("user not found")
 	}
 
-	// Generate JWT token
-	token, err := s.generateJWT(user)
+	meta.AMR = []string{types.AMREmailCode}
+	response, err := s.CreateSession(ctx, user, meta)
 	if err != nil {
-		return nil, fmt.Errorf("failed to generate token: %w", err)
+		return nil, err
 	}
 
 	s.logger.Info("User authenticated successfully", "email", email, "user_id", user.ID)
+	s.completePasskeyStepUp(ctx, pendingLoginID, user, meta)
 
-	return &types.AuthResponse{
-		User:    user,
-		Token:   token,
-		Message: "Authentication successful",
-	}, nil
+	return response, nil
 }
 
-// ValidateToken validates a JWT token and returns the user
-func (s *AuthService) ValidateToken(tokenString string) (*types.User, error) {
-	token, err := jwt.ParseWithClaims(tokenString, &jwt.MapClaims{}, func(token *jwt.Token) (interface{}, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+// ValidateToken validates a JWT token and returns the user with the token claims
+func (s *AuthService) ValidateToken(ctx context.Context, tokenString string) (*types.User, *types.JWTClaims, error) {
+	claims := &types.JWTClaims{}
+	token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		if kid == "" {
+			return nil, fmt.Errorf("token has no key ID")
+		}
+		key, err := s.keyRing.Lookup(ctx, kid)
+		if err != nil {
+			return nil, err
+		}
+		if token.Method.Alg() != key.Algorithm {
 			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
 		}
-		return []byte(s.jwtSecret), nil
-	})
+		return key.VerificationKey(), nil
+	}, jwt.WithValidMethods(s.keyRing.Keys().Algorithms()))
 
 	if err != nil {
-		return nil, fmt.Errorf("invalid token: %w", err)
+		return nil, nil, fmt.Errorf("invalid token: %w", err)
 	}
 
-	if claims, ok := token.Claims.(*jwt.MapClaims); ok && token.Valid {
-		userID := uint((*claims)["user_id"].(float64))
-		user, err := s.userRepo.FindByID(context.Background(), userID)
-		if err != nil {
-			return nil, fmt.Errorf("failed to find user: %w", err)
-		}
-		return user, nil
+	if !token.Valid {
+		return nil, nil, fmt.Errorf("invalid token claims")
 	}
 
-	return nil, fmt.Errorf("invalid token claims")
-}
-
-// GetAllUsers returns all users (admin only)
-func (s *AuthService) GetAllUsers(ctx context.Context) ([]*types.User, error) {
-	return s.userRepo.FindAll(ctx)
-}
-
-// UpdateUserRole updates a user's role (admin only)
-func (s *AuthService) UpdateUserRole(ctx context.Context, userID uint, role string) error {
-	if !types.ValidateRole(role) {
-		return fmt.Errorf("invalid role: %s", role)
+	revoked, err := s.isTokenRevoked(ctx, claims)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to check token revocation: %w", err)
+	}
+	if revoked {
+		return nil, nil, ErrTokenRevoked
 	}
 
-	user, err := s.userRepo.FindByID(ctx, userID)
+	user, err := s.userRepo.FindByID(ctx, claims.UserID)
 	if err != nil {
-		return fmt.Errorf("failed to find user: %w", err)
+		return nil, nil, fmt.Errorf("failed to find user: %w", err)
 	}
 	if user == nil {
-		return fmt.Errorf("user not found")
+		return nil, nil, fmt.Errorf("user not found")
 	}
+	return user, claims, nil
+}
 
-	user.Role = role
-	return s.userRepo.Update(ctx, user)
+// GetAllUsers returns all users (admin only)
+func (s *AuthService) GetAllUsers(ctx context.Context) ([]*types.User, error) {
+	return s.userRepo.FindAll(ctx)
 }
 
-// CreateUser creates a new user with specified role (admin only)
-func (s *AuthService) CreateUser(ctx context.Context, req *types.CreateUserRequest) (*types.User, error) {
+// CreateUser creates a new user with specified roles (admin only). Each role is written to the
+// new user's security events as granted by the actor.
+func (s *AuthService) CreateUser(ctx context.Context, actorID uint, req *types.CreateUserRequest, meta types.RequestMeta) (*types.User, error) {
 	// Check if user already exists
 	existing, err := s.userRepo.FindByEmail(ctx, req.Email)
 	if err != nil {
@@ -190,46 +314,104 @@ func (s *AuthService) CreateUser(ctx context.Context, req *types.CreateUserReque
 	}
 
 	// Set default role if not provided
-	role := req.Role
-	if role == "" {
-		role = types.RoleUser
+	roles := req.Roles
+	if len(roles) == 0 && req.Role != "" {
+		roles = []string{req.Role}
+	}
+	if len(roles) == 0 {
+		roles = []string{types.RoleUser}
 	}
-	if !types.ValidateRole(role) {
-		return nil, fmt.Errorf("invalid role: %s", role)
+	roles, err = s.roles.ValidateRoles(ctx, roles)
+	if err != nil {
+		return nil, err
 	}
 
 	user := &types.User{
 		Email:    req.Email,
 		Name:     req.Name,
 		Company:  req.Company,
-		Role:     role,
+		Roles:    roles,
 		IsActive: true,
 	}
 
-	if err := s.userRepo.Create(ctx, user); err != nil {
+	if err := s.userRepo.Create(ctx, user, &actorID); err != nil {
 		return nil, fmt.Errorf("failed to create user: %w", err)
 	}
 
+	for _, role := range roles {
+		s.roles.audit(ctx, user.ID, types.SecurityEventRoleGranted, map[string]any{"role": role, "granted_by": actorID}, meta)
+	}
+	s.logger.Info("User created", "user_id", user.ID, "roles", roles, "actor_id", actorID)
 	return user, nil
 }
 
 // GenerateJWT creates a JWT token for the user (public method)
 func (s *AuthService) GenerateJWT(user *types.User) (string, error) {
-	return s.generateJWT(user)
+	return s.generateJWT(user, nil)
 }
 
-// generateJWT creates a JWT token for the user
-func (s *AuthService) generateJWT(user *types.User) (string, error) {
-	claims := jwt.MapClaims{
-		"user_id": user.ID,
-		"email":   user.Email,
-		"role":    user.Role,
-		"exp":     time.Now().Add(s.jwtExpiry).Unix(),
-		"iat":     time.Now().Unix(),
+// generateJWT creates a JWT token for the user, tied to the refresh token session when one is given
+func (s *AuthService) generateJWT(user *types.User, session *types.RefreshToken) (string, error) {
+	jti, err := randomToken(16)
+	if err != nil {
+		return "", fmt.Errorf("failed to generate token ID: %w", err)
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString([]byte(s.jwtSecret))
+	now := time.Now()
+	roles := s.roles.EffectiveRoles(user.Roles)
+	claims := types.JWTClaims{
+		UserID: user.ID,
+		Email:  user.Email,
+		Roles:  roles,
+		Role:   types.LegacyRole(roles),
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        jti,
+			Issuer:    s.issuer,
+			Subject:   strconv.FormatUint(uint64(user.ID), 10),
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(s.jwtExpiry)),
+		},
+	}
+	if session != nil {
+		claims.SessionID = session.FamilyID
+		claims.Scope = session.Scope
+		claims.AMR = session.AMR
+		claims.OrgID = session.OrgID
+		if !session.AuthTime.IsZero() {
+			claims.AuthTime = jwt.NewNumericDate(session.AuthTime)
+		}
+		if session.ClientID != "" {
+			claims.Audience = jwt.ClaimStrings{session.ClientID}
+		}
+	}
+
+	return s.signToken(claims)
+}
+
+// signToken signs claims with the active key and sets the kid header
+func (s *AuthService) signToken(claims jwt.Claims) (string, error) {
+	key := s.keyRing.Keys().Active()
+	token := jwt.NewWithClaims(key.SigningMethod(), claims)
+	token.Header["kid"] = key.ID
+	return token.SignedString(key.SigningKey())
+}
+
+// loginCodeMAC binds a login code to the email and the send-code request that created it
+func (s *AuthService) loginCodeMAC(email, nonce, code string) string {
+	mac := hmac.New(sha256.New, s.codeHMACKey)
+	mac.Write([]byte(strings.ToLower(email) + "\x00" + nonce + "\x00" + strings.ToUpper(strings.TrimSpace(code))))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// loginCodeEmail collects what the login email shows
+func loginCodeEmail(code, magicLink, approveLink string, meta types.RequestMeta) email.LoginCodeEmail {
+	return email.LoginCodeEmail{
+		Code:        code,
+		MagicLink:   magicLink,
+		ApproveLink: approveLink,
+		IPAddress:   meta.IPAddress,
+		UserAgent:   meta.UserAgent,
+	}
 }
 
 // generateCode creates a random 6-character code
@@ -0,0 +1,167 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/simple-auth-roles/internal/types"
+	"github.com/simple-auth-roles/pkg/email"
+)
+
+// What happens when a passkey's sign counter goes backwards
+const (
+	CloneActionAllow   = "allow"   // Sign in anyway; the user is still alerted
+	CloneActionStepUp  = "step_up" // Require an email code for every sign-in with the passkey
+	CloneActionDisable = "disable" // Disable the passkey
+)
+
+// Passkey login error codes returned to clients
+const (
+	PasskeyErrorDisabled       = "passkey_disabled" // Sign in another way
+	PasskeyErrorStepUpRequired = "step_up_required" // Finish signing in with an emailed code
+)
+
+// PasskeyLoginError explains why a verified passkey could not be used to sign in
+type PasskeyLoginError struct {
+	Code    string
+	Message string
+	User    *types.User // Set for step_up_required so a code can be sent
+
+	// The flagged passkey and the sign counter it asserted, cleared once the step-up succeeds
+	CredentialID []byte
+	Counter      uint32
+}
+
+// stepUpRequired asks for an emailed code to confirm a sign-in with a flagged passkey
+func stepUpRequired(user *types.User, cred *types.WebAuthnCredential, counter uint32) *PasskeyLoginError {
+	return &PasskeyLoginError{
+		Code:         PasskeyErrorStepUpRequired,
+		Message:      "Confirm this sign-in with the code sent to your email",
+		User:         user,
+		CredentialID: cred.CredentialID,
+		Counter:      counter,
+	}
+}
+
+// passkeyStepUp is the flagged passkey behind a step-up code, kept under the code's pending login
+type passkeyStepUp struct {
+	UserID       uint   `json:"user_id"`
+	CredentialID []byte `json:"credential_id"`
+	Counter      uint32 `json:"counter"`
+}
+
+// SendPasskeyStepUpCode emails a login code to confirm a sign-in with a flagged passkey. Signing
+// in with that code, its link or its approval clears the flag and resyncs the sign counter.
+func (s *AuthService) SendPasskeyStepUpCode(ctx context.Context, passkeyErr *PasskeyLoginError, origin string, meta types.RequestMeta) (*types.LoginChallenge, error) {
+	challenge, err := s.SendLoginCode(ctx, passkeyErr.User.Email, "", origin, meta)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := json.Marshal(passkeyStepUp{UserID: passkeyErr.User.ID, CredentialID: passkeyErr.CredentialID, Counter: passkeyErr.Counter})
+	if err != nil {
+		return nil, err
+	}
+	if err := s.cacheService.Set(ctx, passkeyStepUpKey(challenge.PendingLoginID), string(data), time.Until(challenge.ExpiresAt)); err != nil {
+		return nil, fmt.Errorf("failed to store passkey step-up: %w", err)
+	}
+	return challenge, nil
+}
+
+// completePasskeyStepUp clears the clone flag of the passkey an email sign-in confirmed, if any
+func (s *AuthService) completePasskeyStepUp(ctx context.Context, pendingLoginID string, user *types.User, meta types.RequestMeta) {
+	data, err := s.cacheService.Take(ctx, passkeyStepUpKey(pendingLoginID))
+	if err != nil || data == "" {
+		return
+	}
+	var stepUp passkeyStepUp
+	if err := json.Unmarshal([]byte(data), &stepUp); err != nil || stepUp.UserID != user.ID {
+		return
+	}
+	s.webauthnService.clearClonedCredential(ctx, user, stepUp, meta)
+}
+
+// clearClonedCredential trusts a flagged passkey again after the user confirmed a sign-in with it
+func (s *WebAuthnService) clearClonedCredential(ctx context.Context, user *types.User, stepUp passkeyStepUp, meta types.RequestMeta) {
+	if err := s.userRepo.ClearWebAuthnCredentialCloneWarning(ctx, user.ID, stepUp.CredentialID, stepUp.Counter); err != nil {
+		s.logger.Error("Failed to clear cloned passkey flag", "error", err, "userID", user.ID)
+		return
+	}
+	s.logger.Info("Passkey clone flag cleared after email step-up", "userID", user.ID, "counter", stepUp.Counter)
+
+	event := &types.SecurityEvent{
+		UserID:    user.ID,
+		Type:      types.SecurityEventPasskeyCloneCleared,
+		Details:   map[string]any{"counter": stepUp.Counter},
+		IPAddress: meta.IPAddress,
+		UserAgent: meta.UserAgent,
+	}
+	if err := s.securityEvents.Create(ctx, event); err != nil {
+		s.logger.Error("Failed to record security event", "error", err, "userID", user.ID)
+	}
+}
+
+func passkeyStepUpKey(pendingLoginID string) string {
+	return fmt.Sprintf("passkey_step_up:%s", pendingLoginID)
+}
+
+func (e *PasskeyLoginError) Error() string {
+	return e.Message
+}
+
+// handleClonedCredential flags a passkey whose sign counter went backwards, records a security
+// event and alerts the user, then returns the error that applies under the configured action.
+// It returns nil when the login may continue.
+func (s *WebAuthnService) handleClonedCredential(ctx context.Context, user *types.User, cred *types.WebAuthnCredential, counter uint32, meta types.RequestMeta) error {
+	disable := s.cloneAction == CloneActionDisable
+	s.logger.Warn("Passkey sign counter went backwards, possible clone", "userID", user.ID, "credentialID", cred.ID, "stored", cred.Counter, "asserted", counter, "action", s.cloneAction)
+
+	if err := s.userRepo.FlagWebAuthnCredentialCloned(ctx, cred.CredentialID, disable); err != nil {
+		s.logger.Error("Failed to flag cloned passkey", "error", err, "credentialID", cred.ID)
+	}
+
+	event := &types.SecurityEvent{
+		UserID: user.ID,
+		Type:   types.SecurityEventPasskeyCloneDetected,
+		Details: map[string]any{
+			"credential_id":  cred.ID,
+			"name":           cred.Name,
+			"stored_counter": cred.Counter,
+			"counter":        counter,
+			"action":         s.cloneAction,
+		},
+		IPAddress: meta.IPAddress,
+		UserAgent: meta.UserAgent,
+	}
+	if err := s.securityEvents.Create(ctx, event); err != nil {
+		s.logger.Error("Failed to record security event", "error", err, "userID", user.ID)
+	}
+
+	action := "The sign-in was allowed. Remove the passkey from your account if you don't recognise this."
+	switch s.cloneAction {
+	case CloneActionStepUp:
+		action = "Signing in with this passkey now also requires a code sent to your email."
+	case CloneActionDisable:
+		action = "The passkey has been disabled. Sign in with an email code and register a new passkey."
+	}
+	alert := email.SecurityAlertEmail{
+		Subject:   "Your passkey may have been copied",
+		Message:   "Your passkey \"" + cred.Name + "\" was used to sign in, but its signature counter suggests the passkey may have been copied to another device.",
+		Action:    action,
+		IPAddress: meta.IPAddress,
+		UserAgent: meta.UserAgent,
+	}
+	if err := s.emailService.SendSecurityAlertEmail(ctx, user.Email, alert); err != nil {
+		s.logger.Error("Failed to send security alert", "error", err, "userID", user.ID)
+	}
+
+	switch s.cloneAction {
+	case CloneActionStepUp:
+		return stepUpRequired(user, cred, counter)
+	case CloneActionDisable:
+		return &PasskeyLoginError{Code: PasskeyErrorDisabled, Message: "This passkey has been disabled, sign in with an email code"}
+	}
+	return nil
+}
@@ -0,0 +1,292 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"fmt"
+	"math/big"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/simple-auth-roles/internal/types"
+)
+
+// userCodeAlphabet has no vowels, so user codes can't spell words, and no easily confused characters
+const userCodeAlphabet = "BCDFGHJKLMNPQRSTVWXZ"
+
+// slowDownIncrement is added to the poll interval each time a client polls too fast (RFC 8628 section 3.5)
+const slowDownIncrement = 5
+
+// StartDeviceAuthorization issues a device code and user code for a client without a browser
+func (s *OIDCService) StartDeviceAuthorization(ctx context.Context, clientID, clientSecret, scope string) (*types.DeviceAuthorizationResponse, error) {
+	client, err := s.authenticateClient(ctx, clientID, clientSecret)
+	if err != nil {
+		return nil, err
+	}
+	if !client.AllowsGrant(types.GrantTypeDeviceCode) {
+		return nil, oauthError("unauthorized_client", "client may not use the device authorization grant")
+	}
+
+	if scope == "" {
+		scope = types.ScopeOpenID
+	}
+	for _, requested := range strings.Fields(scope) {
+		if !client.AllowsScope(requested) {
+			return nil, oauthError("invalid_scope", fmt.Sprintf("scope %q is not allowed for this client", requested))
+		}
+	}
+
+	deviceCode, err := randomToken(32)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate device code: %w", err)
+	}
+	userCode, err := generateUserCode()
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate user code: %w", err)
+	}
+
+	ttl := s.cfg.DeviceCodeTTL
+	interval := int(s.cfg.DevicePollInterval.Seconds())
+	authorization := types.DeviceAuthorization{
+		ClientID:  client.ClientID,
+		Scope:     scope,
+		UserCode:  userCode,
+		Status:    types.DeviceStatusPending,
+		Interval:  interval,
+		ExpiresAt: time.Now().Add(ttl),
+	}
+	if err := s.storeJSON(ctx, deviceCodeKey(deviceCode), authorization, ttl); err != nil {
+		return nil, fmt.Errorf("failed to store device authorization: %w", err)
+	}
+	// The user code only points at the device code, it can't be redeemed itself
+	if err := s.cache.Set(ctx, userCodeKey(userCode), hashToken(deviceCode), ttl); err != nil {
+		return nil, fmt.Errorf("failed to store user code: %w", err)
+	}
+
+	s.logger.Info("Device authorization started", "client_id", client.ClientID)
+
+	return &types.DeviceAuthorizationResponse{
+		DeviceCode:              deviceCode,
+		UserCode:                userCode,
+		VerificationURI:         s.cfg.DeviceVerificationURL,
+		VerificationURIComplete: appendQuery(s.cfg.DeviceVerificationURL, url.Values{"user_code": {userCode}}),
+		ExpiresIn:               int64(ttl.Seconds()),
+		Interval:                interval,
+	}, nil
+}
+
+// GetDeviceAuthorization returns the pending authorization for a user code so the front-end can ask for confirmation
+func (s *OIDCService) GetDeviceAuthorization(ctx context.Context, userCode string) (*types.DeviceAuthorization, *types.OAuthClient, error) {
+	authorization, _, err := s.findDeviceAuthorization(ctx, userCode, false)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	client, err := s.clientRepo.FindByClientID(ctx, authorization.ClientID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if client == nil || !client.IsActive {
+		return nil, nil, fmt.Errorf("client is no longer active")
+	}
+	return authorization, client, nil
+}
+
+// CompleteDeviceAuthorization records the signed-in user's decision for a user code
+func (s *OIDCService) CompleteDeviceAuthorization(ctx context.Context, userCode string, user *types.User, authTime time.Time, approve bool) error {
+	// Each user code can be confirmed once
+	authorization, key, err := s.findDeviceAuthorization(ctx, userCode, true)
+	if err != nil {
+		return err
+	}
+
+	if approve {
+		authorization.Status = types.DeviceStatusApproved
+		authorization.UserID = user.ID
+		authorization.AuthTime = authTime
+	} else {
+		authorization.Status = types.DeviceStatusDenied
+	}
+	// Polls never write the device code record, so this can't be overwritten by a pending poll
+	if err := s.saveDeviceAuthorization(ctx, key, authorization); err != nil {
+		return err
+	}
+
+	s.logger.Info("Device authorization completed", "client_id", authorization.ClientID, "user_id", user.ID, "approved", approve)
+	return nil
+}
+
+// devicePoll is when a client last polled for a device code and how long it must wait between polls.
+// It is kept apart from the device authorization so polling can't race with the user's decision.
+type devicePoll struct {
+	Interval     int       `json:"interval"`
+	LastPolledAt time.Time `json:"last_polled_at"`
+}
+
+// exchangeDeviceCode answers a device token poll
+func (s *OIDCService) exchangeDeviceCode(ctx context.Context, client *types.OAuthClient, req *TokenRequest, meta types.RequestMeta) (*types.TokenResponse, error) {
+	if req.DeviceCode == "" {
+		return nil, oauthError("invalid_request", "device_code is required")
+	}
+
+	key := deviceCodeKey(req.DeviceCode)
+	var authorization types.DeviceAuthorization
+	found, err := s.loadJSON(ctx, key, &authorization)
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		return nil, oauthError("expired_token", "device code is invalid or expired")
+	}
+	if authorization.ClientID != client.ClientID {
+		return nil, oauthError("invalid_grant", "device code was not issued to this client")
+	}
+	if authorization.Status == types.DeviceStatusPending {
+		return nil, s.throttleDevicePoll(ctx, req.DeviceCode, &authorization)
+	}
+
+	// Decided: device codes are single use, so only one poll may redeem the decision
+	found, err = s.takeJSON(ctx, key, &authorization)
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		return nil, oauthError("expired_token", "device code is invalid or expired")
+	}
+	_ = s.cache.Delete(ctx, devicePollKey(req.DeviceCode))
+	if authorization.Status != types.DeviceStatusApproved {
+		return nil, oauthError("access_denied", "the user denied the request")
+	}
+
+	user, err := s.authService.userRepo.FindByID(ctx, authorization.UserID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find user: %w", err)
+	}
+	if user == nil || !user.IsActive {
+		return nil, oauthError("invalid_grant", "user is not active")
+	}
+
+	meta.Scope = authorization.Scope
+	meta.AuthTime = authorization.AuthTime
+	session, err := s.authService.CreateSession(ctx, user, meta)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.tokenResponse(client, user, session, authorization.Scope, "", authorization.AuthTime)
+}
+
+// throttleDevicePoll records a poll for a pending device code and returns authorization_pending,
+// or slow_down with a longer interval when the client polled too soon (RFC 8628 section 3.5)
+func (s *OIDCService) throttleDevicePoll(ctx context.Context, deviceCode string, authorization *types.DeviceAuthorization) error {
+	ttl := time.Until(authorization.ExpiresAt)
+	if ttl <= 0 {
+		return oauthError("expired_token", "device code is invalid or expired")
+	}
+
+	key := devicePollKey(deviceCode)
+	poll := devicePoll{Interval: authorization.Interval}
+	if _, err := s.loadJSON(ctx, key, &poll); err != nil {
+		return err
+	}
+
+	now := time.Now()
+	tooFast := !poll.LastPolledAt.IsZero() && now.Sub(poll.LastPolledAt) < time.Duration(poll.Interval)*time.Second
+	poll.LastPolledAt = now
+	if tooFast {
+		poll.Interval += slowDownIncrement
+	}
+	if err := s.storeJSON(ctx, key, poll, ttl); err != nil {
+		return fmt.Errorf("failed to record device poll: %w", err)
+	}
+
+	if tooFast {
+		return oauthError("slow_down", fmt.Sprintf("poll at most every %d seconds", poll.Interval))
+	}
+	return oauthError("authorization_pending", "")
+}
+
+// findDeviceAuthorization resolves a user code to its pending authorization and cache key,
+// using up the user code when consume is set
+func (s *OIDCService) findDeviceAuthorization(ctx context.Context, userCode string, consume bool) (*types.DeviceAuthorization, string, error) {
+	lookup := s.cache.Get
+	if consume {
+		lookup = s.cache.Take
+	}
+	deviceCodeHash, err := lookup(ctx, userCodeKey(userCode))
+	if err != nil {
+		return nil, "", err
+	}
+	if deviceCodeHash == "" {
+		return nil, "", fmt.Errorf("code not found or expired")
+	}
+
+	key := deviceCodeKeyFromHash(deviceCodeHash)
+	var authorization types.DeviceAuthorization
+	found, err := s.loadJSON(ctx, key, &authorization)
+	if err != nil {
+		return nil, "", err
+	}
+	if !found || authorization.Status != types.DeviceStatusPending {
+		return nil, "", fmt.Errorf("code not found or expired")
+	}
+	return &authorization, key, nil
+}
+
+// saveDeviceAuthorization writes back an authorization without extending its lifetime
+func (s *OIDCService) saveDeviceAuthorization(ctx context.Context, key string, authorization *types.DeviceAuthorization) error {
+	ttl := time.Until(authorization.ExpiresAt)
+	if ttl <= 0 {
+		return oauthError("expired_token", "device code is invalid or expired")
+	}
+	if err := s.storeJSON(ctx, key, authorization, ttl); err != nil {
+		return fmt.Errorf("failed to update device authorization: %w", err)
+	}
+	return nil
+}
+
+// generateUserCode returns a code like WDJB-MJHT that is easy to type on another device
+func generateUserCode() (string, error) {
+	var b strings.Builder
+	for i := 0; i < 8; i++ {
+		if i == 4 {
+			b.WriteByte('-')
+		}
+		n, err := rand.Int(rand.Reader, big.NewInt(int64(len(userCodeAlphabet))))
+		if err != nil {
+			return "", err
+		}
+		b.WriteByte(userCodeAlphabet[n.Int64()])
+	}
+	return b.String(), nil
+}
+
+// normalizeUserCode accepts codes typed in lower case or without the dash
+func normalizeUserCode(userCode string) string {
+	return strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' {
+			r -= 'a' - 'A'
+		}
+		if strings.ContainsRune(userCodeAlphabet, r) {
+			return r
+		}
+		return -1
+	}, userCode)
+}
+
+func deviceCodeKey(deviceCode string) string {
+	return deviceCodeKeyFromHash(hashToken(deviceCode))
+}
+
+func deviceCodeKeyFromHash(hash string) string {
+	return fmt.Sprintf("oauth_device_code:%s", hash)
+}
+
+func devicePollKey(deviceCode string) string {
+	return fmt.Sprintf("oauth_device_poll:%s", hashToken(deviceCode))
+}
+
+func userCodeKey(userCode string) string {
+	return fmt.Sprintf("oauth_user_code:%s", normalizeUserCode(userCode))
+}
@@ -0,0 +1,315 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/simple-auth-roles/internal/auth/repository"
+	"github.com/simple-auth-roles/internal/config"
+	"github.com/simple-auth-roles/internal/types"
+	"github.com/simple-auth-roles/pkg/signing"
+)
+
+// minReloadInterval limits database reloads triggered by tokens with an unknown kid
+const minReloadInterval = 30 * time.Second
+
+// KeyRing keeps the persisted signing keys: one active key plus retired keys that still verify
+type KeyRing struct {
+	repo   *repository.SigningKeyRepository
+	keys   *signing.KeySet
+	sealer *signing.Sealer // Encrypts private keys stored in the database
+	cfg    *config.Config
+	logger *slog.Logger
+
+	mu         sync.Mutex
+	lastReload time.Time
+}
+
+// NewKeyRing loads the key ring, importing the configured key (JWT_SECRET or JWT_PRIVATE_KEY_FILE) when it is new
+func NewKeyRing(ctx context.Context, repo *repository.SigningKeyRepository, cfg *config.Config, logger *slog.Logger) (*KeyRing, error) {
+	sealer, err := signing.NewSealer(cfg.JWT.KeyEncryptionKey)
+	if err != nil {
+		return nil, err
+	}
+	r := &KeyRing{
+		repo:   repo,
+		sealer: sealer,
+		cfg:    cfg,
+		logger: logger.With("service", "key_ring"),
+	}
+
+	if err := r.sealStoredKeys(ctx); err != nil {
+		return nil, err
+	}
+	if err := r.importConfiguredKey(ctx); err != nil {
+		return nil, err
+	}
+	if err := r.Reload(ctx); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Keys returns the in-memory key set used to sign and verify tokens
+func (r *KeyRing) Keys() *signing.KeySet {
+	return r.keys
+}
+
+// Lookup returns the verification key for kid, reloading from the database when the kid is unknown
+func (r *KeyRing) Lookup(ctx context.Context, kid string) (*signing.Key, error) {
+	key, err := r.keys.Lookup(kid)
+	if err == nil {
+		return key, nil
+	}
+
+	// Another instance may have rotated keys since our last reload
+	r.mu.Lock()
+	stale := time.Since(r.lastReload) > minReloadInterval
+	r.mu.Unlock()
+	if !stale {
+		return nil, err
+	}
+	if reloadErr := r.Reload(ctx); reloadErr != nil {
+		return nil, reloadErr
+	}
+	return r.keys.Lookup(kid)
+}
+
+// Rotate generates a new active signing key and schedules the current one for retirement
+func (r *KeyRing) Rotate(ctx context.Context) (*types.SigningKey, error) {
+	key, err := generateSigningKey(r.cfg.JWT.SigningAlgorithm)
+	if err != nil {
+		return nil, err
+	}
+
+	record, err := r.signingKeyRecord(key)
+	if err != nil {
+		return nil, err
+	}
+
+	notAfter := r.retirementDeadline()
+	if err := r.repo.Promote(ctx, record, notAfter); err != nil {
+		return nil, err
+	}
+	if err := r.Reload(ctx); err != nil {
+		return nil, err
+	}
+
+	r.logger.Info("Signing key rotated", "kid", record.KID, "alg", record.Algorithm, "previous_not_after", notAfter)
+	return record, nil
+}
+
+// List returns every key in the ring, including expired ones
+func (r *KeyRing) List(ctx context.Context) ([]types.SigningKey, error) {
+	return r.repo.ListAll(ctx)
+}
+
+// Reload refreshes the in-memory key set from the database
+func (r *KeyRing) Reload(ctx context.Context) error {
+	records, err := r.repo.ListUsable(ctx, time.Now())
+	if err != nil {
+		return err
+	}
+
+	var (
+		active    *signing.Key
+		verifying []*signing.Key
+	)
+	for _, record := range records {
+		key, err := r.signingKeyFromRecord(record)
+		if err != nil {
+			r.logger.Warn("Skipping unreadable signing key", "kid", record.KID, "error", err)
+			continue
+		}
+		if record.Status == types.SigningKeyStatusActive && active == nil {
+			active = key
+			continue
+		}
+		verifying = append(verifying, key)
+	}
+	if active == nil {
+		return errors.New("no active signing key")
+	}
+
+	if r.keys == nil {
+		r.keys = signing.NewKeySet(active, verifying...)
+	} else {
+		r.keys.Replace(active, verifying...)
+	}
+
+	r.mu.Lock()
+	r.lastReload = time.Now()
+	r.mu.Unlock()
+	return nil
+}
+
+// Run reloads the key ring periodically so rotations made by other instances are picked up
+func (r *KeyRing) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := r.Reload(ctx); err != nil {
+				r.logger.Error("Failed to reload signing keys", "error", err)
+			}
+		}
+	}
+}
+
+// importConfiguredKey adds the key from config to the ring if it has never been seen.
+// Changing JWT_SECRET or the key file therefore rotates keys without invalidating existing tokens.
+func (r *KeyRing) importConfiguredKey(ctx context.Context) error {
+	usable, err := r.repo.ListUsable(ctx, time.Now())
+	if err != nil {
+		return err
+	}
+	hasActive := false
+	for _, record := range usable {
+		if record.Status == types.SigningKeyStatusActive {
+			hasActive = true
+			break
+		}
+	}
+
+	// Only generate a key file when nothing else could sign tokens
+	key, err := r.configuredKey(!hasActive)
+	if err != nil || key == nil {
+		return err
+	}
+
+	exists, err := r.repo.ExistsByKID(ctx, key.ID)
+	if err != nil || exists {
+		return err
+	}
+
+	record, err := r.signingKeyRecord(key)
+	if err != nil {
+		return err
+	}
+	if err := r.repo.Promote(ctx, record, r.retirementDeadline()); err != nil {
+		return err
+	}
+
+	r.logger.Info("Imported configured signing key", "kid", key.ID, "alg", key.Algorithm)
+	return nil
+}
+
+// configuredKey returns the key from JWT_SECRET or JWT_PRIVATE_KEY_FILE, or nil if the file is absent and generate is false
+func (r *KeyRing) configuredKey(generate bool) (*signing.Key, error) {
+	if r.cfg.JWT.SigningAlgorithm == signing.AlgorithmHS256 {
+		return signing.NewHMACKey([]byte(r.cfg.JWT.Secret)), nil
+	}
+
+	path := r.cfg.JWT.PrivateKeyFile
+	if !generate {
+		if _, err := os.Stat(path); errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+	}
+
+	key, generated, err := signing.LoadOrGenerateKey(path, r.cfg.JWT.SigningAlgorithm)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load signing key: %w", err)
+	}
+	if generated {
+		r.logger.Info("Generated new signing key", "path", path, "alg", key.Algorithm, "kid", key.ID)
+	}
+	return key, nil
+}
+
+// retirementDeadline is when a key retired now stops verifying; never before its last token expires
+func (r *KeyRing) retirementDeadline() time.Time {
+	period := r.cfg.JWT.KeyRetirementPeriod
+	if period < r.cfg.JWT.Expiration {
+		period = r.cfg.JWT.Expiration
+	}
+	return time.Now().Add(period)
+}
+
+// generateSigningKey creates a fresh key for the algorithm
+func generateSigningKey(algorithm string) (*signing.Key, error) {
+	if algorithm == signing.AlgorithmHS256 {
+		secret := make([]byte, 32)
+		if _, err := rand.Read(secret); err != nil {
+			return nil, fmt.Errorf("failed to generate secret: %w", err)
+		}
+		return signing.NewHMACKey(secret), nil
+	}
+
+	signer, err := signing.GenerateSigner(algorithm)
+	if err != nil {
+		return nil, err
+	}
+	return signing.NewKey(algorithm, signer)
+}
+
+// signingKeyRecord converts a key into its database form, with the private key encrypted
+func (r *KeyRing) signingKeyRecord(key *signing.Key) (*types.SigningKey, error) {
+	material := key.Secret()
+	if !key.IsSymmetric() {
+		encoded, err := signing.MarshalPrivateKeyPEM(key.Signer())
+		if err != nil {
+			return nil, err
+		}
+		material = encoded
+	}
+	sealed, err := r.sealer.Seal(key.ID, material)
+	if err != nil {
+		return nil, err
+	}
+
+	return &types.SigningKey{
+		KID:        key.ID,
+		Algorithm:  key.Algorithm,
+		PrivateKey: sealed,
+	}, nil
+}
+
+// signingKeyFromRecord restores a key from its database form
+func (r *KeyRing) signingKeyFromRecord(record types.SigningKey) (*signing.Key, error) {
+	material, err := r.sealer.Open(record.KID, record.PrivateKey)
+	if err != nil {
+		return nil, err
+	}
+	if record.Algorithm == signing.AlgorithmHS256 {
+		return signing.NewHMACKey(material), nil
+	}
+
+	signer, err := signing.ParsePrivateKeyPEM(material)
+	if err != nil {
+		return nil, err
+	}
+	return signing.NewKey(record.Algorithm, signer)
+}
+
+// sealStoredKeys encrypts keys stored in plaintext before KEY_ENCRYPTION_KEY existed
+func (r *KeyRing) sealStoredKeys(ctx context.Context) error {
+	records, err := r.repo.ListAll(ctx)
+	if err != nil {
+		return err
+	}
+	for _, record := range records {
+		if signing.IsSealed(record.PrivateKey) {
+			continue
+		}
+		sealed, err := r.sealer.Seal(record.KID, record.PrivateKey)
+		if err != nil {
+			return err
+		}
+		if err := r.repo.UpdatePrivateKey(ctx, record.ID, sealed); err != nil {
+			return err
+		}
+		r.logger.Info("Encrypted stored signing key", "kid", record.KID)
+	}
+	return nil
+}
@@ -0,0 +1,163 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Login code error codes returned to clients
+const (
+	LoginErrorCodeExpired     = "code_expired"     // No code pending, request a new one
+	LoginErrorInvalidCode     = "invalid_code"     // Wrong code, attempts remain
+	LoginErrorCodeInvalidated = "code_invalidated" // Too many wrong guesses, request a new code
+	LoginErrorLockedOut       = "locked_out"       // Wait RetryAfter before trying again
+)
+
+// LoginCodeError explains why a login code was rejected
+type LoginCodeError struct {
+	Code              string
+	Message           string
+	AttemptsRemaining int
+	RetryAfter        time.Duration
+}
+
+func (e *LoginCodeError) Error() string {
+	return e.Message
+}
+
+func lockedOutError(retryAfter time.Duration) *LoginCodeError {
+	return &LoginCodeError{
+		Code:       LoginErrorLockedOut,
+		Message:    "Too many failed attempts, try again later",
+		RetryAfter: retryAfter,
+	}
+}
+
+// checkLoginLockout returns an error while the email or IP address is locked out
+func (s *AuthService) checkLoginLockout(ctx context.Context, email, ipAddress string) error {
+	subjects := []string{emailLockoutSubject(email)}
+	if ipAddress != "" {
+		subjects = append(subjects, ipLockoutSubject(ipAddress))
+	}
+
+	for _, subject := range subjects {
+		value, err := s.cacheService.Get(ctx, loginLockedKey(subject))
+		if err != nil {
+			return fmt.Errorf("failed to check lockout: %w", err)
+		}
+		if value == "" {
+			continue
+		}
+		until, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			continue
+		}
+		if retryAfter := time.Until(time.Unix(until, 0)); retryAfter > 0 {
+			return lockedOutError(retryAfter)
+		}
+	}
+	return nil
+}
+
+// recordFailedLoginAttempt counts a wrong code and decides whether to invalidate the code or lock out
+func (s *AuthService) recordFailedLoginAttempt(ctx context.Context, email, ipAddress string) error {
+	if ipAddress != "" {
+		ipAttempts, err := s.cacheService.Increment(ctx, loginIPAttemptsKey(ipAddress), s.login.AttemptWindow)
+		if err != nil {
+			return fmt.Errorf("failed to record login attempt: %w", err)
+		}
+		if ipAttempts >= int64(s.login.MaxIPAttempts) {
+			_ = s.cacheService.Delete(ctx, loginIPAttemptsKey(ipAddress))
+			duration, err := s.lockOut(ctx, ipLockoutSubject(ipAddress))
+			if err != nil {
+				return err
+			}
+			s.logger.Warn("IP address locked out after failed login attempts", "ip", ipAddress, "duration", duration)
+			return lockedOutError(duration)
+		}
+	}
+
+	attempts, err := s.cacheService.Increment(ctx, loginAttemptsKey(email), s.login.AttemptWindow)
+	if err != nil {
+		return fmt.Errorf("failed to record login attempt: %w", err)
+	}
+	if attempts < int64(s.login.MaxCodeAttempts) {
+		return &LoginCodeError{
+			Code:              LoginErrorInvalidCode,
+			Message:           "Invalid code",
+			AttemptsRemaining: s.login.MaxCodeAttempts - int(attempts),
+		}
+	}
+
+	// Out of guesses: the code can no longer be used, even after the lockout
+	_ = s.cacheService.Delete(ctx, loginCodeKey(email))
+	_ = s.cacheService.Delete(ctx, loginAttemptsKey(email))
+	duration, err := s.lockOut(ctx, emailLockoutSubject(email))
+	if err != nil {
+		return err
+	}
+	s.logger.Warn("Login code invalidated after failed attempts", "email", email, "lockout", duration)
+
+	return &LoginCodeError{
+		Code:       LoginErrorCodeInvalidated,
+		Message:    "Too many failed attempts, request a new code",
+		RetryAfter: duration,
+	}
+}
+
+// clearLoginAttempts forgets failed attempts for an email after a successful login
+func (s *AuthService) clearLoginAttempts(ctx context.Context, email string) {
+	_ = s.cacheService.Delete(ctx, loginAttemptsKey(email))
+	_ = s.cacheService.Delete(ctx, loginLockoutsKey(emailLockoutSubject(email)))
+}
+
+// lockOut locks a subject for a duration that doubles with each lockout in the reset window
+func (s *AuthService) lockOut(ctx context.Context, subject string) (time.Duration, error) {
+	lockouts, err := s.cacheService.Increment(ctx, loginLockoutsKey(subject), s.login.LockoutResetTime)
+	if err != nil {
+		return 0, fmt.Errorf("failed to record lockout: %w", err)
+	}
+
+	duration := s.login.LockoutDuration
+	for i := int64(1); i < lockouts && duration < s.login.MaxLockout; i++ {
+		duration *= 2
+	}
+	duration = min(duration, s.login.MaxLockout)
+
+	until := strconv.FormatInt(time.Now().Add(duration).Unix(), 10)
+	if err := s.cacheService.Set(ctx, loginLockedKey(subject), until, duration); err != nil {
+		return 0, fmt.Errorf("failed to store lockout: %w", err)
+	}
+	return duration, nil
+}
+
+func loginCodeKey(email string) string {
+	return fmt.Sprintf("login_code:%s", strings.ToLower(email))
+}
+
+func loginAttemptsKey(email string) string {
+	return fmt.Sprintf("login_attempts:%s", strings.ToLower(email))
+}
+
+func loginIPAttemptsKey(ipAddress string) string {
+	return fmt.Sprintf("login_attempts_ip:%s", ipAddress)
+}
+
+func loginLockoutsKey(subject string) string {
+	return fmt.Sprintf("login_lockouts:%s", subject)
+}
+
+func loginLockedKey(subject string) string {
+	return fmt.Sprintf("login_locked:%s", subject)
+}
+
+func emailLockoutSubject(email string) string {
+	return "email:" + strings.ToLower(email)
+}
+
+func ipLockoutSubject(ipAddress string) string {
+	return "ip:" + ipAddress
+}
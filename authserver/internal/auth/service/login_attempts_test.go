@@ -0,0 +1,76 @@
+package service
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/simple-auth-roles/internal/config"
+	"github.com/simple-auth-roles/pkg/cache"
+)
+
+func TestLockOutEscalation(t *testing.T) {
+	tests := []struct {
+		name  string
+		login config.LoginConfig
+		want  []time.Duration // Lockout after each repeat
+	}{
+		{
+			name:  "doubles up to the maximum",
+			login: config.LoginConfig{LockoutDuration: time.Minute, MaxLockout: 10 * time.Minute, LockoutResetTime: time.Hour},
+			want:  []time.Duration{time.Minute, 2 * time.Minute, 4 * time.Minute, 8 * time.Minute, 10 * time.Minute, 10 * time.Minute},
+		},
+		{
+			name:  "maximum reached exactly",
+			login: config.LoginConfig{LockoutDuration: time.Minute, MaxLockout: 4 * time.Minute, LockoutResetTime: time.Hour},
+			want:  []time.Duration{time.Minute, 2 * time.Minute, 4 * time.Minute, 4 * time.Minute},
+		},
+		{
+			name:  "first lockout above the maximum",
+			login: config.LoginConfig{LockoutDuration: time.Hour, MaxLockout: time.Minute, LockoutResetTime: time.Hour},
+			want:  []time.Duration{time.Minute, time.Minute},
+		},
+	}
+
+	ctx := context.Background()
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &AuthService{
+				cacheService: cache.NewCacheService(&config.Config{}, logger),
+				login:        tt.login,
+			}
+			subject := emailLockoutSubject("user@example.com")
+
+			for i, want := range tt.want {
+				got, err := s.lockOut(ctx, subject)
+				if err != nil {
+					t.Fatalf("lockOut() #%d error = %v", i+1, err)
+				}
+				if got != want {
+					t.Errorf("lockOut() #%d = %v, want %v", i+1, got, want)
+				}
+
+				locked, err := s.cacheService.Get(ctx, loginLockedKey(subject))
+				if err != nil {
+					t.Fatalf("Get() error = %v", err)
+				}
+				until, err := strconv.ParseInt(locked, 10, 64)
+				if err != nil {
+					t.Fatalf("lockout marker %q: %v", locked, err)
+				}
+				if remaining := time.Until(time.Unix(until, 0)); remaining <= want-2*time.Second || remaining > want {
+					t.Errorf("lockOut() #%d locked for %v, want %v", i+1, remaining, want)
+				}
+			}
+
+			// Other subjects are not affected
+			if got, _ := s.lockOut(ctx, ipLockoutSubject("192.0.2.1")); got != tt.want[0] {
+				t.Errorf("lockOut() of another subject = %v, want %v", got, tt.want[0])
+			}
+		})
+	}
+}
@@ -0,0 +1,161 @@
+package service
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/simple-auth-roles/internal/types"
+)
+
+// LoginErrorInvalidLink means a magic link is malformed, expired or already used
+const LoginErrorInvalidLink = "invalid_link"
+
+// loginCodeRecord is what is stored for a pending email login; the code, link and
+// cross-device approval share it, so using any one of them invalidates the others
+type loginCodeRecord struct {
+	CodeMAC        string `json:"code_mac"`
+	LinkID         string `json:"link_id"`
+	PendingLoginID string `json:"pending_login_id"`
+}
+
+// magicLinkPayload is the signed part of a magic link token
+type magicLinkPayload struct {
+	Email     string `json:"email"`
+	LinkID    string `json:"lid"`
+	ExpiresAt int64  `json:"exp"`
+}
+
+// VerifyMagicLink exchanges a magic link token for a session, like VerifyLoginCode
+func (s *AuthService) VerifyMagicLink(ctx context.Context, token string, meta types.RequestMeta) (*types.AuthResponse, error) {
+	invalid := &LoginCodeError{Code: LoginErrorInvalidLink, Message: "This sign-in link is invalid or has expired, request a new one"}
+
+	payload, err := s.parseMagicLinkToken(token)
+	if err != nil {
+		s.logger.Warn("Invalid magic link token", "error", err, "ip", meta.IPAddress)
+		return nil, invalid
+	}
+
+	record, err := s.loadLoginCode(ctx, payload.Email)
+	if err != nil || record == nil {
+		s.logger.Warn("Magic link used after its code was used or expired", "email", payload.Email)
+		return nil, invalid
+	}
+	// Only the link from the latest email is valid
+	if !hmac.Equal([]byte(record.LinkID), []byte(payload.LinkID)) {
+		s.logger.Warn("Superseded magic link used", "email", payload.Email)
+		return nil, invalid
+	}
+	if used, err := s.useLoginCode(ctx, payload.Email, record); err != nil {
+		return nil, err
+	} else if !used {
+		s.logger.Warn("Magic link used by a concurrent request", "email", payload.Email)
+		return nil, invalid
+	}
+
+	return s.completeEmailLogin(ctx, payload.Email, record.PendingLoginID, meta)
+}
+
+// magicLinkURL builds the link for the front-end the login was started from
+func (s *AuthService) magicLinkURL(email, linkID, origin string) (string, error) {
+	token, err := s.signMagicLinkToken(magicLinkPayload{
+		Email:     strings.ToLower(email),
+		LinkID:    linkID,
+		ExpiresAt: time.Now().Add(s.login.CodeTTL).Unix(),
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to sign magic link: %w", err)
+	}
+
+	// Unknown origins get the default page, so the link can't be pointed elsewhere
+	base := s.login.MagicLinkURL
+	if override, ok := s.login.MagicLinkURLs[strings.TrimSuffix(origin, "/")]; ok {
+		base = override
+	}
+	return appendQuery(base, url.Values{"token": {token}}), nil
+}
+
+// signMagicLinkToken encodes the payload as <payload>.<signature>
+func (s *AuthService) signMagicLinkToken(payload magicLinkPayload) (string, error) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return "", err
+	}
+	encoded := base64.RawURLEncoding.EncodeToString(data)
+	return encoded + "." + s.magicLinkSignature(encoded), nil
+}
+
+func (s *AuthService) parseMagicLinkToken(token string) (*magicLinkPayload, error) {
+	encoded, signature, ok := strings.Cut(token, ".")
+	if !ok {
+		return nil, fmt.Errorf("malformed token")
+	}
+	if !hmac.Equal([]byte(signature), []byte(s.magicLinkSignature(encoded))) {
+		return nil, fmt.Errorf("invalid signature")
+	}
+
+	data, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("malformed token: %w", err)
+	}
+	var payload magicLinkPayload
+	if err := json.Unmarshal(data, &payload); err != nil {
+		return nil, fmt.Errorf("malformed token: %w", err)
+	}
+	if time.Now().Unix() > payload.ExpiresAt {
+		return nil, fmt.Errorf("token expired")
+	}
+	return &payload, nil
+}
+
+func (s *AuthService) magicLinkSignature(encoded string) string {
+	mac := hmac.New(sha256.New, s.codeHMACKey)
+	// Domain separated from login code MACs, which use the same key
+	mac.Write([]byte("magic-link\x00" + encoded))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func (s *AuthService) storeLoginCode(ctx context.Context, email string, record loginCodeRecord) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	return s.cacheService.Set(ctx, loginCodeKey(email), string(data), s.login.CodeTTL)
+}
+
+// loadLoginCode returns the pending login for an email, or nil if there is none
+func (s *AuthService) loadLoginCode(ctx context.Context, email string) (*loginCodeRecord, error) {
+	data, err := s.cacheService.Get(ctx, loginCodeKey(email))
+	if err != nil {
+		return nil, err
+	}
+	if data == "" {
+		return nil, nil
+	}
+	var record loginCodeRecord
+	if err := json.Unmarshal([]byte(data), &record); err != nil {
+		return nil, fmt.Errorf("failed to decode login code: %w", err)
+	}
+	return &record, nil
+}
+
+// useLoginCode removes the pending login for an email in one step, so its code, link and
+// approval sign in at most once. It reports false when a concurrent request used it first
+// or a newer email replaced it; a newer code is left in place.
+func (s *AuthService) useLoginCode(ctx context.Context, email string, record *loginCodeRecord) (bool, error) {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return false, err
+	}
+	used, err := s.cacheService.DeleteIfValue(ctx, loginCodeKey(email), string(data))
+	if err != nil {
+		return false, fmt.Errorf("failed to use login code: %w", err)
+	}
+	return used, nil
+}
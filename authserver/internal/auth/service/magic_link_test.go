@@ -0,0 +1,109 @@
+package service
+
+import (
+	"context"
+	"encoding/base64"
+	"io"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/simple-auth-roles/internal/config"
+	"github.com/simple-auth-roles/pkg/cache"
+)
+
+func TestParseMagicLinkToken(t *testing.T) {
+	s := &AuthService{codeHMACKey: []byte("test-key")}
+	other := &AuthService{codeHMACKey: []byte("other-key")}
+	orgs := &OrgService{linkKey: []byte("test-key")}
+
+	valid := magicLinkPayload{Email: "user@example.com", LinkID: "link", ExpiresAt: time.Now().Add(time.Minute).Unix()}
+	sign := func(signer *AuthService, payload magicLinkPayload) string {
+		token, err := signer.signMagicLinkToken(payload)
+		if err != nil {
+			t.Fatalf("signMagicLinkToken: %v", err)
+		}
+		return token
+	}
+	token := sign(s, valid)
+	encoded, signature, _ := strings.Cut(token, ".")
+
+	// The payload of another email, under the signature of the valid token
+	forged := valid
+	forged.Email = "admin@example.com"
+	forgedEncoded, _, _ := strings.Cut(sign(s, forged), ".")
+
+	// A valid invitation token signed with the same key
+	invitation, err := orgs.signInvitationToken(invitationPayload{InvitationID: 1, LinkID: "link", ExpiresAt: valid.ExpiresAt})
+	if err != nil {
+		t.Fatalf("signInvitationToken: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		token   string
+		wantErr bool
+	}{
+		{"valid", token, false},
+		{"expired", sign(s, magicLinkPayload{Email: valid.Email, LinkID: valid.LinkID, ExpiresAt: time.Now().Add(-time.Second).Unix()}), true},
+		{"payload swapped", forgedEncoded + "." + signature, true},
+		{"signature changed", encoded + "." + base64.RawURLEncoding.EncodeToString([]byte("not a signature")), true},
+		{"signed with another key", sign(other, valid), true},
+		{"no signature", encoded, true},
+		{"empty", "", true},
+		{"invitation token", invitation, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			payload, err := s.parseMagicLinkToken(tt.token)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("parseMagicLinkToken() accepted the token: %+v", payload)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseMagicLinkToken() error = %v", err)
+			}
+			if *payload != valid {
+				t.Errorf("parseMagicLinkToken() = %+v, want %+v", *payload, valid)
+			}
+		})
+	}
+}
+
+func TestUseLoginCode(t *testing.T) {
+	ctx := context.Background()
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	s := &AuthService{
+		cacheService: cache.NewCacheService(&config.Config{}, logger),
+		login:        config.LoginConfig{CodeTTL: time.Minute},
+	}
+	const email = "user@example.com"
+	first := loginCodeRecord{CodeMAC: "first", LinkID: "first-link", PendingLoginID: "first-login"}
+	second := loginCodeRecord{CodeMAC: "second", LinkID: "second-link", PendingLoginID: "second-login"}
+
+	if err := s.storeLoginCode(ctx, email, first); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.storeLoginCode(ctx, email, second); err != nil {
+		t.Fatal(err)
+	}
+
+	// A link from the first email must not use up the code sent after it
+	if used, err := s.useLoginCode(ctx, email, &first); err != nil || used {
+		t.Fatalf("useLoginCode(first) = %v, %v, want false", used, err)
+	}
+	if current, _ := s.loadLoginCode(ctx, email); current == nil || *current != second {
+		t.Fatalf("current code = %+v, want %+v", current, second)
+	}
+
+	if used, err := s.useLoginCode(ctx, email, &second); err != nil || !used {
+		t.Fatalf("useLoginCode(second) = %v, %v, want true", used, err)
+	}
+	if used, _ := s.useLoginCode(ctx, email, &second); used {
+		t.Error("useLoginCode(second) used the code twice")
+	}
+}
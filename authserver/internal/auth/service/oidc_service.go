@@ -0,0 +1,589 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/simple-auth-roles/internal/auth/repository"
+	"github.com/simple-auth-roles/internal/config"
+	"github.com/simple-auth-roles/internal/types"
+	"github.com/simple-auth-roles/pkg/cache"
+	"github.com/simple-auth-roles/pkg/signing"
+)
+
+// supportedScopes are the scopes clients can be registered for
+var supportedScopes = []string{types.ScopeOpenID, types.ScopeProfile, types.ScopeEmail, types.ScopeRoles}
+
+// OAuthError is an error response as defined by RFC 6749 section 5.2
+type OAuthError struct {
+	Code        string `json:"error"`
+	Description string `json:"error_description,omitempty"`
+	Status      int    `json:"-"`
+}
+
+func (e *OAuthError) Error() string {
+	if e.Description == "" {
+		return e.Code
+	}
+	return fmt.Sprintf("%s: %s", e.Code, e.Description)
+}
+
+func oauthError(code, description string) *OAuthError {
+	status := http.StatusBadRequest
+	if code == "invalid_client" {
+		status = http.StatusUnauthorized
+	}
+	return &OAuthError{Code: code, Description: description, Status: status}
+}
+
+// TokenRequest carries the parameters of a token endpoint call
+type TokenRequest struct {
+	GrantType    string
+	ClientID     string
+	ClientSecret string
+	Code         string
+	RedirectURI  string
+	CodeVerifier string
+	RefreshToken string
+	DeviceCode   string
+}
+
+// OIDCService implements the OpenID Connect provider on top of the existing login flows
+type OIDCService struct {
+	authService *AuthService
+	clientRepo  *repository.OAuthClientRepository
+	cache       cache.CacheService
+	logger      *slog.Logger
+	cfg         config.OIDCConfig
+}
+
+func NewOIDCService(authService *AuthService, clientRepo *repository.OAuthClientRepository, cache cache.CacheService, logger *slog.Logger, cfg *config.Config) *OIDCService {
+	return &OIDCService{
+		authService: authService,
+		clientRepo:  clientRepo,
+		cache:       cache,
+		logger:      logger.With("service", "oidc"),
+		cfg:         cfg.OIDC,
+	}
+}
+
+// CreateClient registers a client and returns its plaintext secret, which is not stored
+func (s *OIDCService) CreateClient(ctx context.Context, req *types.CreateOAuthClientRequest) (*types.OAuthClient, string, error) {
+	scopes := req.Scopes
+	if len(scopes) == 0 {
+		scopes = []string{types.ScopeOpenID, types.ScopeProfile, types.ScopeEmail}
+	}
+	for _, scope := range scopes {
+		if !slices.Contains(supportedScopes, scope) {
+			return nil, "", fmt.Errorf("unsupported scope: %s", scope)
+		}
+	}
+
+	grantTypes := req.GrantTypes
+	if len(grantTypes) == 0 {
+		grantTypes = []string{types.GrantTypeAuthorizationCode, types.GrantTypeRefreshToken}
+	}
+	for _, grantType := range grantTypes {
+		if !slices.Contains(s.supportedGrantTypes(), grantType) {
+			return nil, "", fmt.Errorf("unsupported grant type: %s", grantType)
+		}
+	}
+	if slices.Contains(grantTypes, types.GrantTypeAuthorizationCode) && len(req.RedirectURIs) == 0 {
+		return nil, "", fmt.Errorf("redirect_uris are required for the authorization code grant")
+	}
+
+	clientID, err := randomToken(16)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to generate client ID: %w", err)
+	}
+
+	client := &types.OAuthClient{
+		ClientID:     clientID,
+		Name:         req.Name,
+		RedirectURIs: req.RedirectURIs,
+		Scopes:       scopes,
+		GrantTypes:   grantTypes,
+		IsPublic:     req.IsPublic,
+		IsActive:     true,
+	}
+
+	var secret string
+	if !req.IsPublic {
+		if secret, err = randomToken(32); err != nil {
+			return nil, "", fmt.Errorf("failed to generate client secret: %w", err)
+		}
+		client.ClientSecretHash = hashToken(secret)
+	}
+
+	if err := s.clientRepo.Create(ctx, client); err != nil {
+		return nil, "", err
+	}
+
+	s.logger.Info("OAuth client registered", "client_id", client.ClientID, "name", client.Name)
+	return client, secret, nil
+}
+
+// ListClients returns all registered clients
+func (s *OIDCService) ListClients(ctx context.Context) ([]*types.OAuthClient, error) {
+	return s.clientRepo.FindAll(ctx)
+}
+
+// DeactivateClient stops a client from starting new logins or redeeming tokens
+func (s *OIDCService) DeactivateClient(ctx context.Context, clientID string) error {
+	return s.clientRepo.Deactivate(ctx, clientID)
+}
+
+// ValidateRedirect checks the client and redirect URI of an /authorize request.
+// Errors from here must be shown to the user instead of redirected.
+func (s *OIDCService) ValidateRedirect(ctx context.Context, clientID, redirectURI string) (*types.OAuthClient, error) {
+	client, err := s.clientRepo.FindByClientID(ctx, clientID)
+	if err != nil {
+		return nil, err
+	}
+	if client == nil || !client.IsActive {
+		return nil, oauthError("invalid_client", "unknown client")
+	}
+	if !client.HasRedirectURI(redirectURI) {
+		return nil, oauthError("invalid_request", "redirect_uri is not registered for this client")
+	}
+	return client, nil
+}
+
+// Authorize validates an authorization request and stores it until the user has signed in
+func (s *OIDCService) Authorize(ctx context.Context, client *types.OAuthClient, responseType string, req *types.AuthorizationRequest) error {
+	if responseType != "code" {
+		return oauthError("unsupported_response_type", "only the code response type is supported")
+	}
+	if !client.AllowsGrant(types.GrantTypeAuthorizationCode) {
+		return oauthError("unauthorized_client", "client may not use the authorization code grant")
+	}
+
+	if req.Scope == "" {
+		req.Scope = types.ScopeOpenID
+	}
+	for _, scope := range strings.Fields(req.Scope) {
+		if !client.AllowsScope(scope) {
+			return oauthError("invalid_scope", fmt.Sprintf("scope %q is not allowed for this client", scope))
+		}
+	}
+
+	if req.CodeChallenge == "" {
+		if client.IsPublic {
+			return oauthError("invalid_request", "public clients must use PKCE")
+		}
+	} else if req.CodeChallengeMethod != "S256" {
+		return oauthError("invalid_request", "code_challenge_method must be S256")
+	}
+
+	id, err := randomToken(16)
+	if err != nil {
+		return fmt.Errorf("failed to generate request ID: %w", err)
+	}
+	req.ID = id
+	req.ClientID = client.ClientID
+	req.ExpiresAt = time.Now().Add(s.cfg.AuthRequestTTL)
+
+	if err := s.storeJSON(ctx, authorizationRequestKey(id), req, s.cfg.AuthRequestTTL); err != nil {
+		return fmt.Errorf("failed to store authorization request: %w", err)
+	}
+	return nil
+}
+
+// LoginURL returns the front-end page where the user signs in to continue the authorization request
+func (s *OIDCService) LoginURL(req *types.AuthorizationRequest) string {
+	return appendQuery(s.cfg.LoginURL, url.Values{"authorization_request": {req.ID}})
+}
+
+// ErrorRedirectURL builds the redirect that carries an authorization error back to the client
+func (s *OIDCService) ErrorRedirectURL(redirectURI, state string, oauthErr *OAuthError) string {
+	params := url.Values{"error": {oauthErr.Code}}
+	if oauthErr.Description != "" {
+		params.Set("error_description", oauthErr.Description)
+	}
+	if state != "" {
+		params.Set("state", state)
+	}
+	return appendQuery(redirectURI, params)
+}
+
+// GetAuthorizationRequest returns a pending authorization request and its client for the consent page
+func (s *OIDCService) GetAuthorizationRequest(ctx context.Context, id string) (*types.AuthorizationRequest, *types.OAuthClient, error) {
+	var req types.AuthorizationRequest
+	found, err := s.loadJSON(ctx, authorizationRequestKey(id), &req)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !found {
+		return nil, nil, fmt.Errorf("authorization request not found or expired")
+	}
+
+	client, err := s.clientRepo.FindByClientID(ctx, req.ClientID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if client == nil || !client.IsActive {
+		return nil, nil, fmt.Errorf("client is no longer active")
+	}
+	return &req, client, nil
+}
+
+// CompleteAuthorization finishes a pending request for the signed-in user and returns where to send the browser
+func (s *OIDCService) CompleteAuthorization(ctx context.Context, id string, user *types.User, authTime time.Time, approve bool) (string, error) {
+	// Each request can be decided once
+	var req types.AuthorizationRequest
+	found, err := s.takeJSON(ctx, authorizationRequestKey(id), &req)
+	if err != nil {
+		return "", err
+	}
+	if !found {
+		return "", fmt.Errorf("authorization request not found or expired")
+	}
+	client, err := s.clientRepo.FindByClientID(ctx, req.ClientID)
+	if err != nil {
+		return "", err
+	}
+	if client == nil || !client.IsActive {
+		return "", fmt.Errorf("client is no longer active")
+	}
+
+	params := url.Values{}
+	if req.State != "" {
+		params.Set("state", req.State)
+	}
+
+	if !approve {
+		params.Set("error", "access_denied")
+		return appendQuery(req.RedirectURI, params), nil
+	}
+
+	code, err := randomToken(32)
+	if err != nil {
+		return "", fmt.Errorf("failed to generate authorization code: %w", err)
+	}
+
+	grant := types.AuthorizationCode{
+		ClientID:            req.ClientID,
+		RedirectURI:         req.RedirectURI,
+		UserID:              user.ID,
+		Scope:               req.Scope,
+		Nonce:               req.Nonce,
+		CodeChallenge:       req.CodeChallenge,
+		CodeChallengeMethod: req.CodeChallengeMethod,
+		AuthTime:            authTime,
+	}
+	if err := s.storeJSON(ctx, authorizationCodeKey(code), grant, s.cfg.AuthCodeTTL); err != nil {
+		return "", fmt.Errorf("failed to store authorization code: %w", err)
+	}
+
+	s.logger.Info("Authorization code issued", "client_id", req.ClientID, "user_id", user.ID)
+
+	params.Set("code", code)
+	return appendQuery(req.RedirectURI, params), nil
+}
+
+// Token implements the token endpoint
+func (s *OIDCService) Token(ctx context.Context, req *TokenRequest, meta types.RequestMeta) (*types.TokenResponse, error) {
+	client, err := s.authenticateClient(ctx, req.ClientID, req.ClientSecret)
+	if err != nil {
+		return nil, err
+	}
+	if !client.AllowsGrant(req.GrantType) {
+		return nil, oauthError("unauthorized_client", "client may not use this grant type")
+	}
+
+	meta.ClientID = client.ClientID
+
+	switch req.GrantType {
+	case types.GrantTypeAuthorizationCode:
+		return s.exchangeAuthorizationCode(ctx, client, req, meta)
+	case types.GrantTypeRefreshToken:
+		return s.exchangeRefreshToken(ctx, client, req, meta)
+	case types.GrantTypeDeviceCode:
+		return s.exchangeDeviceCode(ctx, client, req, meta)
+	default:
+		return nil, oauthError("unsupported_grant_type", "")
+	}
+}
+
+func (s *OIDCService) exchangeAuthorizationCode(ctx context.Context, client *types.OAuthClient, req *TokenRequest, meta types.RequestMeta) (*types.TokenResponse, error) {
+	key := authorizationCodeKey(req.Code)
+	var grant types.AuthorizationCode
+	found, err := s.loadJSON(ctx, key, &grant)
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		return nil, oauthError("invalid_grant", "authorization code is invalid or expired")
+	}
+	// Checked before redeeming, so another client presenting the code can't use it up
+	if grant.ClientID != client.ClientID || grant.RedirectURI != req.RedirectURI {
+		return nil, oauthError("invalid_grant", "authorization code was not issued to this client or redirect_uri")
+	}
+
+	// Codes are single use, so only one exchange may redeem a code
+	found, err = s.takeJSON(ctx, key, &grant)
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		return nil, oauthError("invalid_grant", "authorization code is invalid or expired")
+	}
+
+	if grant.CodeChallenge != "" {
+		if req.CodeVerifier == "" || !verifyCodeChallenge(grant.CodeChallenge, req.CodeVerifier) {
+			return nil, oauthError("invalid_grant", "code_verifier does not match the code challenge")
+		}
+	} else if req.CodeVerifier != "" {
+		return nil, oauthError("invalid_grant", "code_verifier sent without a code challenge")
+	}
+
+	user, err := s.authService.userRepo.FindByID(ctx, grant.UserID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find user: %w", err)
+	}
+	if user == nil || !user.IsActive {
+		return nil, oauthError("invalid_grant", "user is not active")
+	}
+
+	meta.Scope = grant.Scope
+	meta.AuthTime = grant.AuthTime
+	session, err := s.authService.CreateSession(ctx, user, meta)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.tokenResponse(client, user, session, grant.Scope, grant.Nonce, grant.AuthTime)
+}
+
+func (s *OIDCService) exchangeRefreshToken(ctx context.Context, client *types.OAuthClient, req *TokenRequest, meta types.RequestMeta) (*types.TokenResponse, error) {
+	if req.RefreshToken == "" {
+		return nil, oauthError("invalid_request", "refresh_token is required")
+	}
+
+	session, err := s.authService.RefreshSession(ctx, req.RefreshToken, meta)
+	if err != nil {
+		if errors.Is(err, ErrInvalidRefreshToken) || errors.Is(err, ErrRefreshTokenReused) {
+			return nil, oauthError("invalid_grant", err.Error())
+		}
+		return nil, err
+	}
+
+	return s.tokenResponse(client, session.User, session, session.Scope, "", time.Time{})
+}
+
+// tokenResponse builds the token endpoint response, adding an ID token when openid was granted
+func (s *OIDCService) tokenResponse(client *types.OAuthClient, user *types.User, session *types.AuthResponse, scope, nonce string, authTime time.Time) (*types.TokenResponse, error) {
+	response := &types.TokenResponse{
+		AccessToken:  session.Token,
+		TokenType:    "Bearer",
+		ExpiresIn:    session.ExpiresIn,
+		RefreshToken: session.RefreshToken,
+		Scope:        scope,
+	}
+
+	if !client.AllowsGrant(types.GrantTypeRefreshToken) {
+		response.RefreshToken = ""
+	}
+
+	if hasScope(scope, types.ScopeOpenID) {
+		idToken, err := s.generateIDToken(client, user, scope, nonce, authTime)
+		if err != nil {
+			return nil, fmt.Errorf("failed to generate ID token: %w", err)
+		}
+		response.IDToken = idToken
+	}
+	return response, nil
+}
+
+// generateIDToken signs an ID token whose claims depend on the granted scopes
+func (s *OIDCService) generateIDToken(client *types.OAuthClient, user *types.User, scope, nonce string, authTime time.Time) (string, error) {
+	now := time.Now()
+	claims := types.IDTokenClaims{
+		Nonce: nonce,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    s.cfg.Issuer,
+			Subject:   strconv.FormatUint(uint64(user.ID), 10),
+			Audience:  jwt.ClaimStrings{client.ClientID},
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(s.cfg.IDTokenExpiration)),
+		},
+	}
+	if !authTime.IsZero() {
+		claims.AuthTime = authTime.Unix()
+	}
+	if hasScope(scope, types.ScopeEmail) {
+		claims.Email = user.Email
+		// Every sign-in method proves control of the address
+		claims.EmailVerified = true
+	}
+	if hasScope(scope, types.ScopeProfile) {
+		claims.Name = user.Name
+	}
+	if hasScope(scope, types.ScopeRoles) {
+		claims.Roles = s.authService.roles.EffectiveRoles(user.Roles)
+	}
+
+	return s.authService.signToken(claims)
+}
+
+// UserInfo returns the claims about the user the client's access token allows
+func (s *OIDCService) UserInfo(user *types.User, claims *types.JWTClaims) map[string]interface{} {
+	info := map[string]interface{}{
+		"sub": strconv.FormatUint(uint64(user.ID), 10),
+	}
+
+	if claims.HasScope(types.ScopeEmail) {
+		info["email"] = user.Email
+		info["email_verified"] = true
+	}
+	if claims.HasScope(types.ScopeProfile) {
+		info["name"] = user.Name
+	}
+	if claims.HasScope(types.ScopeRoles) {
+		info["roles"] = s.authService.roles.EffectiveRoles(user.Roles)
+	}
+	return info
+}
+
+// Discovery returns the OpenID Provider metadata document
+func (s *OIDCService) Discovery() map[string]interface{} {
+	api := s.cfg.Issuer + "/api/v1/oauth"
+	return map[string]interface{}{
+		"issuer":                                s.cfg.Issuer,
+		"authorization_endpoint":                api + "/authorize",
+		"token_endpoint":                        api + "/token",
+		"device_authorization_endpoint":         api + "/device/code",
+		"userinfo_endpoint":                     api + "/userinfo",
+		"jwks_uri":                              s.cfg.Issuer + "/.well-known/jwks.json",
+		"response_types_supported":              []string{"code"},
+		"subject_types_supported":               []string{"public"},
+		"id_token_signing_alg_values_supported": idTokenAlgorithms(s.authService.keyRing.Keys().Algorithms()),
+		"scopes_supported":                      supportedScopes,
+		"grant_types_supported":                 s.supportedGrantTypes(),
+		"token_endpoint_auth_methods_supported": []string{"client_secret_basic", "client_secret_post", "none"},
+		"code_challenge_methods_supported":      []string{"S256"},
+		"claims_supported":                      []string{"sub", "iss", "aud", "exp", "iat", "auth_time", "nonce", "email", "email_verified", "name", "roles"},
+	}
+}
+
+// idTokenAlgorithms keeps the public key algorithms relying parties are expected to support;
+// retired shared secrets can still be in the ring but never sign ID tokens
+func idTokenAlgorithms(algorithms []string) []string {
+	var supported []string
+	for _, alg := range algorithms {
+		if alg == signing.AlgorithmRS256 || alg == signing.AlgorithmES256 {
+			supported = append(supported, alg)
+		}
+	}
+	return supported
+}
+
+// supportedGrantTypes lists the grants the token endpoint implements
+func (s *OIDCService) supportedGrantTypes() []string {
+	return []string{types.GrantTypeAuthorizationCode, types.GrantTypeRefreshToken, types.GrantTypeDeviceCode}
+}
+
+// authenticateClient checks the client credentials; public clients authenticate with their ID only
+func (s *OIDCService) authenticateClient(ctx context.Context, clientID, clientSecret string) (*types.OAuthClient, error) {
+	if clientID == "" {
+		return nil, oauthError("invalid_client", "client_id is required")
+	}
+
+	client, err := s.clientRepo.FindByClientID(ctx, clientID)
+	if err != nil {
+		return nil, err
+	}
+	if client == nil || !client.IsActive {
+		return nil, oauthError("invalid_client", "unknown client")
+	}
+
+	if client.IsPublic {
+		if clientSecret != "" {
+			return nil, oauthError("invalid_client", "public clients must not send a secret")
+		}
+		return client, nil
+	}
+
+	if subtle.ConstantTimeCompare([]byte(hashToken(clientSecret)), []byte(client.ClientSecretHash)) != 1 {
+		return nil, oauthError("invalid_client", "client authentication failed")
+	}
+	return client, nil
+}
+
+func (s *OIDCService) storeJSON(ctx context.Context, key string, value interface{}, ttl time.Duration) error {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	return s.cache.Set(ctx, key, string(data), ttl)
+}
+
+func (s *OIDCService) loadJSON(ctx context.Context, key string, value interface{}) (bool, error) {
+	data, err := s.cache.Get(ctx, key)
+	if err != nil {
+		return false, err
+	}
+	if data == "" {
+		return false, nil
+	}
+	if err := json.Unmarshal([]byte(data), value); err != nil {
+		return false, fmt.Errorf("failed to decode %s: %w", key, err)
+	}
+	return true, nil
+}
+
+// takeJSON loads and deletes a value in one step, so only one caller can redeem it
+func (s *OIDCService) takeJSON(ctx context.Context, key string, value interface{}) (bool, error) {
+	data, err := s.cache.Take(ctx, key)
+	if err != nil {
+		return false, err
+	}
+	if data == "" {
+		return false, nil
+	}
+	if err := json.Unmarshal([]byte(data), value); err != nil {
+		return false, fmt.Errorf("failed to decode %s: %w", key, err)
+	}
+	return true, nil
+}
+
+// verifyCodeChallenge checks an S256 PKCE verifier against the stored challenge
+func verifyCodeChallenge(challenge, verifier string) bool {
+	sum := sha256.Sum256([]byte(verifier))
+	computed := base64.RawURLEncoding.EncodeToString(sum[:])
+	return subtle.ConstantTimeCompare([]byte(computed), []byte(challenge)) == 1
+}
+
+func hasScope(scope, want string) bool {
+	return slices.Contains(strings.Fields(scope), want)
+}
+
+// appendQuery adds params to a URL that may already have a query string
+func appendQuery(rawURL string, params url.Values) string {
+	separator := "?"
+	if strings.Contains(rawURL, "?") {
+		separator = "&"
+	}
+	return rawURL + separator + params.Encode()
+}
+
+func authorizationRequestKey(id string) string {
+	return fmt.Sprintf("oauth_authz_request:%s", id)
+}
+
+func authorizationCodeKey(code string) string {
+	return fmt.Sprintf("oauth_code:%s", hashToken(code))
+}
@@ -0,0 +1,344 @@
+package service
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/simple-auth-roles/internal/types"
+	"github.com/simple-auth-roles/pkg/email"
+)
+
+// Invitation errors
+var (
+	ErrInvitationNotFound   = errors.New("invitation not found")
+	ErrInvitationExists     = errors.New("this email already has a pending invitation; resend or revoke it")
+	ErrInvitationNotPending = errors.New("the invitation has already been accepted or revoked")
+	ErrInvalidInvitation    = errors.New("this invitation link is invalid or has expired")
+	ErrInvitationWrongEmail = errors.New("this invitation was sent to another email address")
+	ErrAlreadyOrgMember     = errors.New("this user is already a member of the organization")
+	ErrTooManyInvitations   = errors.New("too many invitations sent, try again later")
+)
+
+// invitationPayload is the signed part of an invite link token
+type invitationPayload struct {
+	InvitationID uint   `json:"iid"`
+	LinkID       string `json:"lid"`
+	ExpiresAt    int64  `json:"exp"`
+}
+
+// Invite emails an invitation to join the organization with role (org admins only)
+func (s *OrgService) Invite(ctx context.Context, inviter *types.User, orgID uint, req *types.CreateInvitationRequest) (*types.OrgInvitation, error) {
+	if err := s.roles.ValidateRole(ctx, req.Role); err != nil {
+		return nil, err
+	}
+	address := strings.ToLower(strings.TrimSpace(req.Email))
+
+	org, err := s.GetOrg(ctx, orgID)
+	if err != nil {
+		return nil, err
+	}
+	if user, err := s.userRepo.FindByEmail(ctx, address); err != nil {
+		return nil, err
+	} else if user != nil {
+		membership, err := s.repo.FindMembership(ctx, orgID, user.ID)
+		if err != nil {
+			return nil, err
+		}
+		if membership != nil {
+			return nil, ErrAlreadyOrgMember
+		}
+	}
+
+	existing, err := s.invitations.FindPending(ctx, orgID, address)
+	if err != nil {
+		return nil, err
+	}
+	if existing != nil {
+		return nil, ErrInvitationExists
+	}
+	if err := s.countInvitationSent(ctx, inviter); err != nil {
+		return nil, err
+	}
+
+	linkID, err := randomToken(16)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate link ID: %w", err)
+	}
+	now := time.Now()
+	invitation := &types.OrgInvitation{
+		OrgID:     orgID,
+		Email:     address,
+		Role:      req.Role,
+		Status:    types.InvitationStatusPending,
+		LinkID:    linkID,
+		InvitedBy: inviter.ID,
+		SentAt:    now,
+		ExpiresAt: now.Add(s.invitationTTL),
+	}
+	if err := s.invitations.Create(ctx, invitation); err != nil {
+		return nil, err
+	}
+
+	if err := s.sendInvitation(ctx, inviter, org, invitation); err != nil {
+		return nil, err
+	}
+	s.logger.Info("Invitation sent", "org_id", orgID, "invitation_id", invitation.ID, "role", invitation.Role, "inviter_id", inviter.ID)
+	return invitation, nil
+}
+
+// ListInvitations returns the organization's invitations, pending ones past their expiry as expired (org admins only)
+func (s *OrgService) ListInvitations(ctx context.Context, orgID uint) ([]types.OrgInvitation, error) {
+	invitations, err := s.invitations.ListByOrg(ctx, orgID)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	for i := range invitations {
+		if invitations[i].Status == types.InvitationStatusPending && !now.Before(invitations[i].ExpiresAt) {
+			invitations[i].Status = types.InvitationStatusExpired
+		}
+	}
+	return invitations, nil
+}
+
+// ResendInvitation emails a new invite link, which replaces the old one and restarts the expiry (org admins only)
+func (s *OrgService) ResendInvitation(ctx context.Context, inviter *types.User, orgID, invitationID uint) (*types.OrgInvitation, error) {
+	invitation, err := s.orgInvitation(ctx, orgID, invitationID)
+	if err != nil {
+		return nil, err
+	}
+	org, err := s.GetOrg(ctx, orgID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.countInvitationSent(ctx, inviter); err != nil {
+		return nil, err
+	}
+
+	linkID, err := randomToken(16)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate link ID: %w", err)
+	}
+	now := time.Now()
+	renewed, err := s.invitations.Renew(ctx, invitation, linkID, now, now.Add(s.invitationTTL))
+	if err != nil {
+		return nil, err
+	}
+	if !renewed {
+		return nil, ErrInvitationNotPending
+	}
+
+	if err := s.sendInvitation(ctx, inviter, org, invitation); err != nil {
+		return nil, err
+	}
+	s.logger.Info("Invitation resent", "org_id", orgID, "invitation_id", invitation.ID, "inviter_id", inviter.ID)
+	return invitation, nil
+}
+
+// RevokeInvitation cancels a pending invitation so its link stops working (org admins only)
+func (s *OrgService) RevokeInvitation(ctx context.Context, actorID, orgID, invitationID uint) error {
+	revoked, err := s.invitations.Revoke(ctx, orgID, invitationID)
+	if err != nil {
+		return err
+	}
+	if !revoked {
+		// Tell a missing invitation apart from one that was already used
+		if _, err := s.orgInvitation(ctx, orgID, invitationID); err != nil {
+			return err
+		}
+		return ErrInvitationNotPending
+	}
+
+	s.logger.Info("Invitation revoked", "org_id", orgID, "invitation_id", invitationID, "actor_id", actorID)
+	return nil
+}
+
+// PreviewInvitation returns what an invite link is for, so the invitee can check it before signing in
+func (s *OrgService) PreviewInvitation(ctx context.Context, token string) (*types.InvitationPreview, error) {
+	invitation, err := s.invitationFromToken(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+	org, err := s.GetOrg(ctx, invitation.OrgID)
+	if err != nil {
+		return nil, err
+	}
+	return &types.InvitationPreview{
+		OrgName:   org.Name,
+		Email:     invitation.Email,
+		Role:      invitation.Role,
+		ExpiresAt: invitation.ExpiresAt,
+	}, nil
+}
+
+// AcceptInvitation adds the signed-in user to the organization in the invite link. The user must
+// have signed in with the invited email address.
+func (s *OrgService) AcceptInvitation(ctx context.Context, user *types.User, token string) (*types.OrgMembership, error) {
+	invitation, err := s.invitationFromToken(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkInvitee(invitation, user); err != nil {
+		s.logger.Warn("Invitation used by another account", "invitation_id", invitation.ID, "user_id", user.ID)
+		return nil, err
+	}
+
+	accepted, err := s.invitations.Accept(ctx, invitation, user.ID)
+	if err != nil {
+		return nil, err
+	}
+	if !accepted {
+		return nil, ErrInvalidInvitation
+	}
+
+	s.logger.Info("Invitation accepted", "org_id", invitation.OrgID, "invitation_id", invitation.ID, "user_id", user.ID)
+	return s.Membership(ctx, invitation.OrgID, user.ID)
+}
+
+// HasPendingInvitation reports whether the email has been invited to any organization
+func (s *OrgService) HasPendingInvitation(ctx context.Context, address string) (bool, error) {
+	return s.invitations.HasPendingForEmail(ctx, strings.ToLower(strings.TrimSpace(address)))
+}
+
+// orgInvitation finds one of the organization's invitations
+func (s *OrgService) orgInvitation(ctx context.Context, orgID, invitationID uint) (*types.OrgInvitation, error) {
+	invitation, err := s.invitations.FindByID(ctx, invitationID)
+	if err != nil {
+		return nil, err
+	}
+	if invitation == nil || invitation.OrgID != orgID {
+		return nil, ErrInvitationNotFound
+	}
+	return invitation, nil
+}
+
+// invitationFromToken checks an invite link token and returns its pending invitation
+func (s *OrgService) invitationFromToken(ctx context.Context, token string) (*types.OrgInvitation, error) {
+	payload, err := s.parseInvitationToken(token)
+	if err != nil {
+		s.logger.Warn("Invalid invitation token", "error", err)
+		return nil, ErrInvalidInvitation
+	}
+
+	invitation, err := s.invitations.FindByID(ctx, payload.InvitationID)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkInvitationLink(invitation, payload, time.Now()); err != nil {
+		return nil, err
+	}
+	return invitation, nil
+}
+
+// checkInvitationLink returns ErrInvalidInvitation unless the link is the one from the latest
+// email of an invitation that is still pending and unexpired
+func checkInvitationLink(invitation *types.OrgInvitation, payload *invitationPayload, now time.Time) error {
+	if invitation == nil || !hmac.Equal([]byte(invitation.LinkID), []byte(payload.LinkID)) ||
+		invitation.Status != types.InvitationStatusPending || !now.Before(invitation.ExpiresAt) {
+		return ErrInvalidInvitation
+	}
+	return nil
+}
+
+// checkInvitee returns ErrInvitationWrongEmail unless the user signed in with the invited email
+func checkInvitee(invitation *types.OrgInvitation, user *types.User) error {
+	if !strings.EqualFold(user.Email, invitation.Email) {
+		return ErrInvitationWrongEmail
+	}
+	return nil
+}
+
+// countInvitationSent counts an invitation email against the inviter's limit, so an org admin
+// can't use the server to send mail to arbitrary addresses
+func (s *OrgService) countInvitationSent(ctx context.Context, inviter *types.User) error {
+	sent, err := s.cache.Increment(ctx, invitationsSentKey(inviter.ID), s.invitationWindow)
+	if err != nil {
+		return fmt.Errorf("failed to count invitations: %w", err)
+	}
+	if sent > int64(s.invitationLimit) {
+		s.logger.Warn("Invitation limit reached", "inviter_id", inviter.ID, "limit", s.invitationLimit)
+		return ErrTooManyInvitations
+	}
+	return nil
+}
+
+func (s *OrgService) sendInvitation(ctx context.Context, inviter *types.User, org *types.Organization, invitation *types.OrgInvitation) error {
+	token, err := s.signInvitationToken(invitationPayload{
+		InvitationID: invitation.ID,
+		LinkID:       invitation.LinkID,
+		ExpiresAt:    invitation.ExpiresAt.Unix(),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to sign invitation link: %w", err)
+	}
+
+	inviterName := inviter.Name
+	if inviterName == "" {
+		inviterName = inviter.Email
+	}
+	msg := email.InvitationEmail{
+		OrgName:     org.Name,
+		Role:        invitation.Role,
+		InviterName: inviterName,
+		AcceptLink:  appendQuery(s.invitationURL, url.Values{"token": {token}}),
+		ExpiresAt:   invitation.ExpiresAt,
+	}
+	// The invitation is kept when sending fails so it can be resent
+	if err := s.emailService.SendInvitationEmail(ctx, invitation.Email, msg); err != nil {
+		s.logger.Error("Failed to send invitation email", "error", err, "invitation_id", invitation.ID)
+		return fmt.Errorf("failed to send invitation email: %w", err)
+	}
+	return nil
+}
+
+// signInvitationToken encodes the payload as <payload>.<signature>, like magic link tokens
+func (s *OrgService) signInvitationToken(payload invitationPayload) (string, error) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return "", err
+	}
+	encoded := base64.RawURLEncoding.EncodeToString(data)
+	return encoded + "." + s.invitationSignature(encoded), nil
+}
+
+func (s *OrgService) parseInvitationToken(token string) (*invitationPayload, error) {
+	encoded, signature, ok := strings.Cut(token, ".")
+	if !ok {
+		return nil, fmt.Errorf("malformed token")
+	}
+	if !hmac.Equal([]byte(signature), []byte(s.invitationSignature(encoded))) {
+		return nil, fmt.Errorf("invalid signature")
+	}
+
+	data, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("malformed token: %w", err)
+	}
+	var payload invitationPayload
+	if err := json.Unmarshal(data, &payload); err != nil {
+		return nil, fmt.Errorf("malformed token: %w", err)
+	}
+	if time.Now().Unix() > payload.ExpiresAt {
+		return nil, fmt.Errorf("token expired")
+	}
+	return &payload, nil
+}
+
+func (s *OrgService) invitationSignature(encoded string) string {
+	mac := hmac.New(sha256.New, s.linkKey)
+	// Domain separated from magic links and login code MACs, which use the same key
+	mac.Write([]byte("org-invitation\x00" + encoded))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func invitationsSentKey(userID uint) string {
+	return fmt.Sprintf("org_invitations_sent:%d", userID)
+}
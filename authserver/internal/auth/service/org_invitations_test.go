@@ -0,0 +1,71 @@
+package service
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/simple-auth-roles/internal/types"
+)
+
+func TestCheckInvitationLink(t *testing.T) {
+	now := time.Now()
+	pending := func(change func(*types.OrgInvitation)) *types.OrgInvitation {
+		invitation := &types.OrgInvitation{
+			ID:        7,
+			Email:     "new.member@example.com",
+			Status:    types.InvitationStatusPending,
+			LinkID:    "first-link",
+			ExpiresAt: now.Add(time.Hour),
+		}
+		if change != nil {
+			change(invitation)
+		}
+		return invitation
+	}
+	link := &invitationPayload{InvitationID: 7, LinkID: "first-link"}
+
+	tests := []struct {
+		name       string
+		invitation *types.OrgInvitation
+		wantErr    error
+	}{
+		{"pending", pending(nil), nil},
+		{"link from before a resend", pending(func(i *types.OrgInvitation) { i.LinkID = "resent-link" }), ErrInvalidInvitation},
+		{"revoked", pending(func(i *types.OrgInvitation) { i.Status = types.InvitationStatusRevoked }), ErrInvalidInvitation},
+		{"already accepted", pending(func(i *types.OrgInvitation) { i.Status = types.InvitationStatusAccepted }), ErrInvalidInvitation},
+		{"expired", pending(func(i *types.OrgInvitation) { i.ExpiresAt = now }), ErrInvalidInvitation},
+		{"deleted", nil, ErrInvalidInvitation},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := checkInvitationLink(tt.invitation, link, now); !errors.Is(err, tt.wantErr) {
+				t.Errorf("checkInvitationLink() = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestCheckInvitee(t *testing.T) {
+	invitation := &types.OrgInvitation{Email: "new.member@example.com"}
+
+	tests := []struct {
+		name    string
+		email   string
+		wantErr error
+	}{
+		{"invited email", "new.member@example.com", nil},
+		{"different case", "New.Member@Example.com", nil},
+		{"other email", "someone.else@example.com", ErrInvitationWrongEmail},
+		{"similar email", "new.member@example.com.evil", ErrInvitationWrongEmail},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := checkInvitee(invitation, &types.User{Email: tt.email}); !errors.Is(err, tt.wantErr) {
+				t.Errorf("checkInvitee(%q) = %v, want %v", tt.email, err, tt.wantErr)
+			}
+		})
+	}
+}
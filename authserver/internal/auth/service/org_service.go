@@ -0,0 +1,219 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/simple-auth-roles/internal/auth/repository"
+	"github.com/simple-auth-roles/internal/config"
+	"github.com/simple-auth-roles/internal/types"
+	"github.com/simple-auth-roles/pkg/cache"
+	"github.com/simple-auth-roles/pkg/email"
+)
+
+// Organization errors
+var (
+	ErrOrgNotFound           = errors.New("organization not found")
+	ErrOrgSlugTaken          = errors.New("organization slug is already taken")
+	ErrInvalidOrgSlug        = errors.New("organization slugs are 2 to 63 lowercase letters, digits or '-', starting with a letter or digit")
+	ErrInvalidOrgName        = errors.New("organization name is required")
+	ErrNotOrgMember          = errors.New("not a member of this organization")
+	ErrLastOrgAdmin          = errors.New("an organization must keep at least one admin")
+	ErrOrgCreationNotAllowed = errors.New("you are not allowed to create organizations")
+)
+
+var orgSlugPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9-]{1,62}$`)
+
+// OrgService manages organizations, their members and invitations. A member's org role is one
+// of the roles in the roles table and is resolved with the same inheritance as global roles.
+type OrgService struct {
+	repo         *repository.OrgRepository
+	invitations  *repository.InvitationRepository
+	userRepo     *repository.UserRepository
+	roles        *RoleService
+	cache        cache.CacheService
+	emailService email.EmailService
+	logger       *slog.Logger
+
+	openSignup       bool // When false, creating an organization needs PermissionCreateOrgs
+	invitationURL    string
+	invitationTTL    time.Duration
+	invitationLimit  int
+	invitationWindow time.Duration
+	linkKey          []byte // Signs invite links
+}
+
+func NewOrgService(repo *repository.OrgRepository, invitations *repository.InvitationRepository, userRepo *repository.UserRepository, roles *RoleService, cache cache.CacheService, emailService email.EmailService, logger *slog.Logger, cfg *config.Config) *OrgService {
+	return &OrgService{
+		repo:         repo,
+		invitations:  invitations,
+		userRepo:     userRepo,
+		roles:        roles,
+		cache:        cache,
+		emailService: emailService,
+		logger:       logger.With("service", "orgs"),
+
+		openSignup:       cfg.Login.OpenSignup,
+		invitationURL:    cfg.Orgs.InvitationURL,
+		invitationTTL:    cfg.Orgs.InvitationTTL,
+		invitationLimit:  cfg.Orgs.InvitationLimit,
+		invitationWindow: cfg.Orgs.InvitationWindow,
+		linkKey:          []byte(cfg.Login.CodeHMACKey),
+	}
+}
+
+// CreateOrg creates an organization with the user as its admin. Org admins can invite new users,
+// so while sign-up is closed only users whose roles grant PermissionCreateOrgs may create one.
+func (s *OrgService) CreateOrg(ctx context.Context, userID uint, roles []string, req *types.CreateOrgRequest) (*types.Organization, error) {
+	if !s.openSignup && !s.roles.HasPermission(roles, types.PermissionCreateOrgs) {
+		return nil, ErrOrgCreationNotAllowed
+	}
+	name := strings.TrimSpace(req.Name)
+	if name == "" {
+		return nil, ErrInvalidOrgName
+	}
+	if !orgSlugPattern.MatchString(req.Slug) {
+		return nil, ErrInvalidOrgSlug
+	}
+
+	org := &types.Organization{Name: name, Slug: req.Slug}
+	created, err := s.repo.CreateWithMember(ctx, org, userID, types.RoleAdmin)
+	if err != nil {
+		return nil, err
+	}
+	if !created {
+		return nil, ErrOrgSlugTaken
+	}
+
+	s.logger.Info("Organization created", "org_id", org.ID, "slug", org.Slug, "user_id", userID)
+	return org, nil
+}
+
+// GetOrg returns an organization
+func (s *OrgService) GetOrg(ctx context.Context, orgID uint) (*types.Organization, error) {
+	org, err := s.repo.FindByID(ctx, orgID)
+	if err != nil {
+		return nil, err
+	}
+	if org == nil {
+		return nil, ErrOrgNotFound
+	}
+	return org, nil
+}
+
+// ListOrgs returns every organization (admin only)
+func (s *OrgService) ListOrgs(ctx context.Context) ([]types.Organization, error) {
+	return s.repo.List(ctx)
+}
+
+// ListUserOrgs returns the organizations the user belongs to with their role in each
+func (s *OrgService) ListUserOrgs(ctx context.Context, userID uint) ([]types.UserOrg, error) {
+	return s.repo.ListForUser(ctx, userID)
+}
+
+// Membership returns the user's membership of an organization, ErrNotOrgMember when there is none
+func (s *OrgService) Membership(ctx context.Context, orgID, userID uint) (*types.OrgMembership, error) {
+	membership, err := s.repo.FindMembership(ctx, orgID, userID)
+	if err != nil {
+		return nil, err
+	}
+	if membership == nil {
+		return nil, ErrNotOrgMember
+	}
+	return membership, nil
+}
+
+// HasOrgRole reports whether a membership's role is role or inherits it
+func (s *OrgService) HasOrgRole(membership *types.OrgMembership, role string) bool {
+	return slices.Contains(s.roles.EffectiveRoles([]string{membership.Role}), role)
+}
+
+// ListMembers returns the organization's members
+func (s *OrgService) ListMembers(ctx context.Context, orgID uint) ([]types.OrgMember, error) {
+	return s.repo.ListMembers(ctx, orgID)
+}
+
+// SetMemberRole changes a member's role in an organization (org admins only). Users join
+// organizations by accepting an invitation, never by being added directly.
+func (s *OrgService) SetMemberRole(ctx context.Context, actorID, orgID, userID uint, role string) (*types.OrgMembership, error) {
+	if err := s.roles.ValidateRole(ctx, role); err != nil {
+		return nil, err
+	}
+
+	current, err := s.Membership(ctx, orgID, userID)
+	if err != nil {
+		return nil, err
+	}
+	if role != types.RoleAdmin {
+		if err := s.keepAnAdmin(ctx, current); err != nil {
+			return nil, err
+		}
+	}
+
+	membership := &types.OrgMembership{OrgID: orgID, UserID: userID, Role: role}
+	updated, err := s.repo.UpdateMembershipRole(ctx, membership)
+	if err != nil {
+		return nil, err
+	}
+	if !updated {
+		return nil, ErrNotOrgMember
+	}
+
+	s.logger.Info("Organization member role changed", "org_id", orgID, "user_id", userID, "role", role, "actor_id", actorID)
+	return s.Membership(ctx, orgID, userID)
+}
+
+// RemoveMember removes a user from an organization (org admins only)
+func (s *OrgService) RemoveMember(ctx context.Context, actorID, orgID, userID uint) error {
+	current, err := s.Membership(ctx, orgID, userID)
+	if err != nil {
+		return err
+	}
+	if err := s.keepAnAdmin(ctx, current); err != nil {
+		return err
+	}
+
+	if _, err := s.repo.DeleteMembership(ctx, orgID, userID); err != nil {
+		return err
+	}
+
+	s.logger.Info("Organization member removed", "org_id", orgID, "user_id", userID, "actor_id", actorID)
+	return nil
+}
+
+// CheckCanLeaveOrgs returns ErrLastOrgAdmin when the user is the last admin of any of their
+// organizations, so deleting their account would leave it without one
+func (s *OrgService) CheckCanLeaveOrgs(ctx context.Context, userID uint) error {
+	orgs, err := s.repo.ListForUser(ctx, userID)
+	if err != nil {
+		return err
+	}
+	for _, org := range orgs {
+		membership := &types.OrgMembership{OrgID: org.ID, UserID: userID, Role: org.Role}
+		if err := s.keepAnAdmin(ctx, membership); err != nil {
+			return fmt.Errorf("%w: make someone else an admin of %s first", err, org.Name)
+		}
+	}
+	return nil
+}
+
+// keepAnAdmin refuses to demote or remove the organization's last admin
+func (s *OrgService) keepAnAdmin(ctx context.Context, membership *types.OrgMembership) error {
+	if membership.Role != types.RoleAdmin {
+		return nil
+	}
+	admins, err := s.repo.CountMembersWithRole(ctx, membership.OrgID, types.RoleAdmin)
+	if err != nil {
+		return err
+	}
+	if admins <= 1 {
+		return ErrLastOrgAdmin
+	}
+	return nil
+}
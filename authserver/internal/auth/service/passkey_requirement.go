@@ -0,0 +1,72 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"slices"
+
+	"github.com/simple-auth-roles/internal/types"
+)
+
+// PasskeyErrorLastPasskey is returned when deleting the only passkey of an account that must keep one
+const PasskeyErrorLastPasskey = "last_passkey"
+
+// CredentialPolicyError explains why a passkey could not be removed
+type CredentialPolicyError struct {
+	Code    string
+	Message string
+}
+
+func (e *CredentialPolicyError) Error() string {
+	return e.Message
+}
+
+// passkeyRequired reports whether the user's account must keep at least one usable passkey
+func (s *WebAuthnService) passkeyRequired(user *types.User) bool {
+	if user.PasskeyRequired {
+		return true
+	}
+	return slices.ContainsFunc(s.roles.EffectiveRoles(user.Roles), func(role string) bool {
+		return slices.Contains(s.passkeyRequiredRoles, role)
+	})
+}
+
+// checkDeleteCredential refuses to delete the last usable passkey of an account that requires one.
+// Disabled passkeys can't sign in, so they never count as the remaining sign-in method.
+func (s *WebAuthnService) checkDeleteCredential(user *types.User, creds []types.WebAuthnCredential, credentialID []byte) error {
+	var target *types.WebAuthnCredential
+	usable := 0
+	for i := range creds {
+		if bytes.Equal(creds[i].CredentialID, credentialID) {
+			target = &creds[i]
+		}
+		if creds[i].DisabledAt == nil {
+			usable++
+		}
+	}
+	if target == nil {
+		return ErrCredentialNotFound
+	}
+
+	if target.DisabledAt == nil && usable == 1 && s.passkeyRequired(user) {
+		return &CredentialPolicyError{
+			Code:    PasskeyErrorLastPasskey,
+			Message: "Your account requires a passkey. Register another passkey before deleting this one",
+		}
+	}
+	return nil
+}
+
+// SetPasskeyRequired sets whether a user must keep a passkey and records who changed it (admin only)
+func (s *WebAuthnService) SetPasskeyRequired(ctx context.Context, actorID, userID uint, required bool, meta types.RequestMeta) error {
+	found, err := s.userRepo.SetPasskeyRequired(ctx, userID, required)
+	if err != nil {
+		return err
+	}
+	if !found {
+		return ErrUserNotFound
+	}
+	s.logger.Info("Passkey requirement updated", "userID", userID, "required", required, "actorID", actorID)
+	s.roles.audit(ctx, userID, types.SecurityEventPasskeyRequirementChanged, map[string]any{"required": required, "changed_by": actorID}, meta)
+	return nil
+}
@@ -0,0 +1,194 @@
+package service
+
+import (
+	"context"
+	"crypto/hmac"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/simple-auth-roles/internal/types"
+)
+
+// LoginErrorDenied means the login was rejected from the approval link
+const LoginErrorDenied = "login_denied"
+
+// createPendingLogin stores a login that can be approved from the emailed link and returns that link
+func (s *AuthService) createPendingLogin(ctx context.Context, email string, meta types.RequestMeta) (*types.PendingLogin, string, error) {
+	id, err := randomToken(16)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to generate pending login ID: %w", err)
+	}
+	approvalToken, err := randomToken(32)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to generate approval token: %w", err)
+	}
+
+	now := time.Now()
+	pending := &types.PendingLogin{
+		ID:        id,
+		Email:     strings.ToLower(email),
+		Status:    types.PendingLoginStatusPending,
+		IPAddress: meta.IPAddress,
+		UserAgent: meta.UserAgent,
+		CreatedAt: now,
+		ExpiresAt: now.Add(s.login.CodeTTL),
+	}
+	if err := s.savePendingLogin(ctx, pending); err != nil {
+		return nil, "", err
+	}
+	if err := s.cacheService.Set(ctx, loginApprovalKey(approvalToken), id, s.login.CodeTTL); err != nil {
+		return nil, "", fmt.Errorf("failed to store approval token: %w", err)
+	}
+
+	return pending, appendQuery(s.login.ApproveURL, url.Values{"token": {approvalToken}}), nil
+}
+
+// GetLoginApproval returns the login an approval link is for, so the user can see where it came from
+func (s *AuthService) GetLoginApproval(ctx context.Context, approvalToken string) (*types.PendingLogin, error) {
+	pending, _, err := s.findPendingLoginForApproval(ctx, approvalToken)
+	return pending, err
+}
+
+// ApproveLogin approves or denies a pending login from the emailed link.
+// Either way the code and magic link from the same email stop working.
+func (s *AuthService) ApproveLogin(ctx context.Context, approvalToken string, approve bool) (*types.PendingLogin, error) {
+	pending, record, err := s.findPendingLoginForApproval(ctx, approvalToken)
+	if err != nil {
+		return nil, err
+	}
+	if used, err := s.useLoginCode(ctx, pending.Email, record); err != nil {
+		return nil, err
+	} else if !used {
+		return nil, &LoginCodeError{Code: LoginErrorInvalidLink, Message: "This approval link is invalid or has expired"}
+	}
+	_ = s.cacheService.Delete(ctx, loginApprovalKey(approvalToken))
+
+	pending.Status = types.PendingLoginStatusDenied
+	if approve {
+		pending.Status = types.PendingLoginStatusApproved
+	}
+	if err := s.savePendingLogin(ctx, pending); err != nil {
+		return nil, err
+	}
+
+	s.logger.Info("Pending login decided", "email", pending.Email, "status", pending.Status, "requested_from", pending.IPAddress)
+	return pending, nil
+}
+
+// PollPendingLogin returns the pending login while it waits, and a session once it was approved.
+// The session is handed out once; later polls see the login as expired.
+func (s *AuthService) PollPendingLogin(ctx context.Context, id string, meta types.RequestMeta) (*types.PendingLogin, *types.AuthResponse, error) {
+	expired := &LoginCodeError{Code: LoginErrorCodeExpired, Message: "Sign-in request expired, request a new code"}
+
+	pending, err := s.loadPendingLogin(ctx, id)
+	if err != nil {
+		return nil, nil, err
+	}
+	if pending == nil {
+		return nil, nil, expired
+	}
+
+	switch pending.Status {
+	case types.PendingLoginStatusPending:
+		return pending, nil, nil
+	case types.PendingLoginStatusDenied:
+		_ = s.cacheService.Delete(ctx, pendingLoginKey(id))
+		return nil, nil, &LoginCodeError{Code: LoginErrorDenied, Message: "Sign-in was denied from the approval link"}
+	}
+
+	// Approved: only the first poll may claim the session
+	claims, err := s.cacheService.Increment(ctx, pendingLoginClaimKey(id), time.Until(pending.ExpiresAt)+time.Minute)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to claim pending login: %w", err)
+	}
+	if claims != 1 {
+		return nil, nil, expired
+	}
+	_ = s.cacheService.Delete(ctx, pendingLoginKey(id))
+
+	response, err := s.completeEmailLogin(ctx, pending.Email, pending.ID, meta)
+	if err != nil {
+		return nil, nil, err
+	}
+	return pending, response, nil
+}
+
+// findPendingLoginForApproval resolves an approval token to a login that is still waiting,
+// with the pending email login that approving it uses up
+func (s *AuthService) findPendingLoginForApproval(ctx context.Context, approvalToken string) (*types.PendingLogin, *loginCodeRecord, error) {
+	invalid := &LoginCodeError{Code: LoginErrorInvalidLink, Message: "This approval link is invalid or has expired"}
+
+	id, err := s.cacheService.Get(ctx, loginApprovalKey(approvalToken))
+	if err != nil {
+		return nil, nil, err
+	}
+	if id == "" {
+		return nil, nil, invalid
+	}
+
+	pending, err := s.loadPendingLogin(ctx, id)
+	if err != nil {
+		return nil, nil, err
+	}
+	if pending == nil || pending.Status != types.PendingLoginStatusPending {
+		return nil, nil, invalid
+	}
+
+	// The code or magic link from the same email may already have been used,
+	// or a newer email may have replaced this one
+	record, err := s.loadLoginCode(ctx, pending.Email)
+	if err != nil {
+		return nil, nil, err
+	}
+	if record == nil || !hmac.Equal([]byte(record.PendingLoginID), []byte(pending.ID)) {
+		return nil, nil, invalid
+	}
+	return pending, record, nil
+}
+
+// savePendingLogin writes a pending login without extending its lifetime
+func (s *AuthService) savePendingLogin(ctx context.Context, pending *types.PendingLogin) error {
+	ttl := time.Until(pending.ExpiresAt)
+	if ttl <= 0 {
+		return &LoginCodeError{Code: LoginErrorCodeExpired, Message: "Sign-in request expired, request a new code"}
+	}
+	data, err := json.Marshal(pending)
+	if err != nil {
+		return err
+	}
+	if err := s.cacheService.Set(ctx, pendingLoginKey(pending.ID), string(data), ttl); err != nil {
+		return fmt.Errorf("failed to store pending login: %w", err)
+	}
+	return nil
+}
+
+// loadPendingLogin returns the pending login with the given ID, or nil if there is none
+func (s *AuthService) loadPendingLogin(ctx context.Context, id string) (*types.PendingLogin, error) {
+	data, err := s.cacheService.Get(ctx, pendingLoginKey(id))
+	if err != nil {
+		return nil, err
+	}
+	if data == "" {
+		return nil, nil
+	}
+	var pending types.PendingLogin
+	if err := json.Unmarshal([]byte(data), &pending); err != nil {
+		return nil, fmt.Errorf("failed to decode pending login: %w", err)
+	}
+	return &pending, nil
+}
+
+func pendingLoginKey(id string) string {
+	return fmt.Sprintf("pending_login:%s", id)
+}
+
+func pendingLoginClaimKey(id string) string {
+	return fmt.Sprintf("pending_login_claim:%s", id)
+}
+
+func loginApprovalKey(token string) string {
+	return fmt.Sprintf("login_approval:%s", hashToken(token))
+}
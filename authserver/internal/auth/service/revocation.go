@@ -0,0 +1,88 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/simple-auth-roles/internal/types"
+)
+
+// ErrTokenRevoked is returned when a token was signed out before it expired
+var ErrTokenRevoked = errors.New("token has been revoked")
+
+// Logout revokes the access token described by claims and the refresh token family it belongs to
+func (s *AuthService) Logout(ctx context.Context, claims *types.JWTClaims) error {
+	if claims.ID != "" {
+		ttl := time.Until(claims.ExpiresAt.Time)
+		if ttl > 0 {
+			if err := s.cacheService.Set(ctx, revokedTokenKey(claims.ID), "1", ttl); err != nil {
+				return fmt.Errorf("failed to revoke token: %w", err)
+			}
+		}
+	}
+
+	if claims.SessionID != "" {
+		if err := s.tokenRepo.RevokeRefreshTokenFamily(ctx, claims.SessionID); err != nil {
+			return err
+		}
+	}
+
+	s.logger.Info("User logged out", "user_id", claims.UserID, "session_id", claims.SessionID)
+	return nil
+}
+
+// LogoutAll revokes every access and refresh token issued to the user so far
+func (s *AuthService) LogoutAll(ctx context.Context, userID uint) error {
+	// Any access token issued up to now is rejected until the longest-lived one has expired.
+	// Token times are whole seconds, so the cutoff is rounded up and also covers tokens issued
+	// later in the current second.
+	revokedBefore := strconv.FormatInt(time.Now().Truncate(time.Second).Add(time.Second).Unix(), 10)
+	if err := s.cacheService.Set(ctx, revokedBeforeKey(userID), revokedBefore, s.jwtExpiry); err != nil {
+		return fmt.Errorf("failed to revoke tokens: %w", err)
+	}
+
+	if err := s.tokenRepo.RevokeAllRefreshTokensForUser(ctx, userID); err != nil {
+		return err
+	}
+
+	s.logger.Info("All sessions revoked", "user_id", userID)
+	return nil
+}
+
+// isTokenRevoked checks the revocation list for the token ID and the user's sign-out-everywhere marker
+func (s *AuthService) isTokenRevoked(ctx context.Context, claims *types.JWTClaims) (bool, error) {
+	if claims.ID != "" {
+		revoked, err := s.cacheService.Get(ctx, revokedTokenKey(claims.ID))
+		if err != nil {
+			return false, err
+		}
+		if revoked != "" {
+			return true, nil
+		}
+	}
+
+	revokedBefore, err := s.cacheService.Get(ctx, revokedBeforeKey(claims.UserID))
+	if err != nil {
+		return false, err
+	}
+	if revokedBefore == "" {
+		return false, nil
+	}
+
+	cutoff, err := strconv.ParseInt(revokedBefore, 10, 64)
+	if err != nil {
+		return false, fmt.Errorf("invalid revocation marker: %w", err)
+	}
+	return claims.IssuedAt == nil || claims.IssuedAt.Before(time.Unix(cutoff, 0)), nil
+}
+
+func revokedTokenKey(jti string) string {
+	return fmt.Sprintf("revoked_jti:%s", jti)
+}
+
+func revokedBeforeKey(userID uint) string {
+	return fmt.Sprintf("tokens_revoked_before:%d", userID)
+}
@@ -0,0 +1,335 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/simple-auth-roles/internal/types"
+)
+
+// Role grant and elevation errors
+var (
+	ErrInvalidDuration          = errors.New("invalid duration")
+	ErrRoleAlreadyAssigned      = errors.New("the user already has this role")
+	ErrRoleNotAssigned          = errors.New("the user doesn't have this role")
+	ErrElevationPending         = errors.New("an elevation request for this role is already awaiting review")
+	ErrElevationRequestNotFound = errors.New("elevation request not found")
+	ErrElevationNotPending      = errors.New("the elevation request has already been reviewed or has lapsed")
+	ErrSelfApproval             = errors.New("elevation requests must be approved by another admin")
+	ErrInvalidElevationStatus   = errors.New("status must be pending, approved, denied or expired")
+)
+
+// maxElevationRequests and maxSecurityEvents cap how many records are listed at once
+const (
+	maxElevationRequests = 100
+	maxSecurityEvents    = 100
+)
+
+// SetUserRoles makes roles the user's only role assignments, all permanent (admin only).
+// Every role added or removed is written to the user's security events.
+func (s *RoleService) SetUserRoles(ctx context.Context, actorID, userID uint, roles []string, meta types.RequestMeta) error {
+	roles, err := s.ValidateRoles(ctx, roles)
+	if err != nil {
+		return err
+	}
+	if len(roles) == 0 {
+		return fmt.Errorf("%w: at least one role is required", ErrInvalidRole)
+	}
+
+	before, err := s.userRepo.ListRoleGrants(ctx, userID)
+	if err != nil {
+		return err
+	}
+	found, err := s.userRepo.SetRoles(ctx, userID, roles, actorID)
+	if err != nil {
+		return err
+	}
+	if !found {
+		return ErrUserNotFound
+	}
+
+	for _, role := range roles {
+		// A time-boxed grant that becomes permanent is a new grant too
+		if slices.ContainsFunc(before, func(g types.RoleGrant) bool { return g.Role == role && g.ExpiresAt == nil }) {
+			continue
+		}
+		s.audit(ctx, userID, types.SecurityEventRoleGranted, map[string]any{"role": role, "granted_by": actorID}, meta)
+	}
+	for _, grant := range before {
+		if !slices.Contains(roles, grant.Role) {
+			s.audit(ctx, userID, types.SecurityEventRoleRevoked, map[string]any{"role": grant.Role, "revoked_by": actorID}, meta)
+		}
+	}
+
+	s.logger.Info("User roles updated", "user_id", userID, "roles", roles, "actor_id", actorID)
+	return nil
+}
+
+// GrantRole assigns a role to a user for duration, or permanently when duration is 0 (admin only).
+// Granting a role the user holds until a later time keeps the later expiry.
+func (s *RoleService) GrantRole(ctx context.Context, actorID, userID uint, role string, duration time.Duration, meta types.RequestMeta) (*types.RoleGrant, error) {
+	if duration < 0 {
+		return nil, fmt.Errorf("%w: must not be negative", ErrInvalidDuration)
+	}
+	if err := s.ValidateRole(ctx, role); err != nil {
+		return nil, err
+	}
+	if err := s.requireUser(ctx, userID); err != nil {
+		return nil, err
+	}
+
+	grants, err := s.userRepo.ListRoleGrants(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if slices.ContainsFunc(grants, func(g types.RoleGrant) bool { return g.Role == role && g.ExpiresAt == nil }) {
+		return nil, ErrRoleAlreadyAssigned
+	}
+
+	var expiresAt *time.Time
+	if duration > 0 {
+		t := time.Now().Add(duration)
+		expiresAt = &t
+	}
+	if err := s.userRepo.GrantRole(ctx, userID, role, expiresAt, actorID); err != nil {
+		return nil, err
+	}
+
+	grant, err := s.findGrant(ctx, userID, role)
+	if err != nil {
+		return nil, err
+	}
+	s.audit(ctx, userID, types.SecurityEventRoleGranted, map[string]any{"role": role, "expires_at": grant.ExpiresAt, "granted_by": actorID}, meta)
+	s.logger.Info("Role granted", "user_id", userID, "role", role, "expires_at", grant.ExpiresAt, "actor_id", actorID)
+	return grant, nil
+}
+
+// RevokeRole removes a role from a user, whether permanent or time-boxed (admin only)
+func (s *RoleService) RevokeRole(ctx context.Context, actorID, userID uint, role string, meta types.RequestMeta) error {
+	if err := s.requireUser(ctx, userID); err != nil {
+		return err
+	}
+
+	revoked, err := s.userRepo.RevokeRole(ctx, userID, role)
+	if err != nil {
+		return err
+	}
+	if !revoked {
+		return ErrRoleNotAssigned
+	}
+
+	s.audit(ctx, userID, types.SecurityEventRoleRevoked, map[string]any{"role": role, "revoked_by": actorID}, meta)
+	s.logger.Info("Role revoked", "user_id", userID, "role", role, "actor_id", actorID)
+	return nil
+}
+
+// ListGrants returns the user's current role assignments with their expiry (admin only)
+func (s *RoleService) ListGrants(ctx context.Context, userID uint) ([]types.RoleGrant, error) {
+	if err := s.requireUser(ctx, userID); err != nil {
+		return nil, err
+	}
+	return s.userRepo.ListRoleGrants(ctx, userID)
+}
+
+// RequestElevation asks for a role for a limited time. The role is only granted once another admin approves.
+func (s *RoleService) RequestElevation(ctx context.Context, userID uint, req *types.CreateElevationRequest, meta types.RequestMeta) (*types.ElevationRequest, error) {
+	duration, err := time.ParseDuration(req.Duration)
+	if err != nil || duration <= 0 || duration > s.elevationMaxDuration {
+		return nil, fmt.Errorf("%w: must be a positive duration of at most %s, e.g. 4h", ErrInvalidDuration, s.elevationMaxDuration)
+	}
+	if err := s.ValidateRole(ctx, req.Role); err != nil {
+		return nil, err
+	}
+
+	user, err := s.userRepo.FindByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil {
+		return nil, ErrUserNotFound
+	}
+	if slices.Contains(s.EffectiveRoles(user.Roles), req.Role) {
+		return nil, ErrRoleAlreadyAssigned
+	}
+
+	pending, err := s.elevationRequests.HasPending(ctx, userID, req.Role)
+	if err != nil {
+		return nil, err
+	}
+	if pending {
+		return nil, ErrElevationPending
+	}
+
+	now := time.Now()
+	request := &types.ElevationRequest{
+		UserID:          userID,
+		Role:            req.Role,
+		DurationSeconds: int64(duration.Seconds()),
+		Reason:          req.Reason,
+		Status:          types.ElevationStatusPending,
+		CreatedAt:       now,
+		ExpiresAt:       now.Add(s.elevationRequestTTL),
+	}
+	if err := s.elevationRequests.Create(ctx, request); err != nil {
+		return nil, err
+	}
+
+	s.audit(ctx, userID, types.SecurityEventElevationRequested, map[string]any{
+		"request_id": request.ID,
+		"role":       request.Role,
+		"duration":   duration.String(),
+		"reason":     request.Reason,
+	}, meta)
+	s.logger.Info("Role elevation requested", "user_id", userID, "role", request.Role, "duration", duration, "request_id", request.ID)
+	return request, nil
+}
+
+// ListElevationRequests returns the most recent requests with status, or of any status when empty (admin only)
+func (s *RoleService) ListElevationRequests(ctx context.Context, status string) ([]types.ElevationRequest, error) {
+	switch status {
+	case "", types.ElevationStatusPending, types.ElevationStatusApproved, types.ElevationStatusDenied, types.ElevationStatusExpired:
+	default:
+		return nil, ErrInvalidElevationStatus
+	}
+	return s.elevationRequests.List(ctx, status, maxElevationRequests)
+}
+
+// ListUserElevationRequests returns the user's most recent elevation requests
+func (s *RoleService) ListUserElevationRequests(ctx context.Context, userID uint) ([]types.ElevationRequest, error) {
+	return s.elevationRequests.ListByUser(ctx, userID, maxElevationRequests)
+}
+
+// ApproveElevation grants the requested role for the requested time, starting now (admin only).
+// Admins can't approve their own requests.
+func (s *RoleService) ApproveElevation(ctx context.Context, reviewerID, requestID uint, meta types.RequestMeta) (*types.ElevationRequest, error) {
+	request, err := s.pendingElevation(ctx, requestID)
+	if err != nil {
+		return nil, err
+	}
+	if request.UserID == reviewerID {
+		return nil, ErrSelfApproval
+	}
+
+	expiresAt := time.Now().Add(time.Duration(request.DurationSeconds) * time.Second)
+	approved, err := s.elevationRequests.Approve(ctx, request, reviewerID, expiresAt)
+	if err != nil {
+		return nil, err
+	}
+	if !approved {
+		return nil, ErrElevationNotPending
+	}
+
+	s.audit(ctx, request.UserID, types.SecurityEventElevationApproved, map[string]any{"request_id": request.ID, "role": request.Role, "reviewed_by": reviewerID}, meta)
+	s.audit(ctx, request.UserID, types.SecurityEventRoleGranted, map[string]any{"role": request.Role, "expires_at": expiresAt, "granted_by": reviewerID, "request_id": request.ID}, meta)
+	s.logger.Info("Role elevation approved", "user_id", request.UserID, "role", request.Role, "expires_at", expiresAt, "request_id", request.ID, "reviewer_id", reviewerID)
+	return request, nil
+}
+
+// DenyElevation rejects a pending elevation request (admin only)
+func (s *RoleService) DenyElevation(ctx context.Context, reviewerID, requestID uint, meta types.RequestMeta) (*types.ElevationRequest, error) {
+	request, err := s.pendingElevation(ctx, requestID)
+	if err != nil {
+		return nil, err
+	}
+
+	denied, err := s.elevationRequests.Deny(ctx, request, reviewerID)
+	if err != nil {
+		return nil, err
+	}
+	if !denied {
+		return nil, ErrElevationNotPending
+	}
+
+	s.audit(ctx, request.UserID, types.SecurityEventElevationDenied, map[string]any{"request_id": request.ID, "role": request.Role, "reviewed_by": reviewerID}, meta)
+	s.logger.Info("Role elevation denied", "user_id", request.UserID, "role", request.Role, "request_id", request.ID, "reviewer_id", reviewerID)
+	return request, nil
+}
+
+// SweepExpiredGrants removes role grants that have expired and lapses elevation requests that
+// were not reviewed in time. Expired grants already stop counting when roles are loaded; this
+// records their expiry and keeps the table small.
+func (s *RoleService) SweepExpiredGrants(ctx context.Context) {
+	now := time.Now()
+
+	grants, err := s.userRepo.DeleteExpiredRoles(ctx, now)
+	if err != nil {
+		s.logger.Error("Failed to remove expired role grants", "error", err)
+	}
+	for _, grant := range grants {
+		s.audit(ctx, grant.UserID, types.SecurityEventRoleExpired, map[string]any{"role": grant.Role, "expires_at": grant.ExpiresAt, "granted_by": grant.GrantedBy}, types.RequestMeta{})
+		s.logger.Info("Role grant expired", "user_id", grant.UserID, "role", grant.Role)
+	}
+
+	lapsed, err := s.elevationRequests.ExpirePending(ctx, now)
+	if err != nil {
+		s.logger.Error("Failed to expire elevation requests", "error", err)
+	}
+	if lapsed > 0 {
+		s.logger.Info("Elevation requests lapsed without review", "count", lapsed)
+	}
+}
+
+// ListSecurityEvents returns the user's most recent security events, role changes included (admin only)
+func (s *RoleService) ListSecurityEvents(ctx context.Context, userID uint) ([]types.SecurityEvent, error) {
+	if err := s.requireUser(ctx, userID); err != nil {
+		return nil, err
+	}
+	return s.securityEvents.ListByUser(ctx, userID, maxSecurityEvents)
+}
+
+// pendingElevation finds a request that is still awaiting review
+func (s *RoleService) pendingElevation(ctx context.Context, requestID uint) (*types.ElevationRequest, error) {
+	request, err := s.elevationRequests.FindByID(ctx, requestID)
+	if err != nil {
+		return nil, err
+	}
+	if request == nil {
+		return nil, ErrElevationRequestNotFound
+	}
+	if request.Status != types.ElevationStatusPending || !time.Now().Before(request.ExpiresAt) {
+		return nil, ErrElevationNotPending
+	}
+	return request, nil
+}
+
+// findGrant returns the user's current grant of role
+func (s *RoleService) findGrant(ctx context.Context, userID uint, role string) (*types.RoleGrant, error) {
+	grants, err := s.userRepo.ListRoleGrants(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	i := slices.IndexFunc(grants, func(g types.RoleGrant) bool { return g.Role == role })
+	if i < 0 {
+		return nil, fmt.Errorf("granted role %s not found", role)
+	}
+	return &grants[i], nil
+}
+
+func (s *RoleService) requireUser(ctx context.Context, userID uint) error {
+	user, err := s.userRepo.FindByID(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if user == nil {
+		return ErrUserNotFound
+	}
+	return nil
+}
+
+// audit records a role change in the user's security events; a failure is logged, not returned,
+// because the change has already been made
+func (s *RoleService) audit(ctx context.Context, userID uint, eventType string, details map[string]any, meta types.RequestMeta) {
+	event := &types.SecurityEvent{
+		UserID:    userID,
+		Type:      eventType,
+		Details:   details,
+		IPAddress: meta.IPAddress,
+		UserAgent: meta.UserAgent,
+	}
+	if err := s.securityEvents.Create(ctx, event); err != nil {
+		s.logger.Error("Failed to record security event", "error", err, "user_id", userID, "type", eventType)
+	}
+}
@@ -0,0 +1,383 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"maps"
+	"regexp"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/simple-auth-roles/internal/auth/repository"
+	"github.com/simple-auth-roles/internal/config"
+	"github.com/simple-auth-roles/internal/types"
+)
+
+// Role and permission errors
+var (
+	ErrInvalidRole           = errors.New("invalid role")
+	ErrRoleExists            = errors.New("role already exists")
+	ErrPermissionNotFound    = errors.New("permission not found")
+	ErrPermissionExists      = errors.New("permission already exists")
+	ErrInvalidRoleName       = errors.New("role names are 1 to 32 lowercase letters, digits, '-' or '_', starting with a letter")
+	ErrInvalidPermissionName = errors.New("permission names are 1 to 64 lowercase letters, digits, '-', '_', '.' or ':', starting with a letter")
+	ErrAdminRolePermissions  = errors.New("the admin role always has every permission")
+	ErrRoleCycle             = errors.New("a role can't inherit itself, directly or through other roles")
+)
+
+var (
+	roleNamePattern       = regexp.MustCompile(`^[a-z][a-z0-9_-]{0,31}$`)
+	permissionNamePattern = regexp.MustCompile(`^[a-z][a-z0-9_.:-]{0,63}$`)
+)
+
+// RoleService manages roles, their assignment to users and resolves them to permissions. Each
+// role's permission set and inherited roles are cached in memory and reloaded periodically so
+// changes made on other instances are picked up.
+type RoleService struct {
+	repo              *repository.RoleRepository
+	userRepo          *repository.UserRepository
+	elevationRequests *repository.ElevationRequestRepository
+	securityEvents    *repository.SecurityEventRepository
+	logger            *slog.Logger
+
+	elevationMaxDuration time.Duration
+	elevationRequestTTL  time.Duration
+
+	mu          sync.RWMutex
+	permissions map[string]map[string]bool // Role name to permission names
+	inherits    map[string][]string        // Role name to the roles it directly inherits
+}
+
+// NewRoleService loads every role's permissions and inherited roles. The built-in roles are seeded by migrations.
+func NewRoleService(ctx context.Context, repo *repository.RoleRepository, userRepo *repository.UserRepository, elevationRequests *repository.ElevationRequestRepository, securityEvents *repository.SecurityEventRepository, cfg *config.Config, logger *slog.Logger) (*RoleService, error) {
+	s := &RoleService{
+		repo:              repo,
+		userRepo:          userRepo,
+		elevationRequests: elevationRequests,
+		securityEvents:    securityEvents,
+		logger:            logger.With("service", "roles"),
+
+		elevationMaxDuration: cfg.Roles.ElevationMaxDuration,
+		elevationRequestTTL:  cfg.Roles.ElevationRequestTTL,
+	}
+
+	if err := s.Reload(ctx); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Reload refreshes the cached permission sets and inheritance graph from the database
+func (s *RoleService) Reload(ctx context.Context) error {
+	roles, err := s.repo.ListRoles(ctx)
+	if err != nil {
+		return err
+	}
+
+	permissions := make(map[string]map[string]bool, len(roles))
+	inherits := make(map[string][]string, len(roles))
+	for _, role := range roles {
+		set := make(map[string]bool, len(role.Permissions))
+		for _, permission := range role.Permissions {
+			set[permission.Name] = true
+		}
+		permissions[role.Name] = set
+		inherits[role.Name] = role.Inherits
+	}
+
+	s.mu.Lock()
+	s.permissions = permissions
+	s.inherits = inherits
+	s.mu.Unlock()
+	return nil
+}
+
+// Run removes expired role grants and reloads the permission sets and inheritance graph periodically
+func (s *RoleService) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.SweepExpiredGrants(ctx)
+			if err := s.Reload(ctx); err != nil {
+				s.logger.Error("Failed to reload role permissions", "error", err)
+			}
+		}
+	}
+}
+
+// EffectiveRoles returns roles plus every role they inherit, directly or not, sorted by name
+func (s *RoleService) EffectiveRoles(roles []string) []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.effectiveRoles(roles)
+}
+
+// effectiveRoles walks the inheritance graph; s.mu must be held. Cycles are ignored.
+func (s *RoleService) effectiveRoles(roles []string) []string {
+	seen := make(map[string]bool, len(roles))
+	queue := slices.Clone(roles)
+	for len(queue) > 0 {
+		role := queue[0]
+		queue = queue[1:]
+		if seen[role] {
+			continue
+		}
+		seen[role] = true
+		queue = append(queue, s.inherits[role]...)
+	}
+	return slices.Sorted(maps.Keys(seen))
+}
+
+// HasPermission reports whether any of roles, or a role they inherit, grants permission
+func (s *RoleService) HasPermission(roles []string, permission string) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, role := range s.effectiveRoles(roles) {
+		set := s.permissions[role]
+		if set[types.PermissionAll] || set[permission] {
+			return true
+		}
+	}
+	return false
+}
+
+// ValidateRole checks that role exists in the database
+func (s *RoleService) ValidateRole(ctx context.Context, role string) error {
+	exists, err := s.repo.RoleExists(ctx, role)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return fmt.Errorf("%w: %s", ErrInvalidRole, role)
+	}
+	return nil
+}
+
+// ValidateRoles checks that every role exists and returns them without duplicates
+func (s *RoleService) ValidateRoles(ctx context.Context, roles []string) ([]string, error) {
+	roles = slices.Compact(slices.Sorted(slices.Values(roles)))
+	for _, role := range roles {
+		if err := s.ValidateRole(ctx, role); err != nil {
+			return nil, err
+		}
+	}
+	return roles, nil
+}
+
+// ListRoles returns every role with its permissions
+func (s *RoleService) ListRoles(ctx context.Context) ([]types.Role, error) {
+	return s.repo.ListRoles(ctx)
+}
+
+// ListPermissions returns every permission
+func (s *RoleService) ListPermissions(ctx context.Context) ([]types.Permission, error) {
+	return s.repo.ListPermissions(ctx)
+}
+
+// CreateRole creates a role with existing permissions and inherited roles (admin only)
+func (s *RoleService) CreateRole(ctx context.Context, req *types.CreateRoleRequest) (*types.Role, error) {
+	if !roleNamePattern.MatchString(req.Name) {
+		return nil, ErrInvalidRoleName
+	}
+
+	names := slices.Compact(slices.Sorted(slices.Values(req.Permissions)))
+	permissions := []types.Permission{}
+	if len(names) > 0 {
+		var err error
+		if permissions, err = s.repo.FindPermissionsByName(ctx, names); err != nil {
+			return nil, err
+		}
+		if len(permissions) != len(names) {
+			return nil, fmt.Errorf("%w: %s", ErrPermissionNotFound, missingPermission(names, permissions))
+		}
+	}
+
+	// A new role can't be inherited yet, so inheriting existing roles can't form a cycle
+	inherits, err := s.ValidateRoles(ctx, req.Inherits)
+	if err != nil {
+		return nil, err
+	}
+
+	role := &types.Role{
+		Name:        req.Name,
+		Description: req.Description,
+		Permissions: permissions,
+		Inherits:    inherits,
+	}
+	created, err := s.repo.CreateRole(ctx, role)
+	if err != nil {
+		return nil, err
+	}
+	if !created {
+		return nil, ErrRoleExists
+	}
+
+	s.reload(ctx)
+	s.logger.Info("Role created", "role", role.Name, "permissions", names, "inherits", inherits)
+	return role, nil
+}
+
+// CreatePermission creates a permission that roles can be granted (admin only)
+func (s *RoleService) CreatePermission(ctx context.Context, req *types.CreatePermissionRequest) (*types.Permission, error) {
+	if !permissionNamePattern.MatchString(req.Name) {
+		return nil, ErrInvalidPermissionName
+	}
+
+	permission := &types.Permission{Name: req.Name, Description: req.Description}
+	created, err := s.repo.CreatePermission(ctx, permission)
+	if err != nil {
+		return nil, err
+	}
+	if !created {
+		return nil, ErrPermissionExists
+	}
+
+	s.logger.Info("Permission created", "permission", permission.Name)
+	return permission, nil
+}
+
+// AddPermission grants a permission to a role (admin only)
+func (s *RoleService) AddPermission(ctx context.Context, roleName, permissionName string) error {
+	role, permission, err := s.rolePermission(ctx, roleName, permissionName)
+	if err != nil {
+		return err
+	}
+	if err := s.repo.AddRolePermission(ctx, role, permission); err != nil {
+		return err
+	}
+
+	s.reload(ctx)
+	s.logger.Info("Permission granted to role", "role", roleName, "permission", permissionName)
+	return nil
+}
+
+// RemovePermission revokes a permission from a role (admin only)
+func (s *RoleService) RemovePermission(ctx context.Context, roleName, permissionName string) error {
+	role, permission, err := s.rolePermission(ctx, roleName, permissionName)
+	if err != nil {
+		return err
+	}
+	if err := s.repo.RemoveRolePermission(ctx, role, permission); err != nil {
+		return err
+	}
+
+	s.reload(ctx)
+	s.logger.Info("Permission revoked from role", "role", roleName, "permission", permissionName)
+	return nil
+}
+
+// AddInheritance makes a role include another role and everything it includes (admin only)
+func (s *RoleService) AddInheritance(ctx context.Context, roleName, inheritedName string) error {
+	role, inherited, err := s.roleInheritance(ctx, roleName, inheritedName)
+	if err != nil {
+		return err
+	}
+
+	// Check against the latest graph so a cycle can't slip in from another instance's change
+	if err := s.Reload(ctx); err != nil {
+		return err
+	}
+	if s.createsCycle(roleName, inheritedName) {
+		return ErrRoleCycle
+	}
+
+	if err := s.repo.AddRoleInheritance(ctx, role, inherited); err != nil {
+		return err
+	}
+
+	s.reload(ctx)
+	s.logger.Info("Role inheritance added", "role", roleName, "inherits", inheritedName)
+	return nil
+}
+
+// createsCycle reports whether role inheriting inherited would make a role include itself
+func (s *RoleService) createsCycle(roleName, inheritedName string) bool {
+	return slices.Contains(s.EffectiveRoles([]string{inheritedName}), roleName)
+}
+
+// RemoveInheritance stops a role including another role (admin only)
+func (s *RoleService) RemoveInheritance(ctx context.Context, roleName, inheritedName string) error {
+	role, inherited, err := s.roleInheritance(ctx, roleName, inheritedName)
+	if err != nil {
+		return err
+	}
+	if err := s.repo.RemoveRoleInheritance(ctx, role, inherited); err != nil {
+		return err
+	}
+
+	s.reload(ctx)
+	s.logger.Info("Role inheritance removed", "role", roleName, "inherits", inheritedName)
+	return nil
+}
+
+// roleInheritance looks up the two roles of an inheritance link
+func (s *RoleService) roleInheritance(ctx context.Context, roleName, inheritedName string) (*types.Role, *types.Role, error) {
+	if roleName == inheritedName {
+		return nil, nil, ErrRoleCycle
+	}
+
+	var roles [2]*types.Role
+	for i, name := range []string{roleName, inheritedName} {
+		role, err := s.repo.FindRoleByName(ctx, name)
+		if err != nil {
+			return nil, nil, err
+		}
+		if role == nil {
+			return nil, nil, fmt.Errorf("%w: %s", ErrInvalidRole, name)
+		}
+		roles[i] = role
+	}
+	return roles[0], roles[1], nil
+}
+
+// rolePermission looks up a role and permission to change. The admin role's permissions can't be
+// changed: it holds "*", and narrowing it would only be confusing.
+func (s *RoleService) rolePermission(ctx context.Context, roleName, permissionName string) (*types.Role, *types.Permission, error) {
+	if roleName == types.RoleAdmin {
+		return nil, nil, ErrAdminRolePermissions
+	}
+
+	role, err := s.repo.FindRoleByName(ctx, roleName)
+	if err != nil {
+		return nil, nil, err
+	}
+	if role == nil {
+		return nil, nil, fmt.Errorf("%w: %s", ErrInvalidRole, roleName)
+	}
+
+	permissions, err := s.repo.FindPermissionsByName(ctx, []string{permissionName})
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(permissions) == 0 {
+		return nil, nil, fmt.Errorf("%w: %s", ErrPermissionNotFound, permissionName)
+	}
+	return role, &permissions[0], nil
+}
+
+// reload refreshes the cache after a change; a failure only delays the change until the next periodic reload
+func (s *RoleService) reload(ctx context.Context) {
+	if err := s.Reload(ctx); err != nil {
+		s.logger.Error("Failed to reload role permissions", "error", err)
+	}
+}
+
+// missingPermission returns the first name without a matching permission
+func missingPermission(names []string, found []types.Permission) string {
+	for _, name := range names {
+		if !slices.ContainsFunc(found, func(p types.Permission) bool { return p.Name == name }) {
+			return name
+		}
+	}
+	return ""
+}
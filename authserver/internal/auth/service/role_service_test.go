@@ -0,0 +1,69 @@
+package service
+
+import (
+	"slices"
+	"testing"
+)
+
+func testRoleService() *RoleService {
+	return &RoleService{
+		inherits: map[string][]string{
+			"admin":     {"moderator"},
+			"moderator": {"user"},
+			"user":      nil,
+			"billing":   {"user"},
+			"loop-a":    {"loop-b"},
+			"loop-b":    {"loop-a"},
+		},
+	}
+}
+
+func TestEffectiveRoles(t *testing.T) {
+	tests := []struct {
+		name  string
+		roles []string
+		want  []string
+	}{
+		{"no roles", nil, []string{}},
+		{"leaf role", []string{"user"}, []string{"user"}},
+		{"inherits transitively", []string{"admin"}, []string{"admin", "moderator", "user"}},
+		{"several roles share an inherited role", []string{"billing", "moderator"}, []string{"billing", "moderator", "user"}},
+		{"duplicates", []string{"user", "user"}, []string{"user"}},
+		{"unknown role", []string{"ghost"}, []string{"ghost"}},
+		{"cycle terminates", []string{"loop-a"}, []string{"loop-a", "loop-b"}},
+	}
+
+	s := testRoleService()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := s.EffectiveRoles(tt.roles); !slices.Equal(got, tt.want) {
+				t.Errorf("EffectiveRoles(%v) = %v, want %v", tt.roles, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCreatesCycle(t *testing.T) {
+	tests := []struct {
+		name      string
+		role      string
+		inherited string
+		want      bool
+	}{
+		{"itself", "admin", "admin", true},
+		{"direct parent", "user", "moderator", true},
+		{"indirect parent", "user", "admin", true},
+		{"unrelated role", "admin", "billing", false},
+		{"sibling", "billing", "moderator", false},
+		{"new role", "support", "user", false},
+	}
+
+	s := testRoleService()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := s.createsCycle(tt.role, tt.inherited); got != tt.want {
+				t.Errorf("createsCycle(%q, %q) = %v, want %v", tt.role, tt.inherited, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,210 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/simple-auth-roles/internal/types"
+	"github.com/simple-auth-roles/pkg/clientdetection"
+)
+
+var (
+	// ErrInvalidRefreshToken is returned for unknown, expired or revoked refresh tokens
+	ErrInvalidRefreshToken = errors.New("invalid refresh token")
+	// ErrRefreshTokenReused is returned when an already rotated refresh token is presented again
+	ErrRefreshTokenReused = errors.New("refresh token reuse detected")
+)
+
+// CreateSession issues an access token and starts a new refresh token family for the user
+func (s *AuthService) CreateSession(ctx context.Context, user *types.User, meta types.RequestMeta) (*types.AuthResponse, error) {
+	familyID, err := randomToken(16)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate token family: %w", err)
+	}
+
+	if meta.AuthTime.IsZero() {
+		meta.AuthTime = time.Now()
+	}
+	return s.issueTokens(ctx, user, familyID, meta)
+}
+
+// RefreshSession rotates a refresh token and returns a new token pair.
+// Presenting a refresh token that was already rotated revokes its whole family.
+func (s *AuthService) RefreshSession(ctx context.Context, refreshToken string, meta types.RequestMeta) (*types.AuthResponse, error) {
+	stored, err := s.tokenRepo.FindRefreshTokenByHash(ctx, hashToken(refreshToken))
+	if err != nil {
+		return nil, fmt.Errorf("failed to find refresh token: %w", err)
+	}
+	if stored == nil || stored.RevokedAt != nil {
+		return nil, ErrInvalidRefreshToken
+	}
+
+	// Tokens issued to an OAuth client can only be refreshed by that client
+	if stored.ClientID != meta.ClientID {
+		return nil, ErrInvalidRefreshToken
+	}
+
+	if stored.UsedAt != nil {
+		return nil, s.handleRefreshTokenReuse(ctx, stored)
+	}
+
+	if time.Now().After(stored.ExpiresAt) {
+		return nil, ErrInvalidRefreshToken
+	}
+
+	// Mark as used before issuing so two concurrent refreshes cannot both succeed
+	marked, err := s.tokenRepo.MarkRefreshTokenUsed(ctx, stored.ID)
+	if err != nil {
+		return nil, err
+	}
+	if !marked {
+		return nil, s.handleRefreshTokenReuse(ctx, stored)
+	}
+
+	user, err := s.userRepo.FindByID(ctx, stored.UserID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find user: %w", err)
+	}
+	if user == nil || !user.IsActive {
+		_ = s.tokenRepo.RevokeRefreshTokenFamily(ctx, stored.FamilyID)
+		return nil, ErrInvalidRefreshToken
+	}
+
+	// Rotation keeps the scope granted at sign-in, how the user authenticated and the active organization
+	meta.Scope = stored.Scope
+	meta.AuthTime = stored.AuthTime
+	meta.AMR = stored.AMR
+	meta.OrgID = stored.OrgID
+	response, err := s.issueTokens(ctx, user, stored.FamilyID, meta)
+	if err != nil {
+		return nil, err
+	}
+
+	s.logger.Info("Refresh token rotated", "user_id", user.ID, "family_id", stored.FamilyID)
+	return response, nil
+}
+
+// SwitchOrg issues a new token pair in the current session with org_id set to orgID, or without
+// org_id when it is nil. The user must belong to the organization. The new refresh token
+// replaces the session's current one.
+func (s *AuthService) SwitchOrg(ctx context.Context, user *types.User, claims *types.JWTClaims, orgID *uint, meta types.RequestMeta) (*types.AuthResponse, error) {
+	if orgID != nil {
+		if _, err := s.orgs.Membership(ctx, *orgID, user.ID); err != nil {
+			return nil, err
+		}
+	}
+
+	familyID, err := s.rotateSession(ctx, user, claims)
+	if err != nil {
+		return nil, err
+	}
+
+	meta.Scope = claims.Scope
+	meta.AuthTime = claims.AuthenticatedAt()
+	meta.AMR = claims.AMR
+	meta.OrgID = orgID
+	response, err := s.issueTokens(ctx, user, familyID, meta)
+	if err != nil {
+		return nil, err
+	}
+
+	s.logger.Info("Active organization switched", "user_id", user.ID, "org_id", orgID)
+	return response, nil
+}
+
+// rotateSession uses up the live refresh token of the access token's session and returns the
+// session's family, so the token pair issued next replaces it instead of adding another live
+// refresh token. Presenting the replaced token afterwards is treated as reuse.
+func (s *AuthService) rotateSession(ctx context.Context, user *types.User, claims *types.JWTClaims) (string, error) {
+	if claims.SessionID == "" {
+		return "", ErrInvalidRefreshToken
+	}
+	rotated, err := s.tokenRepo.MarkFamilyUsed(ctx, user.ID, claims.SessionID)
+	if err != nil {
+		return "", err
+	}
+	if !rotated {
+		return "", ErrInvalidRefreshToken
+	}
+	return claims.SessionID, nil
+}
+
+// handleRefreshTokenReuse revokes the token family after a replayed refresh token
+func (s *AuthService) handleRefreshTokenReuse(ctx context.Context, token *types.RefreshToken) error {
+	s.logger.Warn("Refresh token reuse detected, revoking family", "user_id", token.UserID, "family_id", token.FamilyID)
+	if err := s.tokenRepo.RevokeRefreshTokenFamily(ctx, token.FamilyID); err != nil {
+		return err
+	}
+	return ErrRefreshTokenReused
+}
+
+// issueTokens signs an access token and stores a new refresh token in the given family
+func (s *AuthService) issueTokens(ctx context.Context, user *types.User, familyID string, meta types.RequestMeta) (*types.AuthResponse, error) {
+	refreshToken, err := randomToken(32)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate refresh token: %w", err)
+	}
+
+	record := &types.RefreshToken{
+		UserID:     user.ID,
+		FamilyID:   familyID,
+		TokenHash:  hashToken(refreshToken),
+		ClientType: meta.ClientType,
+		ClientID:   meta.ClientID,
+		Scope:      meta.Scope,
+		IPAddress:  meta.IPAddress,
+		UserAgent:  meta.UserAgent,
+		ExpiresAt:  time.Now().Add(s.refreshExpiryFor(meta)),
+		AuthTime:   meta.AuthTime,
+		AMR:        meta.AMR,
+		OrgID:      meta.OrgID,
+	}
+
+	accessToken, err := s.generateJWT(user, record)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate token: %w", err)
+	}
+
+	if err := s.tokenRepo.CreateRefreshToken(ctx, record); err != nil {
+		return nil, err
+	}
+
+	return &types.AuthResponse{
+		User:         user,
+		Token:        accessToken,
+		RefreshToken: refreshToken,
+		ExpiresIn:    int64(s.jwtExpiry.Seconds()),
+		Scope:        record.Scope,
+		Message:      "Authentication successful",
+	}, nil
+}
+
+// refreshExpiryFor returns the refresh token lifetime for the requesting client.
+// Mobile apps keep their sessions longer since they cannot easily re-run the email flow.
+func (s *AuthService) refreshExpiryFor(meta types.RequestMeta) time.Duration {
+	if meta.ClientType == string(clientdetection.ClientTypeReactNative) {
+		return s.mobileRefreshExpiry
+	}
+	return s.refreshExpiry
+}
+
+// randomToken returns n random bytes encoded as unpadded base64url
+func randomToken(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// hashToken returns the hex SHA-256 digest used to store opaque tokens
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
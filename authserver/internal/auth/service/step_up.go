@@ -0,0 +1,82 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/simple-auth-roles/internal/types"
+)
+
+// ErrStepUpWrongUser is returned when a step-up passkey belongs to another account
+var ErrStepUpWrongUser = errors.New("passkey belongs to another account")
+
+// StepUpPolicy returns how recent, and by which methods, authentication must be for sensitive actions
+func (s *AuthService) StepUpPolicy() (time.Duration, []string) {
+	return s.login.StepUpMaxAge, s.login.StepUpMethods
+}
+
+// BeginPasskeyStepUp starts a passkey assertion for the signed-in user
+func (s *AuthService) BeginPasskeyStepUp(ctx context.Context, user *types.User) (*protocol.CredentialAssertion, string, error) {
+	return s.webauthnService.BeginLogin(ctx, user.Email)
+}
+
+// FinishPasskeyStepUp verifies the assertion and issues tokens with a fresh auth_time
+func (s *AuthService) FinishPasskeyStepUp(ctx context.Context, user *types.User, claims *types.JWTClaims, ceremonyID string, response *protocol.ParsedCredentialAssertionData, meta types.RequestMeta) (*types.AuthResponse, error) {
+	authenticated, err := s.webauthnService.FinishLogin(ctx, ceremonyID, response, meta)
+	if err != nil {
+		return nil, err
+	}
+	if authenticated.ID != user.ID {
+		s.logger.Warn("Step-up passkey belongs to another account", "user_id", user.ID, "passkey_user_id", authenticated.ID)
+		return nil, ErrStepUpWrongUser
+	}
+	return s.stepUp(ctx, user, claims, types.AMRPasskey, meta)
+}
+
+// VerifyEmailStepUp verifies a code sent with SendLoginCode and issues tokens with a fresh auth_time
+func (s *AuthService) VerifyEmailStepUp(ctx context.Context, user *types.User, claims *types.JWTClaims, nonce, code string, meta types.RequestMeta) (*types.AuthResponse, error) {
+	if _, err := s.checkAndUseLoginCode(ctx, user.Email, nonce, code, meta); err != nil {
+		return nil, err
+	}
+	s.clearLoginAttempts(ctx, user.Email)
+	return s.stepUp(ctx, user, claims, types.AMREmailCode, meta)
+}
+
+// stepUp issues a new token pair in the current session, recording the re-authentication.
+// The new refresh token replaces the session's current one.
+func (s *AuthService) stepUp(ctx context.Context, user *types.User, claims *types.JWTClaims, method string, meta types.RequestMeta) (*types.AuthResponse, error) {
+	familyID, err := s.rotateSession(ctx, user, claims)
+	if err != nil {
+		return nil, err
+	}
+
+	meta.Scope = claims.Scope
+	meta.AuthTime = time.Now()
+	meta.AMR = []string{method}
+	meta.OrgID = claims.OrgID
+	response, err := s.issueTokens(ctx, user, familyID, meta)
+	if err != nil {
+		return nil, err
+	}
+
+	s.logger.Info("User re-authenticated", "user_id", user.ID, "method", method)
+	return response, nil
+}
+
+// DeleteAccount signs the user out everywhere and deletes the account with its passkeys.
+// The last admin of an organization can't delete their account.
+func (s *AuthService) DeleteAccount(ctx context.Context, userID uint) error {
+	if err := s.orgs.CheckCanLeaveOrgs(ctx, userID); err != nil {
+		return err
+	}
+	if err := s.LogoutAll(ctx, userID); err != nil {
+		return err
+	}
+	if err := s.userRepo.DeleteWithCredentials(ctx, userID); err != nil {
+		return err
+	}
+	s.logger.Info("Account deleted", "user_id", userID)
+	return nil
+}
@@ -3,9 +3,12 @@ package service
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"strconv"
 	"strings"
 	"time"
+	"unicode/utf8"
 
 	"log/slog"
 
@@ -14,17 +17,43 @@ import (
 	"github.com/simple-auth-roles/internal/auth/repository"
 	"github.com/simple-auth-roles/internal/config"
 	"github.com/simple-auth-roles/internal/types"
+	"github.com/simple-auth-roles/pkg/authenticators"
 	"github.com/simple-auth-roles/pkg/cache"
+	"github.com/simple-auth-roles/pkg/email"
 )
 
+var (
+	// ErrUserNotFound is returned when registering a passkey for a user that does not exist
+	ErrUserNotFound = errors.New("user not found")
+	// ErrCredentialNotFound is returned when the user has no passkey with the given ID
+	ErrCredentialNotFound = errors.New("passkey not found")
+	// ErrInvalidCredentialName is returned for an empty or overlong passkey name
+	ErrInvalidCredentialName = fmt.Errorf("passkey name must be 1 to %d characters", maxCredentialNameLength)
+)
+
+// maxCredentialNameLength bounds user-chosen passkey names
+const maxCredentialNameLength = 64
+
 type WebAuthnService struct {
-	webauthn *webauthn.WebAuthn
-	userRepo *repository.UserRepository
-	cache    cache.CacheService
-	logger   *slog.Logger
+	webauthn       *webauthn.WebAuthn
+	userRepo       *repository.UserRepository
+	securityEvents *repository.SecurityEventRepository
+	roles          *RoleService
+	cache          cache.CacheService
+	emailService   email.EmailService
+	logger         *slog.Logger
+	residentKey    protocol.ResidentKeyRequirement
+
+	backupFlagPolicy string
+	metadata         *authenticators.Registry // nil when no metadata file is loaded
+	attestation      protocol.ConveyancePreference
+	policy           *attestationPolicy
+	cloneAction      string
+
+	passkeyRequiredRoles []string
 }
 
-func NewWebAuthnService(userRepo *repository.UserRepository, cache cache.CacheService, logger *slog.Logger, cfg *config.Config) *WebAuthnService {
+func NewWebAuthnService(userRepo *repository.UserRepository, securityEvents *repository.SecurityEventRepository, roles *RoleService, cache cache.CacheService, emailService email.EmailService, logger *slog.Logger, cfg *config.Config) *WebAuthnService {
 	webauthnConfig := &webauthn.Config{
 		RPDisplayName: cfg.WebAuthn.RPDisplayName,
 		RPID:          cfg.WebAuthn.RPID,
@@ -41,11 +70,37 @@ func NewWebAuthnService(userRepo *repository.UserRepository, cache cache.CacheSe
 		return nil
 	}
 
+	policy, err := newAttestationPolicy(cfg.WebAuthn)
+	if err != nil {
+		logger.Error("Failed to load WebAuthn attestation policy", "error", err)
+		return nil
+	}
+
+	// Authenticator names are optional, passkeys get a generic name without them
+	metadata, err := authenticators.Load(cfg.WebAuthn.AuthenticatorMetadataFile)
+	if err != nil {
+		logger.Warn("Authenticator metadata not loaded", "error", err)
+	} else {
+		logger.Info("Loaded authenticator metadata", "authenticators", metadata.Len())
+	}
+
 	return &WebAuthnService{
-		webauthn: webAuthn,
-		userRepo: userRepo,
-		cache:    cache,
-		logger:   logger.With("service", "webauthn"),
+		webauthn:       webAuthn,
+		userRepo:       userRepo,
+		securityEvents: securityEvents,
+		roles:          roles,
+		cache:          cache,
+		emailService:   emailService,
+		logger:         logger.With("service", "webauthn"),
+		residentKey:    protocol.ResidentKeyRequirement(cfg.WebAuthn.ResidentKey),
+
+		backupFlagPolicy: cfg.WebAuthn.BackupFlagPolicy,
+		metadata:         metadata,
+		attestation:      protocol.ConveyancePreference(cfg.WebAuthn.Attestation),
+		policy:           policy,
+		cloneAction:      cfg.WebAuthn.CloneAction,
+
+		passkeyRequiredRoles: cfg.WebAuthn.PasskeyRequiredRoles,
 	}
 }
 
@@ -55,8 +110,15 @@ func (s *WebAuthnService) BeginRegistration(ctx context.Context, userID uint) (*
 	if err != nil {
 		return nil, fmt.Errorf("failed to get user: %w", err)
 	}
+	if user == nil {
+		return nil, ErrUserNotFound
+	}
 
-	options, session, err := s.webauthn.BeginRegistration(user)
+	// Resident (discoverable) keys let the user sign in without typing an email
+	options, session, err := s.webauthn.BeginRegistration(user,
+		webauthn.WithResidentKeyRequirement(s.residentKey),
+		webauthn.WithConveyancePreference(s.attestation),
+	)
 	if err != nil {
 		return nil, fmt.Errorf("failed to begin registration: %w", err)
 	}
@@ -75,16 +137,24 @@ func (s *WebAuthnService) BeginRegistration(ctx context.Context, userID uint) (*
 	return options, nil
 }
 
-// FinishRegistration completes the WebAuthn registration process
-func (s *WebAuthnService) FinishRegistration(ctx context.Context, userID uint, response *protocol.ParsedCredentialCreationData) error {
+// FinishRegistration completes the WebAuthn registration process. An empty name uses the authenticator model.
+// A passkey registered by someone other than the user (an admin) is recorded as a security event.
+func (s *WebAuthnService) FinishRegistration(ctx context.Context, actorID, userID uint, name string, response *protocol.ParsedCredentialCreationData, meta types.RequestMeta) error {
 	user, err := s.userRepo.GetByID(ctx, userID)
 	if err != nil {
 		return fmt.Errorf("failed to get user: %w", err)
 	}
+	if user == nil {
+		return ErrUserNotFound
+	}
+	name = strings.TrimSpace(name)
+	if utf8.RuneCountInString(name) > maxCredentialNameLength {
+		return ErrInvalidCredentialName
+	}
 
-	// Retrieve session from cache
+	// Retrieve and remove the session from cache, so each challenge can be used once
 	cacheKey := fmt.Sprintf("webauthn_reg_session:%d", userID)
-	sessionData, err := s.cache.Get(ctx, cacheKey)
+	sessionData, err := s.cache.Take(ctx, cacheKey)
 	if err != nil {
 		s.logger.Error("Failed to get session from cache", "error", err, "userID", userID, "cacheKey", cacheKey)
 		return fmt.Errorf("failed to get session: %w", err)
@@ -112,114 +182,191 @@ func (s *WebAuthnService) FinishRegistration(ctx context.Context, userID uint, r
 	}
 
 	// Store credential in database
-	webauthnCred := &types.WebAuthnCredential{
-		UserID:       userID,
-		CredentialID: credential.ID,
-		PublicKey:    credential.PublicKey,
-		Counter:      credential.Authenticator.SignCount,
-		Name:         "Default Device",
+	model, authenticator := "Default Device", "This authenticator"
+	if info, ok := s.metadata.Lookup(credential.Authenticator.AAGUID); ok {
+		model, authenticator = info.Name, info.Name
+	}
+	if name == "" {
+		name = model
+	}
+
+	// Reject authenticators the user's roles may not use
+	if err := s.policy.check(s.roles.EffectiveRoles(user.Roles), credential, response.Response.AttestationObject, authenticator); err != nil {
+		s.logger.Warn("Passkey rejected by attestation policy", "error", err, "userID", userID, "authenticator", model)
+		return err
 	}
+	webauthnCred := types.NewWebAuthnCredential(userID, name, credential)
 
 	if err := s.userRepo.CreateWebAuthnCredential(ctx, webauthnCred); err != nil {
 		return fmt.Errorf("failed to store credential: %w", err)
 	}
 
-	// Clear session from cache
-	s.cache.Delete(ctx, cacheKey)
-
 	s.logger.Info("Registration completed successfully", "userID", userID, "credentialID", credential.ID)
+	if actorID != userID {
+		s.roles.audit(ctx, userID, types.SecurityEventPasskeyAddedByAdmin, map[string]any{
+			"credential_id": webauthnCred.ID,
+			"name":          webauthnCred.Name,
+			"added_by":      actorID,
+		}, meta)
+	}
 	return nil
 }
 
-// BeginLogin starts the WebAuthn login process
-func (s *WebAuthnService) BeginLogin(ctx context.Context, email string) (*protocol.CredentialAssertion, error) {
-	user, err := s.userRepo.FindByEmail(ctx, email)
-	if err != nil {
-		return nil, fmt.Errorf("failed to find user: %w", err)
-	}
+// BeginLogin starts the WebAuthn login process and returns the ceremony ID to finish it with.
+// Without an email it starts a discoverable login where the passkey identifies the user.
+func (s *WebAuthnService) BeginLogin(ctx context.Context, email string) (*protocol.CredentialAssertion, string, error) {
+	var (
+		options *protocol.CredentialAssertion
+		session *webauthn.SessionData
+		err     error
+	)
+
+	if email == "" {
+		options, session, err = s.webauthn.BeginDiscoverableLogin()
+		if err != nil {
+			s.logger.Error("Failed to begin discoverable login", "error", err)
+			return nil, "", fmt.Errorf("failed to begin login: %w", err)
+		}
+	} else {
+		user, err := s.userRepo.FindByEmail(ctx, email)
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to find user: %w", err)
+		}
 
-	if user == nil {
-		return nil, fmt.Errorf("user not found")
-	}
+		if user == nil {
+			return nil, "", fmt.Errorf("user not found")
+		}
 
-	s.logger.Info("Found user for login", "userID", user.ID, "email", user.Email)
+		s.logger.Info("Found user for login", "userID", user.ID, "email", user.Email)
 
-	// Load user's credentials
-	if err := s.userRepo.LoadWebAuthnCredentials(ctx, user); err != nil {
-		s.logger.Error("Failed to load credentials", "error", err, "userID", user.ID)
-		return nil, fmt.Errorf("failed to load credentials: %w", err)
-	}
+		// Load user's credentials
+		if err := s.userRepo.LoadWebAuthnCredentials(ctx, user); err != nil {
+			s.logger.Error("Failed to load credentials", "error", err, "userID", user.ID)
+			return nil, "", fmt.Errorf("failed to load credentials: %w", err)
+		}
 
-	s.logger.Info("Loaded credentials", "userID", user.ID, "credentialCount", len(user.WebAuthnCredentialsData))
+		s.logger.Info("Loaded credentials", "userID", user.ID, "credentialCount", len(user.WebAuthnCredentialsData))
 
-	options, session, err := s.webauthn.BeginLogin(user)
-	if err != nil {
-		s.logger.Error("Failed to begin login", "error", err, "userID", user.ID)
-		return nil, fmt.Errorf("failed to begin login: %w", err)
+		options, session, err = s.webauthn.BeginLogin(user)
+		if err != nil {
+			s.logger.Error("Failed to begin login", "error", err, "userID", user.ID)
+			return nil, "", fmt.Errorf("failed to begin login: %w", err)
+		}
 	}
 
-	// Store session in cache
+	// Store session in cache under a random ceremony ID, not the user, so
+	// concurrent logins don't overwrite each other
 	sessionData, err := json.Marshal(session)
 	if err != nil {
-		return nil, fmt.Errorf("failed to marshal session: %w", err)
-	}
-
-	cacheKey := fmt.Sprintf("webauthn_login_session:%d", user.ID)
-	if err := s.cache.Set(ctx, cacheKey, string(sessionData), 5*time.Minute); err != nil {
-		return nil, fmt.Errorf("failed to store session: %w", err)
+		return nil, "", fmt.Errorf("failed to marshal session: %w", err)
 	}
 
-	return options, nil
-}
-
-// FinishLogin completes the WebAuthn login process
-func (s *WebAuthnService) FinishLogin(ctx context.Context, userID uint, response *protocol.ParsedCredentialAssertionData) (*types.User, error) {
-	user, err := s.userRepo.GetByID(ctx, userID)
+	ceremonyID, err := randomToken(16)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get user: %w", err)
+		return nil, "", fmt.Errorf("failed to generate ceremony ID: %w", err)
 	}
 
-	// Load user's credentials
-	if err := s.userRepo.LoadWebAuthnCredentials(ctx, user); err != nil {
-		return nil, fmt.Errorf("failed to load credentials: %w", err)
+	if err := s.cache.Set(ctx, loginSessionKey(ceremonyID), string(sessionData), 5*time.Minute); err != nil {
+		return nil, "", fmt.Errorf("failed to store session: %w", err)
 	}
 
-	// Retrieve session from cache
-	cacheKey := fmt.Sprintf("webauthn_login_session:%d", userID)
-	sessionData, err := s.cache.Get(ctx, cacheKey)
+	return options, ceremonyID, nil
+}
+
+// FinishLogin completes the WebAuthn login process started with the given ceremony ID
+func (s *WebAuthnService) FinishLogin(ctx context.Context, ceremonyID string, response *protocol.ParsedCredentialAssertionData, meta types.RequestMeta) (*types.User, error) {
+	// Retrieve session from cache; each ceremony can be finished once
+	cacheKey := loginSessionKey(ceremonyID)
+	sessionData, err := s.cache.Take(ctx, cacheKey)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get session: %w", err)
 	}
+	if sessionData == "" {
+		return nil, fmt.Errorf("session not found or expired")
+	}
 
 	var session webauthn.SessionData
 	if err := json.Unmarshal([]byte(sessionData), &session); err != nil {
 		return nil, fmt.Errorf("failed to unmarshal session: %w", err)
 	}
 
-	credential, err := s.webauthn.ValidateLogin(user, session, response)
+	// A discoverable login has no user in the session; the authenticator returns it as the user handle
+	discoverable := len(session.UserID) == 0
+	userHandle := session.UserID
+	if discoverable {
+		userHandle = response.Response.UserHandle
+	}
+
+	user, err := s.userFromHandle(ctx, userHandle)
 	if err != nil {
-		// Check if this is a BackupEligible flag inconsistency error
-		if strings.Contains(err.Error(), "BackupEligible flag inconsistency") {
-			s.logger.Warn("BackupEligible flag inconsistency detected, attempting manual validation", "userID", userID, "error", err)
-
-			// Perform manual validation without strict flag checking
-			credential, err = s.validateLoginManually(user, session, response)
-			if err != nil {
-				return nil, fmt.Errorf("failed to finish login with manual validation: %w", err)
-			}
-		} else {
-			return nil, fmt.Errorf("failed to finish login: %w", err)
+		return nil, err
+	}
+
+	stored := findCredential(user, response.RawID)
+	if stored != nil && stored.DisabledAt != nil {
+		return nil, &PasskeyLoginError{Code: PasskeyErrorDisabled, Message: "This passkey has been disabled, sign in with an email code"}
+	}
+
+	backupEligible, err := s.applyBackupFlagPolicy(user, stored, response)
+	if err != nil {
+		return nil, err
+	}
+
+	var credential *webauthn.Credential
+	if discoverable {
+		credential, err = s.webauthn.ValidateDiscoverableLogin(func(_, _ []byte) (webauthn.User, error) {
+			return user, nil
+		}, session, response)
+	} else {
+		credential, err = s.webauthn.ValidateLogin(user, session, response)
+	}
+	if err != nil {
+		s.logger.Warn("Failed to validate login", "error", err, "userID", user.ID)
+		return nil, fmt.Errorf("failed to finish login: %w", err)
+	}
+
+	// A sign counter that goes backwards means the private key may have been copied
+	if credential.Authenticator.CloneWarning {
+		if err := s.handleClonedCredential(ctx, user, stored, response.Response.AuthenticatorData.Counter, meta); err != nil {
+			return nil, err
 		}
+	} else if stored.CloneWarning && s.cloneAction == CloneActionStepUp {
+		return nil, stepUpRequired(user, stored, credential.Authenticator.SignCount)
+	}
+
+	// Update credential counter and flags
+	credential.Flags.BackupEligible = backupEligible
+	if err := s.userRepo.UpdateWebAuthnCredentialAfterLogin(ctx, credential.ID, credential.Authenticator.SignCount, credential.Flags, meta); err != nil {
+		s.logger.Warn("Failed to update credential", "error", err)
+	}
+
+	return user, nil
+}
+
+// userFromHandle loads the user, with credentials, that a WebAuthn user handle refers to
+func (s *WebAuthnService) userFromHandle(ctx context.Context, userHandle []byte) (*types.User, error) {
+	if len(userHandle) == 0 {
+		return nil, fmt.Errorf("passkey did not return a user handle")
 	}
 
-	// Update credential counter
-	if err := s.userRepo.UpdateWebAuthnCredentialCounter(ctx, credential.ID, credential.Authenticator.SignCount); err != nil {
-		s.logger.Warn("Failed to update credential counter", "error", err)
+	// User handles are the decimal user ID, see User.WebAuthnID
+	userID, err := strconv.ParseUint(string(userHandle), 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid user handle")
 	}
 
-	// Clear session from cache
-	s.cache.Delete(ctx, cacheKey)
+	user, err := s.userRepo.GetByID(ctx, uint(userID))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user: %w", err)
+	}
+	if user == nil || !user.IsActive {
+		return nil, fmt.Errorf("user not found")
+	}
 
+	// Load user's credentials
+	if err := s.userRepo.LoadWebAuthnCredentials(ctx, user); err != nil {
+		return nil, fmt.Errorf("failed to load credentials: %w", err)
+	}
 	return user, nil
 }
 
@@ -242,52 +389,114 @@ func (s *WebAuthnService) HasWebAuthnCredentials(ctx context.Context, email stri
 	return count > 0, nil
 }
 
-// ListCredentials returns all WebAuthn credentials for a user
-func (s *WebAuthnService) ListCredentials(ctx context.Context, userID uint) ([]types.WebAuthnCredential, error) {
-	return s.userRepo.ListWebAuthnCredentials(ctx, userID)
-}
+// ListCredentials returns all WebAuthn credentials for a user with their authenticator names
+func (s *WebAuthnService) ListCredentials(ctx context.Context, userID uint) ([]types.CredentialResponse, error) {
+	creds, err := s.userRepo.ListWebAuthnCredentials(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
 
-// DeleteCredential deletes a WebAuthn credential for a user
-func (s *WebAuthnService) DeleteCredential(ctx context.Context, userID uint, credentialID []byte) error {
-	return s.userRepo.DeleteWebAuthnCredential(ctx, userID, credentialID)
+	response := make([]types.CredentialResponse, len(creds))
+	for i := range creds {
+		response[i] = creds[i].ToResponse()
+		if info, ok := s.metadata.Lookup(creds[i].AAGUID); ok {
+			response[i].ProviderName = info.Name
+			response[i].ProviderIconLight = info.IconLight
+			response[i].ProviderIconDark = info.IconDark
+		}
+	}
+	return response, nil
 }
 
-// validateLoginManually performs manual validation without strict BackupEligible flag checking
-func (s *WebAuthnService) validateLoginManually(user *types.User, _ webauthn.SessionData, response *protocol.ParsedCredentialAssertionData) (*webauthn.Credential, error) {
-	// Find the credential by ID
-	var matchingCred *types.WebAuthnCredential
-	for _, cred := range user.WebAuthnCredentialsData {
-		if string(cred.CredentialID) == string(response.RawID) {
-			matchingCred = &cred
-			break
-		}
+// RenameCredential changes the name of one of the user's passkeys
+func (s *WebAuthnService) RenameCredential(ctx context.Context, userID uint, credentialID []byte, name string) error {
+	name = strings.TrimSpace(name)
+	if name == "" || utf8.RuneCountInString(name) > maxCredentialNameLength {
+		return ErrInvalidCredentialName
 	}
 
-	if matchingCred == nil {
-		return nil, fmt.Errorf("credential not found")
+	found, err := s.userRepo.RenameWebAuthnCredential(ctx, userID, credentialID, name)
+	if err != nil {
+		return err
+	}
+	if !found {
+		return ErrCredentialNotFound
 	}
+	return nil
+}
 
-	// Create a webauthn.Credential from our stored credential
-	credential := &webauthn.Credential{
-		ID:              matchingCred.CredentialID,
-		PublicKey:       matchingCred.PublicKey,
-		AttestationType: "none",
-		Authenticator: webauthn.Authenticator{
-			AAGUID:    make([]byte, 16),
-			SignCount: matchingCred.Counter,
-		},
+// DeleteCredential deletes a WebAuthn credential for a user. Unless allowLast is set (admins
+// recovering an account), the last usable passkey of an account that requires one is kept.
+func (s *WebAuthnService) DeleteCredential(ctx context.Context, userID uint, credentialID []byte, allowLast bool) error {
+	user, err := s.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		return fmt.Errorf("failed to get user: %w", err)
+	}
+	if user == nil {
+		return ErrUserNotFound
+	}
+	creds, err := s.userRepo.ListWebAuthnCredentials(ctx, userID)
+	if err != nil {
+		return err
 	}
 
-	// Perform basic signature verification without strict flag checking
-	// This is a simplified validation - in production you might want more thorough checks
-	if len(response.Response.Signature) == 0 {
-		return nil, fmt.Errorf("invalid signature")
+	if err := s.checkDeleteCredential(user, creds, credentialID); err != nil {
+		var policyErr *CredentialPolicyError
+		if !allowLast || !errors.As(err, &policyErr) {
+			return err
+		}
+		s.logger.Warn("Deleting last passkey of an account that requires one", "userID", userID)
 	}
+	return s.userRepo.DeleteWebAuthnCredential(ctx, userID, credentialID)
+}
 
-	// Update the credential counter
-	credential.Authenticator.SignCount = response.Response.AuthenticatorData.Counter
+// applyBackupFlagPolicy handles an assertion whose backup eligible (BE) flag differs from the
+// stored credential. The library rejects any change, so for accept and warn the loaded
+// credential takes the asserted flag and the assertion is still fully verified. Credentials
+// stored before BE was recorded have none, and adopt the asserted flag on their first login.
+// It returns the BE flag to store after a successful login.
+func (s *WebAuthnService) applyBackupFlagPolicy(user *types.User, cred *types.WebAuthnCredential, response *protocol.ParsedCredentialAssertionData) (bool, error) {
+	asserted := response.Response.AuthenticatorData.Flags.HasBackupEligible()
+
+	// Unknown credential, the library rejects it
+	if cred == nil {
+		return asserted, nil
+	}
+	if cred.BackupEligible == nil {
+		s.logger.Info("Recording BackupEligible flag of passkey", "userID", user.ID, "credentialID", cred.ID, "asserted", asserted)
+		cred.BackupEligible = &asserted
+		return asserted, nil
+	}
+	stored := *cred.BackupEligible
+	if stored == asserted {
+		return asserted, nil
+	}
+
+	switch s.backupFlagPolicy {
+	case "reject":
+		s.logger.Warn("Rejected login with changed BackupEligible flag", "userID", user.ID, "credentialID", cred.ID, "stored", stored, "asserted", asserted)
+		return false, fmt.Errorf("passkey backup eligibility changed")
+	case "warn":
+		s.logger.Warn("BackupEligible flag changed, keeping stored value", "userID", user.ID, "credentialID", cred.ID, "stored", stored, "asserted", asserted)
+		cred.BackupEligible = &asserted
+		return stored, nil
+	default:
+		s.logger.Info("BackupEligible flag changed, updating stored value", "userID", user.ID, "credentialID", cred.ID, "stored", stored, "asserted", asserted)
+		cred.BackupEligible = &asserted
+		return asserted, nil
+	}
+}
 
-	s.logger.Info("Manual WebAuthn validation successful", "userID", user.ID, "credentialID", string(matchingCred.CredentialID))
+// findCredential returns the user's stored credential with the given ID
+func findCredential(user *types.User, credentialID []byte) *types.WebAuthnCredential {
+	for i := range user.WebAuthnCredentialsData {
+		if string(user.WebAuthnCredentialsData[i].CredentialID) == string(credentialID) {
+			return &user.WebAuthnCredentialsData[i]
+		}
+	}
+	return nil
+}
 
-	return credential, nil
+func loginSessionKey(ceremonyID string) string {
+	return fmt.Sprintf("webauthn_login_session:%s", ceremonyID)
 }
@@ -0,0 +1,70 @@
+package service
+
+import (
+	"io"
+	"log/slog"
+	"testing"
+
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/simple-auth-roles/internal/types"
+)
+
+func TestApplyBackupFlagPolicy(t *testing.T) {
+	yes, no := true, false
+	tests := []struct {
+		name     string
+		policy   string
+		stored   *bool
+		asserted bool
+		want     bool // BE flag to store
+		wantErr  bool
+	}{
+		{"unchanged", "reject", &yes, true, true, false},
+		{"unchanged false", "reject", &no, false, false, false},
+		{"unknown adopts asserted under accept", "accept", nil, true, true, false},
+		{"unknown adopts asserted under reject", "reject", nil, true, true, false},
+		{"unknown adopts asserted false", "warn", nil, false, false, false},
+		{"changed under accept", "accept", &no, true, true, false},
+		{"changed under warn keeps stored", "warn", &no, true, false, false},
+		{"changed under reject", "reject", &yes, false, false, true},
+	}
+
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &WebAuthnService{logger: logger, backupFlagPolicy: tt.policy}
+			cred := &types.WebAuthnCredential{ID: 1, BackupEligible: tt.stored}
+			response := &protocol.ParsedCredentialAssertionData{}
+			if tt.asserted {
+				response.Response.AuthenticatorData.Flags = protocol.FlagUserPresent | protocol.FlagBackupEligible
+			}
+
+			got, err := s.applyBackupFlagPolicy(&types.User{ID: 1}, cred, response)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("applyBackupFlagPolicy() accepted the login")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("applyBackupFlagPolicy() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("applyBackupFlagPolicy() = %v, want %v", got, tt.want)
+			}
+			// The library verifies the assertion against the loaded credential, which must match it
+			if cred.BackupEligible == nil || *cred.BackupEligible != tt.asserted {
+				t.Errorf("loaded credential BackupEligible = %v, want %v", cred.BackupEligible, tt.asserted)
+			}
+		})
+	}
+
+	t.Run("unknown credential", func(t *testing.T) {
+		s := &WebAuthnService{logger: logger, backupFlagPolicy: "reject"}
+		response := &protocol.ParsedCredentialAssertionData{}
+		response.Response.AuthenticatorData.Flags = protocol.FlagBackupEligible
+		if got, err := s.applyBackupFlagPolicy(&types.User{ID: 1}, nil, response); err != nil || !got {
+			t.Errorf("applyBackupFlagPolicy() = %v, %v, want true, nil", got, err)
+		}
+	})
+}
@@ -15,6 +15,10 @@ type Config struct {
 	JWT      JWTConfig
 	Email    EmailConfig
 	WebAuthn WebAuthnConfig
+	OIDC     OIDCConfig
+	Login    LoginConfig
+	Roles    RolesConfig
+	Orgs     OrgsConfig
 }
 
 type ServerConfig struct {
@@ -24,6 +28,9 @@ type ServerConfig struct {
 	WriteTimeout    time.Duration
 	ShutdownTimeout time.Duration
 	Environment     string
+	// TrustedProxies are the proxy IPs or CIDRs whose X-Forwarded-For header gives the client IP;
+	// with none the connection's address is used
+	TrustedProxies []string
 }
 
 type DatabaseConfig struct {
@@ -41,8 +48,14 @@ type RedisConfig struct {
 }
 
 type JWTConfig struct {
-	Secret     string
-	Expiration time.Duration
+	Secret                  string
+	SigningAlgorithm        string // HS256, RS256, ES256 or EdDSA
+	PrivateKeyFile          string // PEM private key for asymmetric algorithms, generated if missing
+	KeyEncryptionKey        string // Encrypts signing keys stored in the database
+	KeyRetirementPeriod     time.Duration
+	Expiration              time.Duration
+	RefreshExpiration       time.Duration
+	MobileRefreshExpiration time.Duration
 }
 
 type EmailConfig struct {
@@ -51,10 +64,73 @@ type EmailConfig struct {
 	ResendAPIKey string
 }
 
+type LoginConfig struct {
+	CodeHMACKey      string // Login codes are stored as an HMAC under this key, never in plaintext
+	CodeTTL          time.Duration
+	MaxCodeAttempts  int           // Failed guesses before the code is invalidated
+	MaxIPAttempts    int           // Failed guesses from one IP, across emails, before it is locked out
+	AttemptWindow    time.Duration // How long failed attempts are remembered
+	LockoutDuration  time.Duration // First lockout; doubles on each repeat
+	MaxLockout       time.Duration
+	LockoutResetTime time.Duration // Lockouts stop escalating after this long without one
+
+	MagicLinkURL  string            // Front-end page that exchanges magic link tokens
+	MagicLinkURLs map[string]string // Per front-end origin overrides of MagicLinkURL
+	ApproveURL    string            // Front-end page that approves a login from another device
+
+	StepUpMaxAge  time.Duration // Sensitive actions need an authentication at most this old
+	StepUpMethods []string      // amr values that count for sensitive actions (hwk, otp), any when empty
+
+	OpenSignup bool // Login codes create accounts for any email; when false only for invited emails
+}
+
+type RolesConfig struct {
+	ElevationMaxDuration time.Duration // Longest time a user can request a role for
+	ElevationRequestTTL  time.Duration // How long an elevation request waits for review before it lapses
+}
+
+type OrgsConfig struct {
+	InvitationURL string        // Front-end page that accepts invite links
+	InvitationTTL time.Duration // How long an invite link stays valid; resending restarts it
+	// Invitation emails (new or resent) one user may send per InvitationWindow
+	InvitationLimit  int
+	InvitationWindow time.Duration
+}
+
+type OIDCConfig struct {
+	Enabled           bool          // Serve the OpenID Connect provider; needs an RS256 or ES256 signing key
+	Issuer            string        // Public base URL of this server
+	LoginURL          string        // Front-end page that signs the user in for /authorize
+	AuthRequestTTL    time.Duration // How long the user has to sign in
+	AuthCodeTTL       time.Duration
+	IDTokenExpiration time.Duration
+
+	DeviceVerificationURL string // Front-end page where users enter device codes
+	DeviceCodeTTL         time.Duration
+	DevicePollInterval    time.Duration // Minimum time between token polls
+}
+
 type WebAuthnConfig struct {
-	RPID        string
-	RPOrigins   []string
+	RPID          string
+	RPOrigins     []string
 	RPDisplayName string
+	ResidentKey   string // required, preferred or discouraged; required makes every new passkey usable without an email
+
+	// What to do when a login reports a different backup eligible (BE) flag
+	// than the stored credential: accept (and update), warn or reject
+	BackupFlagPolicy string
+
+	AuthenticatorMetadataFile string // Community AAGUID JSON or FIDO MDS3 blob naming authenticator models
+	AuthenticatorMetadataURL  string // Where -refresh-authenticator-metadata downloads the file from
+
+	Attestation                 string              // Conveyance preference: none, indirect, direct or enterprise
+	AttestationTrustAnchorsFile string              // PEM roots that every new passkey's attestation must chain to
+	AAGUIDAllowlist             map[string][]string // Role ("*" for any) to the only authenticator models it may register
+	AAGUIDDenylist              map[string][]string // Role ("*" for any) to authenticator models it may not register
+
+	CloneAction string // When a sign counter goes backwards: allow, step_up (email code) or disable
+
+	PasskeyRequiredRoles []string // Roles whose accounts may not delete their last usable passkey
 }
 
 func Load() (*Config, error) {
@@ -66,6 +142,7 @@ func Load() (*Config, error) {
 			WriteTimeout:    getEnvAsDuration("WRITE_TIMEOUT", "30s"),
 			ShutdownTimeout: getEnvAsDuration("SHUTDOWN_TIMEOUT", "30s"),
 			Environment:     getEnv("ENVIRONMENT", "development"),
+			TrustedProxies:  trimAll(getEnvAsSlice("TRUSTED_PROXIES", nil)),
 		},
 		Database: DatabaseConfig{
 			URL:             getEnv("DATABASE_URL", "postgres://localhost/simple_auth_roles?sslmode=disable"),
@@ -80,8 +157,14 @@ func Load() (*Config, error) {
 			DB:       getEnvAsInt("REDIS_DB", 0),
 		},
 		JWT: JWTConfig{
-			Secret:     getEnv("JWT_SECRET", "your-super-secret-jwt-key-change-in-production"),
-			Expiration: getEnvAsDuration("JWT_EXPIRATION", "7d"),
+			Secret:                  getEnv("JWT_SECRET", "your-super-secret-jwt-key-change-in-production"),
+			SigningAlgorithm:        getEnv("JWT_SIGNING_ALG", "ES256"),
+			PrivateKeyFile:          getEnv("JWT_PRIVATE_KEY_FILE", "keys/jwt_signing_key.pem"),
+			KeyEncryptionKey:        getEnv("KEY_ENCRYPTION_KEY", "your-key-encryption-key-change-in-production"),
+			KeyRetirementPeriod:     getEnvAsDuration("JWT_KEY_RETIREMENT_PERIOD", "24h"),
+			Expiration:              getEnvAsDuration("JWT_EXPIRATION", "15m"),
+			RefreshExpiration:       getEnvAsDuration("JWT_REFRESH_EXPIRATION", "720h"),
+			MobileRefreshExpiration: getEnvAsDuration("JWT_MOBILE_REFRESH_EXPIRATION", "2160h"),
 		},
 		Email: EmailConfig{
 			FromEmail:    getEnv("FROM_EMAIL", "auth@yourapp.com"),
@@ -92,13 +175,117 @@ func Load() (*Config, error) {
 			RPID:          getEnv("WEBAUTHN_RPID", "localhost"),
 			RPOrigins:     getEnvAsSlice("WEBAUTHN_RP_ORIGINS", []string{"http://localhost:3000"}),
 			RPDisplayName: getEnv("WEBAUTHN_RP_DISPLAY_NAME", "Auth Template"),
+			ResidentKey:   getEnv("WEBAUTHN_RESIDENT_KEY", "preferred"),
+
+			BackupFlagPolicy: getEnv("WEBAUTHN_BACKUP_FLAG_POLICY", "accept"),
+
+			AuthenticatorMetadataFile: getEnv("WEBAUTHN_AUTHENTICATOR_METADATA_FILE", "data/authenticator_aaguids.json"),
+			AuthenticatorMetadataURL:  getEnv("WEBAUTHN_AUTHENTICATOR_METADATA_URL", "https://raw.githubusercontent.com/passkeydeveloper/passkey-authenticator-aaguids/main/combined_aaguid.json"),
+
+			Attestation:                 getEnv("WEBAUTHN_ATTESTATION", "none"),
+			AttestationTrustAnchorsFile: getEnv("WEBAUTHN_ATTESTATION_TRUST_ANCHORS_FILE", ""),
+			AAGUIDAllowlist:             getEnvAsListMap("WEBAUTHN_AAGUID_ALLOWLIST"),
+			AAGUIDDenylist:              getEnvAsListMap("WEBAUTHN_AAGUID_DENYLIST"),
+
+			CloneAction: getEnv("WEBAUTHN_CLONE_ACTION", "step_up"),
+
+			PasskeyRequiredRoles: getEnvAsSlice("WEBAUTHN_PASSKEY_REQUIRED_ROLES", nil),
+		},
+		Login: LoginConfig{
+			CodeHMACKey:      getEnv("LOGIN_CODE_HMAC_KEY", "your-login-code-hmac-key-change-in-production"),
+			CodeTTL:          getEnvAsDuration("LOGIN_CODE_TTL", "10m"),
+			MaxCodeAttempts:  getEnvAsInt("LOGIN_MAX_CODE_ATTEMPTS", 5),
+			MaxIPAttempts:    getEnvAsInt("LOGIN_MAX_IP_ATTEMPTS", 20),
+			AttemptWindow:    getEnvAsDuration("LOGIN_ATTEMPT_WINDOW", "15m"),
+			LockoutDuration:  getEnvAsDuration("LOGIN_LOCKOUT_DURATION", "1m"),
+			MaxLockout:       getEnvAsDuration("LOGIN_MAX_LOCKOUT", "1h"),
+			LockoutResetTime: getEnvAsDuration("LOGIN_LOCKOUT_RESET_TIME", "24h"),
+
+			MagicLinkURL:  getEnv("LOGIN_MAGIC_LINK_URL", "http://localhost:3000/login/magic"),
+			MagicLinkURLs: getEnvAsMap("LOGIN_MAGIC_LINK_URLS", map[string]string{}),
+			ApproveURL:    getEnv("LOGIN_APPROVE_URL", "http://localhost:3000/login/approve"),
+
+			StepUpMaxAge:  getEnvAsDuration("LOGIN_STEP_UP_MAX_AGE", "5m"),
+			StepUpMethods: getEnvAsSlice("LOGIN_STEP_UP_METHODS", nil),
+
+			OpenSignup: getEnv("LOGIN_OPEN_SIGNUP", "true") == "true",
+		},
+		Roles: RolesConfig{
+			ElevationMaxDuration: getEnvAsDuration("ROLE_ELEVATION_MAX_DURATION", "24h"),
+			ElevationRequestTTL:  getEnvAsDuration("ROLE_ELEVATION_REQUEST_TTL", "24h"),
+		},
+		Orgs: OrgsConfig{
+			InvitationURL:    getEnv("ORG_INVITATION_URL", "http://localhost:3000/invitations/accept"),
+			InvitationTTL:    getEnvAsDuration("ORG_INVITATION_TTL", "168h"),
+			InvitationLimit:  getEnvAsInt("ORG_INVITATION_LIMIT", 20),
+			InvitationWindow: getEnvAsDuration("ORG_INVITATION_WINDOW", "1h"),
+		},
+		OIDC: OIDCConfig{
+			Enabled:           getEnv("OIDC_ENABLED", "true") == "true",
+			Issuer:            strings.TrimSuffix(getEnv("OIDC_ISSUER", "http://localhost:8080"), "/"),
+			LoginURL:          getEnv("OIDC_LOGIN_URL", "http://localhost:3000/login"),
+			AuthRequestTTL:    getEnvAsDuration("OIDC_AUTH_REQUEST_TTL", "10m"),
+			AuthCodeTTL:       getEnvAsDuration("OIDC_AUTH_CODE_TTL", "1m"),
+			IDTokenExpiration: getEnvAsDuration("OIDC_ID_TOKEN_EXPIRATION", "1h"),
+
+			DeviceVerificationURL: getEnv("OIDC_DEVICE_VERIFICATION_URL", "http://localhost:3000/device"),
+			DeviceCodeTTL:         getEnvAsDuration("OIDC_DEVICE_CODE_TTL", "10m"),
+			DevicePollInterval:    getEnvAsDuration("OIDC_DEVICE_POLL_INTERVAL", "5s"),
 		},
 	}
 
 	// Validate required config
-	if config.JWT.Secret == "your-super-secret-jwt-key-change-in-production" && config.IsProduction() {
+	if config.JWT.SigningAlgorithm == "HS256" && config.JWT.Secret == "your-super-secret-jwt-key-change-in-production" && config.IsProduction() {
 		return nil, fmt.Errorf("JWT_SECRET must be set in production")
 	}
+	// Relying parties verify ID tokens with the published public keys; a shared secret can't be published
+	if config.OIDC.Enabled && config.JWT.SigningAlgorithm != "RS256" && config.JWT.SigningAlgorithm != "ES256" {
+		return nil, fmt.Errorf("the OpenID Connect provider needs JWT_SIGNING_ALG=RS256 or ES256; set OIDC_ENABLED=false to use %s", config.JWT.SigningAlgorithm)
+	}
+	if config.JWT.KeyEncryptionKey == "your-key-encryption-key-change-in-production" && config.IsProduction() {
+		return nil, fmt.Errorf("KEY_ENCRYPTION_KEY must be set in production")
+	}
+	if config.Login.CodeHMACKey == "your-login-code-hmac-key-change-in-production" && config.IsProduction() {
+		return nil, fmt.Errorf("LOGIN_CODE_HMAC_KEY must be set in production")
+	}
+	switch config.WebAuthn.ResidentKey {
+	case "required", "preferred", "discouraged":
+	default:
+		return nil, fmt.Errorf("WEBAUTHN_RESIDENT_KEY must be required, preferred or discouraged")
+	}
+	switch config.WebAuthn.BackupFlagPolicy {
+	case "accept", "warn", "reject":
+	default:
+		return nil, fmt.Errorf("WEBAUTHN_BACKUP_FLAG_POLICY must be accept, warn or reject")
+	}
+	switch config.WebAuthn.Attestation {
+	case "none", "indirect", "direct", "enterprise":
+	default:
+		return nil, fmt.Errorf("WEBAUTHN_ATTESTATION must be none, indirect, direct or enterprise")
+	}
+	// An AAGUID is only what the authenticator claims unless its attestation chains to a trusted root
+	hasAAGUIDLists := len(config.WebAuthn.AAGUIDAllowlist) > 0 || len(config.WebAuthn.AAGUIDDenylist) > 0
+	attested := config.WebAuthn.Attestation == "direct" || config.WebAuthn.Attestation == "enterprise"
+	if hasAAGUIDLists && (!attested || config.WebAuthn.AttestationTrustAnchorsFile == "") {
+		return nil, fmt.Errorf("WEBAUTHN_AAGUID_ALLOWLIST and WEBAUTHN_AAGUID_DENYLIST need WEBAUTHN_ATTESTATION=direct or enterprise and WEBAUTHN_ATTESTATION_TRUST_ANCHORS_FILE, or any authenticator could claim an allowed model")
+	}
+	// Without attestation browsers send no certificates, so every registration would be rejected
+	if config.WebAuthn.Attestation == "none" && config.WebAuthn.AttestationTrustAnchorsFile != "" {
+		return nil, fmt.Errorf("WEBAUTHN_ATTESTATION=none hides the attestation certificates, so WEBAUTHN_ATTESTATION_TRUST_ANCHORS_FILE would reject every passkey; use direct")
+	}
+	switch config.WebAuthn.CloneAction {
+	case "allow", "step_up", "disable":
+	default:
+		return nil, fmt.Errorf("WEBAUTHN_CLONE_ACTION must be allow, step_up or disable")
+	}
+	if config.Roles.ElevationMaxDuration <= 0 || config.Roles.ElevationRequestTTL <= 0 {
+		return nil, fmt.Errorf("ROLE_ELEVATION_MAX_DURATION and ROLE_ELEVATION_REQUEST_TTL must be positive")
+	}
+	for _, method := range config.Login.StepUpMethods {
+		if method != "hwk" && method != "otp" {
+			return nil, fmt.Errorf("LOGIN_STEP_UP_METHODS must only contain hwk and otp")
+		}
+	}
 
 	return config, nil
 }
@@ -141,3 +328,38 @@ func getEnvAsSlice(key string, defaultValue []string) []string {
 	}
 	return defaultValue
 }
+
+// trimAll trims spaces around each value and drops empty ones
+func trimAll(values []string) []string {
+	var result []string
+	for _, value := range values {
+		if value = strings.TrimSpace(value); value != "" {
+			result = append(result, value)
+		}
+	}
+	return result
+}
+
+// getEnvAsMap parses comma separated key=value pairs
+func getEnvAsMap(key string, defaultValue map[string]string) map[string]string {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+	result := make(map[string]string)
+	for _, pair := range strings.Split(value, ",") {
+		if k, v, ok := strings.Cut(pair, "="); ok {
+			result[strings.TrimSpace(k)] = strings.TrimSpace(v)
+		}
+	}
+	return result
+}
+
+// getEnvAsListMap parses comma separated key=value|value pairs
+func getEnvAsListMap(key string) map[string][]string {
+	result := make(map[string][]string)
+	for k, v := range getEnvAsMap(key, map[string]string{}) {
+		result[k] = strings.Split(v, "|")
+	}
+	return result
+}
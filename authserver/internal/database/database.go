@@ -43,6 +43,18 @@ func RunMigrations(db *gorm.DB) error {
 	err := db.AutoMigrate(
 		&types.User{},
 		&types.WebAuthnCredential{},
+		&types.RefreshToken{},
+		&types.SigningKey{},
+		&types.OAuthClient{},
+		&types.SecurityEvent{},
+		&types.Role{},
+		&types.Permission{},
+		&types.UserRole{},
+		&types.RoleInheritance{},
+		&types.ElevationRequest{},
+		&types.Organization{},
+		&types.OrgMembership{},
+		&types.OrgInvitation{},
 	)
 	
 	if err != nil {
@@ -57,9 +69,12 @@ func RunMigrations(db *gorm.DB) error {
 func SeedAdminUser(db *gorm.DB) error {
 	logger := log.New(os.Stdout, "[SEED] ", log.LstdFlags)
 	
-	// Check if any admin users exist
+	// Check if any permanent admin users exist; time-boxed grants don't count
 	var adminCount int64
-	err := db.Model(&types.User{}).Where("role = ?", "admin").Count(&adminCount).Error
+	err := db.Model(&types.UserRole{}).
+		Joins("JOIN roles ON roles.id = user_roles.role_id").
+		Where("roles.name = ? AND user_roles.expires_at IS NULL", types.RoleAdmin).
+		Count(&adminCount).Error
 	if err != nil {
 		return fmt.Errorf("failed to check for admin users: %w", err)
 	}
@@ -81,14 +96,23 @@ func SeedAdminUser(db *gorm.DB) error {
 		adminName = "System Administrator"
 	}
 
+	var adminRole types.Role
+	if err := db.Where("name = ?", types.RoleAdmin).First(&adminRole).Error; err != nil {
+		return fmt.Errorf("failed to find admin role: %w", err)
+	}
+
 	// Create admin user
 	admin := types.User{
 		Email: adminEmail,
 		Name:  adminName,
-		Role:  "admin",
 	}
 
-	err = db.Create(&admin).Error
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&admin).Error; err != nil {
+			return err
+		}
+		return tx.Create(&types.UserRole{UserID: admin.ID, RoleID: adminRole.ID}).Error
+	})
 	if err != nil {
 		return fmt.Errorf("failed to create admin user: %w", err)
 	}
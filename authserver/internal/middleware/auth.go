@@ -1,8 +1,13 @@
 package middleware
 
 import (
+	"errors"
+	"fmt"
 	"net/http"
+	"slices"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/simple-auth-roles/internal/auth/service"
@@ -13,62 +18,176 @@ const (
 	AuthorizationHeader = "Authorization"
 	BearerPrefix        = "Bearer "
 	UserContextKey      = "current_user"
+	ClaimsContextKey    = "current_claims"
+	RolesContextKey     = "current_roles"
+	OrgContextKey       = "current_org_membership"
+
+	// OrgIDParam and OrgIDHeader name the organization a request acts on; the org_id claim is the fallback
+	OrgIDParam  = "orgId"
+	OrgIDHeader = "X-Org-ID"
 )
 
-// RequireAuth middleware validates JWT token and sets current user in context
+// RequireAuth middleware validates a first-party JWT token and sets current user in context.
+// Tokens issued to OAuth clients are rejected: they only grant the scopes the user consented to.
 func RequireAuth(authService *service.AuthService) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		authHeader := c.GetHeader(AuthorizationHeader)
-		if authHeader == "" {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Authorization header required"})
-			c.Abort()
+		claims, ok := authenticate(c, authService)
+		if !ok {
 			return
 		}
 
-		if !strings.HasPrefix(authHeader, BearerPrefix) {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Bearer token required"})
+		if claims.IssuedToClient() {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
 			c.Abort()
 			return
 		}
 
-		token := strings.TrimPrefix(authHeader, BearerPrefix)
-		user, err := authService.ValidateToken(token)
-		if err != nil {
+		c.Next()
+	}
+}
+
+// RequireClientScope middleware validates a JWT token issued to an OAuth client with the scope
+// and sets current user in context
+func RequireClientScope(authService *service.AuthService, scope string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		claims, ok := authenticate(c, authService)
+		if !ok {
+			return
+		}
+
+		if !claims.IssuedToClient() {
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
 			c.Abort()
 			return
 		}
-
-		if !user.IsActive {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "User account is inactive"})
+		if !claims.HasScope(scope) {
+			c.Header("WWW-Authenticate", fmt.Sprintf(`Bearer error="insufficient_scope", scope=%q`, scope))
+			c.JSON(http.StatusForbidden, gin.H{"error": "insufficient_scope"})
 			c.Abort()
 			return
 		}
 
-		// Set user in context for use in handlers
-		c.Set(UserContextKey, user)
 		c.Next()
 	}
 }
 
-// RequireRole middleware checks if the current user has the required role
+// authenticate validates the bearer token and sets the user, token claims and effective roles in
+// context, aborting the request when it fails
+func authenticate(c *gin.Context, authService *service.AuthService) (*types.JWTClaims, bool) {
+	authHeader := c.GetHeader(AuthorizationHeader)
+	if authHeader == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authorization header required"})
+		c.Abort()
+		return nil, false
+	}
+
+	if !strings.HasPrefix(authHeader, BearerPrefix) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Bearer token required"})
+		c.Abort()
+		return nil, false
+	}
+
+	token := strings.TrimPrefix(authHeader, BearerPrefix)
+	user, claims, err := authService.ValidateToken(c.Request.Context(), token)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
+		c.Abort()
+		return nil, false
+	}
+
+	if !user.IsActive {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User account is inactive"})
+		c.Abort()
+		return nil, false
+	}
+
+	// Set user, token claims and effective roles in context for use in handlers
+	c.Set(UserContextKey, user)
+	c.Set(ClaimsContextKey, claims)
+	c.Set(RolesContextKey, authService.Roles().EffectiveRoles(user.Roles))
+	return claims, true
+}
+
+// RequireRole middleware checks if the current user has the required role, directly or by inheritance
 func RequireRole(requiredRole string) gin.HandlerFunc {
+	return RequireAnyRole(requiredRole)
+}
+
+// RequireAnyRole middleware checks if the current user has at least one of the roles
+func RequireAnyRole(roles ...string) gin.HandlerFunc {
+	return requireRoles(func(current []string) bool {
+		return slices.ContainsFunc(roles, func(role string) bool { return slices.Contains(current, role) })
+	})
+}
+
+// RequireAllRoles middleware checks if the current user has every one of the roles
+func RequireAllRoles(roles ...string) gin.HandlerFunc {
+	return requireRoles(func(current []string) bool {
+		return !slices.ContainsFunc(roles, func(role string) bool { return !slices.Contains(current, role) })
+	})
+}
+
+// requireRoles lets the request through when allowed accepts the user's effective roles
+func requireRoles(allowed func(current []string) bool) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		user := GetCurrentUser(c)
-		if user == nil {
+		if GetCurrentUser(c) == nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+			c.Abort()
+			return
+		}
+
+		if !allowed(GetCurrentRoles(c)) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Insufficient permissions"})
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// RequireRecentAuth middleware requires the user to have authenticated within maxAge using one of
+// methods (any method when none are given). Other requests get an RFC 9470 step-up challenge.
+func RequireRecentAuth(maxAge time.Duration, methods ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		claims := GetCurrentClaims(c)
+		if claims == nil {
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
 			c.Abort()
 			return
 		}
 
-		// Admin can access everything
-		if user.Role == types.RoleAdmin {
-			c.Next()
+		if !claims.AuthenticatedWithin(maxAge, methods...) {
+			maxAgeSeconds := int(maxAge.Seconds())
+			c.Header("WWW-Authenticate", fmt.Sprintf(`Bearer error="insufficient_user_authentication", error_description="A more recent authentication is required", max_age=%d`, maxAgeSeconds))
+			response := gin.H{
+				"error":     "Confirm it's you to continue",
+				"errorCode": "insufficient_user_authentication",
+				"maxAge":    maxAgeSeconds,
+			}
+			if len(methods) > 0 {
+				response["methods"] = methods
+			}
+			c.JSON(http.StatusUnauthorized, response)
+			c.Abort()
 			return
 		}
 
-		// Check specific role requirement
-		if user.Role != requiredRole {
+		c.Next()
+	}
+}
+
+// RequirePermission middleware checks if one of the current user's roles grants the required permission
+func RequirePermission(authService *service.AuthService, permission string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user := GetCurrentUser(c)
+		if user == nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+			c.Abort()
+			return
+		}
+
+		if !authService.Roles().HasPermission(GetCurrentRoles(c), permission) {
 			c.JSON(http.StatusForbidden, gin.H{"error": "Insufficient permissions"})
 			c.Abort()
 			return
@@ -78,8 +197,10 @@ func RequireRole(requiredRole string) gin.HandlerFunc {
 	}
 }
 
-// RequirePermission middleware checks if the current user has the required permission
-func RequirePermission(permission string) gin.HandlerFunc {
+// RequireOrgRole middleware checks that the current user's role in the organization named by the
+// :orgId route parameter, the X-Org-ID header or the token's org_id claim is role or inherits it.
+// Global roles don't count: an admin of one organization may be a plain user in another.
+func RequireOrgRole(authService *service.AuthService, role string) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		user := GetCurrentUser(c)
 		if user == nil {
@@ -88,16 +209,55 @@ func RequirePermission(permission string) gin.HandlerFunc {
 			return
 		}
 
-		if !user.HasPermission(permission) {
+		orgID, ok := requestOrgID(c)
+		if !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Organization required"})
+			c.Abort()
+			return
+		}
+
+		membership, err := authService.Orgs().Membership(c.Request.Context(), orgID, user.ID)
+		if err != nil {
+			if errors.Is(err, service.ErrNotOrgMember) {
+				c.JSON(http.StatusForbidden, gin.H{"error": "Not a member of this organization"})
+			} else {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check organization membership"})
+			}
+			c.Abort()
+			return
+		}
+
+		if !authService.Orgs().HasOrgRole(membership, role) {
 			c.JSON(http.StatusForbidden, gin.H{"error": "Insufficient permissions"})
 			c.Abort()
 			return
 		}
 
+		c.Set(OrgContextKey, membership)
 		c.Next()
 	}
 }
 
+// requestOrgID returns the organization the request acts on
+func requestOrgID(c *gin.Context) (uint, bool) {
+	value := c.Param(OrgIDParam)
+	if value == "" {
+		value = c.GetHeader(OrgIDHeader)
+	}
+	if value == "" {
+		if claims := GetCurrentClaims(c); claims != nil && claims.OrgID != nil {
+			return *claims.OrgID, true
+		}
+		return 0, false
+	}
+
+	orgID, err := strconv.ParseUint(value, 10, 32)
+	if err != nil {
+		return 0, false
+	}
+	return uint(orgID), true
+}
+
 // GetCurrentUser returns the current user from the Gin context
 func GetCurrentUser(c *gin.Context) *types.User {
 	if user, exists := c.Get(UserContextKey); exists {
@@ -107,3 +267,33 @@ func GetCurrentUser(c *gin.Context) *types.User {
 	}
 	return nil
 }
+
+// GetCurrentRoles returns the current user's assigned and inherited roles from the Gin context
+func GetCurrentRoles(c *gin.Context) []string {
+	if roles, exists := c.Get(RolesContextKey); exists {
+		if r, ok := roles.([]string); ok {
+			return r
+		}
+	}
+	return nil
+}
+
+// GetCurrentOrgMembership returns the membership checked by RequireOrgRole from the Gin context
+func GetCurrentOrgMembership(c *gin.Context) *types.OrgMembership {
+	if membership, exists := c.Get(OrgContextKey); exists {
+		if m, ok := membership.(*types.OrgMembership); ok {
+			return m
+		}
+	}
+	return nil
+}
+
+// GetCurrentClaims returns the validated token claims from the Gin context
+func GetCurrentClaims(c *gin.Context) *types.JWTClaims {
+	if claims, exists := c.Get(ClaimsContextKey); exists {
+		if cl, ok := claims.(*types.JWTClaims); ok {
+			return cl
+		}
+	}
+	return nil
+}
@@ -0,0 +1,28 @@
+package types
+
+import "time"
+
+// Pending login statuses
+const (
+	PendingLoginStatusPending  = "pending"
+	PendingLoginStatusApproved = "approved"
+	PendingLoginStatusDenied   = "denied"
+)
+
+// PendingLogin is an email login waiting to be approved from another device
+type PendingLogin struct {
+	ID        string    `json:"id"`
+	Email     string    `json:"email"`
+	Status    string    `json:"status"`
+	IPAddress string    `json:"ip_address"` // Of the device that asked to sign in
+	UserAgent string    `json:"user_agent"`
+	CreatedAt time.Time `json:"created_at"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// LoginChallenge is returned to the device that requested a login code
+type LoginChallenge struct {
+	Nonce          string // Must be sent back with the code
+	PendingLoginID string // Polled until the login is approved from another device
+	ExpiresAt      time.Time
+}
@@ -0,0 +1,137 @@
+package types
+
+import (
+	"slices"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// OAuth grant types
+const (
+	GrantTypeAuthorizationCode = "authorization_code"
+	GrantTypeRefreshToken      = "refresh_token"
+	GrantTypeDeviceCode        = "urn:ietf:params:oauth:grant-type:device_code"
+)
+
+// OpenID Connect scopes
+const (
+	ScopeOpenID  = "openid"
+	ScopeProfile = "profile" // name
+	ScopeEmail   = "email"   // email, email_verified
+	ScopeRoles   = "roles"   // roles
+)
+
+// OAuthClient represents an application registered to use this server as its identity provider
+type OAuthClient struct {
+	ID               uint      `json:"id" gorm:"primaryKey"`
+	ClientID         string    `json:"client_id" gorm:"uniqueIndex;not null"`
+	ClientSecretHash string    `json:"-"`
+	Name             string    `json:"name" gorm:"not null"`
+	RedirectURIs     []string  `json:"redirect_uris" gorm:"serializer:json;not null"`
+	Scopes           []string  `json:"scopes" gorm:"serializer:json;not null"`
+	GrantTypes       []string  `json:"grant_types" gorm:"serializer:json;not null"`
+	IsPublic         bool      `json:"is_public" gorm:"default:false"` // No secret, PKCE required
+	IsActive         bool      `json:"is_active" gorm:"default:true"`
+	CreatedAt        time.Time `json:"created_at"`
+	UpdatedAt        time.Time `json:"updated_at"`
+}
+
+// HasRedirectURI checks for an exact match against the registered redirect URIs
+func (c *OAuthClient) HasRedirectURI(uri string) bool {
+	return slices.Contains(c.RedirectURIs, uri)
+}
+
+// AllowsGrant checks if the client may use the grant type
+func (c *OAuthClient) AllowsGrant(grantType string) bool {
+	return slices.Contains(c.GrantTypes, grantType)
+}
+
+// AllowsScope checks if the client may request the scope
+func (c *OAuthClient) AllowsScope(scope string) bool {
+	return slices.Contains(c.Scopes, scope)
+}
+
+// CreateOAuthClientRequest represents a request to register a client
+type CreateOAuthClientRequest struct {
+	Name         string   `json:"name" binding:"required"`
+	RedirectURIs []string `json:"redirect_uris" binding:"dive,url"` // Required for the authorization code grant
+	Scopes       []string `json:"scopes"`
+	GrantTypes   []string `json:"grant_types"`
+	IsPublic     bool     `json:"is_public"`
+}
+
+// AuthorizationRequest is a pending /authorize request waiting for the user to sign in
+type AuthorizationRequest struct {
+	ID                  string    `json:"id"`
+	ClientID            string    `json:"client_id"`
+	RedirectURI         string    `json:"redirect_uri"`
+	Scope               string    `json:"scope"`
+	State               string    `json:"state,omitempty"`
+	Nonce               string    `json:"nonce,omitempty"`
+	CodeChallenge       string    `json:"code_challenge,omitempty"`
+	CodeChallengeMethod string    `json:"code_challenge_method,omitempty"`
+	ExpiresAt           time.Time `json:"expires_at"`
+}
+
+// AuthorizationCode is the state bound to an issued authorization code
+type AuthorizationCode struct {
+	ClientID            string    `json:"client_id"`
+	RedirectURI         string    `json:"redirect_uri"`
+	UserID              uint      `json:"user_id"`
+	Scope               string    `json:"scope"`
+	Nonce               string    `json:"nonce,omitempty"`
+	CodeChallenge       string    `json:"code_challenge,omitempty"`
+	CodeChallengeMethod string    `json:"code_challenge_method,omitempty"`
+	AuthTime            time.Time `json:"auth_time"`
+}
+
+// Device authorization statuses
+const (
+	DeviceStatusPending  = "pending"
+	DeviceStatusApproved = "approved"
+	DeviceStatusDenied   = "denied"
+)
+
+// DeviceAuthorization is a pending RFC 8628 device authorization, keyed by its device code
+type DeviceAuthorization struct {
+	ClientID  string    `json:"client_id"`
+	Scope     string    `json:"scope"`
+	UserCode  string    `json:"user_code"`
+	Status    string    `json:"status"`
+	UserID    uint      `json:"user_id,omitempty"`
+	AuthTime  time.Time `json:"auth_time,omitempty"`
+	Interval  int       `json:"interval"` // Seconds the client must initially wait between polls
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// DeviceAuthorizationResponse is the RFC 8628 device authorization response
+type DeviceAuthorizationResponse struct {
+	DeviceCode              string `json:"device_code"`
+	UserCode                string `json:"user_code"`
+	VerificationURI         string `json:"verification_uri"`
+	VerificationURIComplete string `json:"verification_uri_complete"`
+	ExpiresIn               int64  `json:"expires_in"`
+	Interval                int    `json:"interval"`
+}
+
+// TokenResponse is the RFC 6749 token endpoint response
+type TokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int64  `json:"expires_in"`
+	RefreshToken string `json:"refresh_token,omitempty"`
+	IDToken      string `json:"id_token,omitempty"`
+	Scope        string `json:"scope,omitempty"`
+}
+
+// IDTokenClaims represents the claims of an OpenID Connect ID token
+type IDTokenClaims struct {
+	AuthTime      int64    `json:"auth_time,omitempty"`
+	Nonce         string   `json:"nonce,omitempty"`
+	Email         string   `json:"email,omitempty"`
+	EmailVerified bool     `json:"email_verified,omitempty"`
+	Name          string   `json:"name,omitempty"`
+	Roles         []string `json:"roles,omitempty"`
+	jwt.RegisteredClaims
+}
@@ -0,0 +1,98 @@
+package types
+
+import "time"
+
+// Organization is a customer tenant; users belong to it through memberships
+type Organization struct {
+	ID        uint      `json:"id" gorm:"primaryKey"`
+	Name      string    `json:"name" gorm:"not null"`
+	Slug      string    `json:"slug" gorm:"uniqueIndex;not null"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// OrgMembership gives a user a role within one organization. The role is one of the roles in the
+// roles table, so inheritance applies: an org admin is also an org moderator and user.
+type OrgMembership struct {
+	OrgID     uint      `json:"org_id" gorm:"primaryKey"`
+	UserID    uint      `json:"user_id" gorm:"primaryKey;index"`
+	Role      string    `json:"role" gorm:"not null"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// OrgMember is a membership with the member's details, as listed to the organization
+type OrgMember struct {
+	UserID    uint      `json:"user_id"`
+	Email     string    `json:"email"`
+	Name      string    `json:"name"`
+	Role      string    `json:"role"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// UserOrg is an organization the user belongs to, with their role in it
+type UserOrg struct {
+	ID   uint   `json:"id"`
+	Name string `json:"name"`
+	Slug string `json:"slug"`
+	Role string `json:"role"`
+}
+
+// Invitation statuses; a pending invitation past its expiry can only be resent or revoked
+const (
+	InvitationStatusPending  = "pending"
+	InvitationStatusAccepted = "accepted"
+	InvitationStatusRevoked  = "revoked"
+	InvitationStatusExpired  = "expired" // Only reported, never stored
+)
+
+// OrgInvitation invites an email address to join an organization with a role
+type OrgInvitation struct {
+	ID         uint       `json:"id" gorm:"primaryKey"`
+	OrgID      uint       `json:"org_id" gorm:"not null;index"`
+	Email      string     `json:"email" gorm:"not null;index"`
+	Role       string     `json:"role" gorm:"not null"`
+	Status     string     `json:"status" gorm:"not null"`
+	LinkID     string     `json:"-" gorm:"not null"` // Only a link carrying this ID is valid; resending replaces it
+	InvitedBy  uint       `json:"invited_by"`
+	SentAt     time.Time  `json:"sent_at"`
+	ExpiresAt  time.Time  `json:"expires_at"`
+	AcceptedBy *uint      `json:"accepted_by,omitempty"`
+	AcceptedAt *time.Time `json:"accepted_at,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+// InvitationPreview is what an invite link shows before it is accepted
+type InvitationPreview struct {
+	OrgName   string    `json:"org_name"`
+	Email     string    `json:"email"`
+	Role      string    `json:"role"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// CreateInvitationRequest invites an email to an organization
+type CreateInvitationRequest struct {
+	Email string `json:"email" binding:"required,email"`
+	Role  string `json:"role" binding:"required"`
+}
+
+// AcceptInvitationRequest accepts the invitation in an invite link
+type AcceptInvitationRequest struct {
+	Token string `json:"token" binding:"required"`
+}
+
+// CreateOrgRequest creates an organization with the caller as its admin
+type CreateOrgRequest struct {
+	Name string `json:"name" binding:"required"`
+	Slug string `json:"slug" binding:"required"`
+}
+
+// SetOrgMemberRequest changes a member's role in an organization
+type SetOrgMemberRequest struct {
+	Role string `json:"role" binding:"required"`
+}
+
+// SwitchOrgRequest sets the organization carried in the session's org_id claim, none when OrgID is nil
+type SwitchOrgRequest struct {
+	OrgID *uint `json:"org_id"`
+}
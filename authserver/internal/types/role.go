@@ -0,0 +1,110 @@
+package types
+
+import "time"
+
+// Role is a named set of permissions assigned to users
+type Role struct {
+	ID          uint         `json:"id" gorm:"primaryKey"`
+	Name        string       `json:"name" gorm:"uniqueIndex;not null"`
+	Description string       `json:"description"`
+	IsSystem    bool         `json:"is_system" gorm:"not null;default:false"` // Built-in roles the server relies on
+	Permissions []Permission `json:"permissions" gorm:"many2many:role_permissions"`
+	Inherits    []string     `json:"inherits" gorm:"-"` // Roles whose roles and permissions this role includes
+	CreatedAt   time.Time    `json:"created_at"`
+	UpdatedAt   time.Time    `json:"updated_at"`
+}
+
+// UserRole assigns a role to a user, until ExpiresAt for time-boxed grants
+type UserRole struct {
+	UserID    uint       `json:"user_id" gorm:"primaryKey"`
+	RoleID    uint       `json:"role_id" gorm:"primaryKey;index"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty" gorm:"index"` // nil for permanent assignments
+	GrantedBy *uint      `json:"granted_by,omitempty"`              // Admin who granted the role, nil when seeded or migrated
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+// RoleGrant is a user's role assignment as shown to admins
+type RoleGrant struct {
+	UserID    uint       `json:"user_id"`
+	Role      string     `json:"role"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	GrantedBy *uint      `json:"granted_by,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+// Elevation request statuses
+const (
+	ElevationStatusPending  = "pending"
+	ElevationStatusApproved = "approved"
+	ElevationStatusDenied   = "denied"
+	ElevationStatusExpired  = "expired" // Not reviewed in time
+)
+
+// ElevationRequest asks for a role for a limited time; another admin must approve it
+type ElevationRequest struct {
+	ID              uint       `json:"id" gorm:"primaryKey"`
+	UserID          uint       `json:"user_id" gorm:"not null;index"`
+	Role            string     `json:"role" gorm:"not null"`
+	DurationSeconds int64      `json:"duration_seconds" gorm:"not null"`
+	Reason          string     `json:"reason"`
+	Status          string     `json:"status" gorm:"not null;index"`
+	ReviewedBy      *uint      `json:"reviewed_by,omitempty"`
+	ReviewedAt      *time.Time `json:"reviewed_at,omitempty"`
+	CreatedAt       time.Time  `json:"created_at"`
+	ExpiresAt       time.Time  `json:"expires_at"` // A pending request lapses after this
+}
+
+// RoleInheritance makes a role include another role, and through it everything that role includes
+type RoleInheritance struct {
+	RoleID          uint `gorm:"primaryKey"`
+	InheritedRoleID uint `gorm:"primaryKey;index"`
+}
+
+// Permission is an action a role may be allowed to perform
+type Permission struct {
+	ID          uint      `json:"id" gorm:"primaryKey"`
+	Name        string    `json:"name" gorm:"uniqueIndex;not null"`
+	Description string    `json:"description"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// Permission constants
+const (
+	PermissionAll        = "*"           // Grants every permission
+	PermissionRead       = "read"        // Read content
+	PermissionWrite      = "write"       // Create and edit content
+	PermissionModerate   = "moderate"    // Moderate other users' content
+	PermissionCreateOrgs = "orgs:create" // Create organizations while sign-up is closed
+)
+
+// CreateRoleRequest represents a request to create a role
+type CreateRoleRequest struct {
+	Name        string   `json:"name" binding:"required"`
+	Description string   `json:"description"`
+	Permissions []string `json:"permissions"`
+	Inherits    []string `json:"inherits"`
+}
+
+// SetUserRolesRequest replaces the roles assigned to a user
+type SetUserRolesRequest struct {
+	Roles []string `json:"roles" binding:"required,min=1"`
+}
+
+// CreatePermissionRequest represents a request to create a permission
+type CreatePermissionRequest struct {
+	Name        string `json:"name" binding:"required"`
+	Description string `json:"description"`
+}
+
+// GrantRoleRequest grants a role, for a limited time when Duration is set
+type GrantRoleRequest struct {
+	Role     string `json:"role" binding:"required"`
+	Duration string `json:"duration"` // e.g. "24h", empty for a permanent grant
+}
+
+// CreateElevationRequest asks for a role for a limited time
+type CreateElevationRequest struct {
+	Role     string `json:"role" binding:"required"`
+	Duration string `json:"duration" binding:"required"` // e.g. "4h"
+	Reason   string `json:"reason" binding:"required"`
+}
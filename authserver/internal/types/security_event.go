@@ -0,0 +1,29 @@
+package types
+
+import "time"
+
+// Security event types
+const (
+	SecurityEventPasskeyCloneDetected      = "passkey_clone_detected"      // A passkey's sign counter went backwards
+	SecurityEventPasskeyCloneCleared       = "passkey_clone_cleared"       // An emailed code confirmed a sign-in with a flagged passkey
+	SecurityEventPasskeyAddedByAdmin       = "passkey_added_by_admin"      // An admin registered a passkey for the user
+	SecurityEventPasskeyRequirementChanged = "passkey_requirement_changed" // An admin changed whether the user must keep a passkey
+
+	SecurityEventRoleGranted        = "role_granted"        // A role was assigned, possibly until an expiry
+	SecurityEventRoleRevoked        = "role_revoked"        // A role was removed by an admin
+	SecurityEventRoleExpired        = "role_expired"        // A time-boxed role was removed by the sweeper
+	SecurityEventElevationRequested = "elevation_requested" // The user asked for a role for a limited time
+	SecurityEventElevationApproved  = "elevation_approved"  // An admin approved an elevation request
+	SecurityEventElevationDenied    = "elevation_denied"    // An admin denied an elevation request
+)
+
+// SecurityEvent records something suspicious or privilege-changing on an account for later review
+type SecurityEvent struct {
+	ID        uint           `json:"id" gorm:"primaryKey"`
+	UserID    uint           `json:"user_id" gorm:"not null;index"`
+	Type      string         `json:"type" gorm:"not null;index"`
+	Details   map[string]any `json:"details" gorm:"serializer:json"`
+	IPAddress string         `json:"ip_address"`
+	UserAgent string         `json:"user_agent"`
+	CreatedAt time.Time      `json:"created_at"`
+}
@@ -0,0 +1,22 @@
+package types
+
+import "time"
+
+// Signing key statuses
+const (
+	SigningKeyStatusActive  = "active"  // Signs new tokens
+	SigningKeyStatusRetired = "retired" // Only verifies until NotAfter
+)
+
+// SigningKey is a persisted JWT signing key in the key ring
+type SigningKey struct {
+	ID          uint       `json:"id" gorm:"primaryKey"`
+	KID         string     `json:"kid" gorm:"uniqueIndex;not null"`
+	Algorithm   string     `json:"algorithm" gorm:"not null"`
+	PrivateKey  []byte     `json:"-" gorm:"not null"` // PKCS#8 PEM, or the raw secret for HS256, encrypted with KEY_ENCRYPTION_KEY
+	Status      string     `json:"status" gorm:"not null;index"`
+	ActivatedAt time.Time  `json:"activated_at"`
+	RetiredAt   *time.Time `json:"retired_at"`
+	NotAfter    *time.Time `json:"not_after"` // Retired keys stop verifying after this
+	CreatedAt   time.Time  `json:"created_at"`
+}
@@ -0,0 +1,52 @@
+package types
+
+import "time"
+
+// RefreshToken represents one opaque refresh token in a rotation family.
+// Only a hash of the token is stored; the plaintext is returned to the client once.
+type RefreshToken struct {
+	ID         uint       `json:"id" gorm:"primaryKey"`
+	UserID     uint       `json:"user_id" gorm:"not null;index"`
+	FamilyID   string     `json:"family_id" gorm:"not null;index"`
+	TokenHash  string     `json:"-" gorm:"uniqueIndex;not null"`
+	ClientType string     `json:"client_type"`
+	ClientID   string     `json:"client_id" gorm:"index"` // OAuth client the token was issued to, empty for first-party logins
+	Scope      string     `json:"scope"`
+	IPAddress  string     `json:"ip_address"`
+	UserAgent  string     `json:"user_agent"`
+	ExpiresAt  time.Time  `json:"expires_at" gorm:"not null"`
+	UsedAt     *time.Time `json:"used_at"`
+	RevokedAt  *time.Time `json:"revoked_at"`
+	CreatedAt  time.Time  `json:"created_at"`
+
+	// How and when the user last authenticated; rotation keeps them
+	AuthTime time.Time `json:"auth_time"`
+	AMR      []string  `json:"amr" gorm:"serializer:json"`
+
+	OrgID *uint `json:"org_id"` // Active organization, carried into the org_id claim; rotation keeps it
+}
+
+// Authentication method references (RFC 8176) recorded in the amr claim
+const (
+	AMRPasskey   = "hwk" // WebAuthn assertion with a passkey or security key
+	AMREmailCode = "otp" // One-time code or link sent by email
+)
+
+// RequestMeta describes the client a session is being created for
+type RequestMeta struct {
+	ClientType string
+	IPAddress  string
+	UserAgent  string
+	ClientID   string // Set for OAuth clients
+	Scope      string // Set for OAuth clients
+
+	AuthTime time.Time // When the user authenticated, now when zero
+	AMR      []string  // Authentication methods used, see the AMR constants
+
+	OrgID *uint // Active organization of the session, if any
+}
+
+// RefreshRequest represents a request to rotate a refresh token
+type RefreshRequest struct {
+	RefreshToken string `json:"refresh_token" binding:"required"`
+}
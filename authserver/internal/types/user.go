@@ -1,11 +1,14 @@
 package types
 
 import (
+	"slices"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/go-webauthn/webauthn/protocol"
 	"github.com/go-webauthn/webauthn/webauthn"
+	"github.com/golang-jwt/jwt/v5"
 )
 
 // User represents a user entity with role-based access
@@ -14,71 +17,110 @@ type User struct {
 	Email     string    `json:"email" gorm:"uniqueIndex;not null"`
 	Name      string    `json:"name"`
 	Company   string    `json:"company"`
-	Role      string    `json:"role" gorm:"not null;default:'user'"` // admin, moderator, user
 	IsActive  bool      `json:"is_active" gorm:"default:true"`
 	CreatedAt time.Time `json:"created_at"`
 	UpdatedAt time.Time `json:"updated_at"`
 
+	// Set by an admin; the user may not delete their last usable passkey
+	PasskeyRequired bool `json:"passkey_required" gorm:"not null;default:false"`
+
+	// Assigned role names - loaded manually from user_roles, inherited roles are not included
+	Roles []string `json:"roles" gorm:"-"`
+
 	// WebAuthn credentials - loaded manually to avoid GORM relationship conflicts
 	WebAuthnCredentialsData []WebAuthnCredential `json:"webauthn_credentials" gorm:"-"`
 }
 
-// Role constants
+// Built-in roles, seeded by migrations
 const (
 	RoleAdmin     = "admin"     // Full system access
 	RoleModerator = "moderator" // Content management
 	RoleUser      = "user"      // Basic access
 )
 
+// LegacyRole returns the highest built-in role in roles, for clients that still read the
+// single role claim; empty when roles holds none of them
+func LegacyRole(roles []string) string {
+	for _, role := range []string{RoleAdmin, RoleModerator, RoleUser} {
+		if slices.Contains(roles, role) {
+			return role
+		}
+	}
+	return ""
+}
+
 // CreateUserRequest represents a request to create a user
 type CreateUserRequest struct {
-	Email   string `json:"email" binding:"required,email"`
-	Name    string `json:"name"`
-	Company string `json:"company"`
-	Role    string `json:"role"`
+	Email   string   `json:"email" binding:"required,email"`
+	Name    string   `json:"name"`
+	Company string   `json:"company"`
+	Roles   []string `json:"roles"`
+	Role    string   `json:"role"` // Single role for older clients, ignored when roles is set
 }
 
 // AuthResponse represents the response from authentication
 type AuthResponse struct {
-	User    *User  `json:"user"`
-	Token   string `json:"token,omitempty"`
-	Message string `json:"message"`
+	User         *User  `json:"user"`
+	Token        string `json:"token,omitempty"`
+	RefreshToken string `json:"refresh_token,omitempty"`
+	ExpiresIn    int64  `json:"expires_in,omitempty"`
+	Scope        string `json:"scope,omitempty"`
+	Message      string `json:"message"`
 }
 
 // JWTClaims represents the JWT token claims
 type JWTClaims struct {
-	UserID uint   `json:"user_id"`
-	Email  string `json:"email"`
-	Role   string `json:"role"`
+	UserID    uint   `json:"user_id"`
+	Email     string `json:"email"`
+	SessionID string `json:"sid,omitempty"`   // Refresh token family the token was issued for
+	Scope     string `json:"scope,omitempty"` // Granted scopes for tokens issued to OAuth clients
+
+	Roles []string `json:"roles,omitempty"`  // Assigned and inherited roles
+	Role  string   `json:"role,omitempty"`   // Deprecated: highest built-in role, for clients from before roles
+	OrgID *uint    `json:"org_id,omitempty"` // Active organization, switched with /auth/switch-org
+
+	AuthTime *jwt.NumericDate `json:"auth_time,omitempty"` // When the user last authenticated
+	AMR      []string         `json:"amr,omitempty"`       // How the user last authenticated
+	jwt.RegisteredClaims
 }
 
-// HasPermission checks if the user has the required permission based on role
-func (u *User) HasPermission(permission string) bool {
-	switch u.Role {
-	case RoleAdmin:
-		return true // Admin has all permissions
-	case RoleModerator:
-		return permission == "read" || permission == "write" || permission == "moderate"
-	case RoleUser:
-		return permission == "read"
-	default:
-		return false
+// AuthenticatedAt returns when the user last authenticated, the issue time for older tokens
+func (c *JWTClaims) AuthenticatedAt() time.Time {
+	if c.AuthTime != nil {
+		return c.AuthTime.Time
+	}
+	if c.IssuedAt != nil {
+		return c.IssuedAt.Time
 	}
+	return time.Time{}
 }
 
-// IsAdmin checks if user is an admin
-func (u *User) IsAdmin() bool {
-	return u.Role == RoleAdmin
+// IssuedToClient reports whether the token was issued to an OAuth client rather than to a
+// first-party app; such tokens carry the client as audience and the granted scopes
+func (c *JWTClaims) IssuedToClient() bool {
+	return len(c.Audience) > 0 || c.Scope != ""
 }
 
-// IsModerator checks if user is a moderator or admin
-func (u *User) IsModerator() bool {
-	return u.Role == RoleModerator || u.Role == RoleAdmin
+// HasScope reports whether the token was granted scope
+func (c *JWTClaims) HasScope(scope string) bool {
+	return slices.Contains(strings.Fields(c.Scope), scope)
 }
 
-// ValidateRole checks if a role is valid
-func ValidateRole(role string) bool {
-	return role == RoleAdmin || role == RoleModerator || role == RoleUser
+// AuthenticatedWithin reports whether the user authenticated within maxAge using one of
+// methods, or any method when none are given
+func (c *JWTClaims) AuthenticatedWithin(maxAge time.Duration, methods ...string) bool {
+	if c.AuthTime == nil || time.Since(c.AuthTime.Time) > maxAge {
+		return false
+	}
+	if len(methods) == 0 {
+		return true
+	}
+	for _, method := range methods {
+		if slices.Contains(c.AMR, method) {
+			return true
+		}
+	}
+	return false
 }
 
 // WebAuthn interface implementation
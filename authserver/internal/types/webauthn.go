@@ -4,58 +4,179 @@ import (
 	"encoding/base64"
 	"time"
 
+	"github.com/go-webauthn/webauthn/protocol"
 	"github.com/go-webauthn/webauthn/webauthn"
+	"github.com/google/uuid"
 )
 
 // WebAuthnCredential represents a stored WebAuthn credential
 type WebAuthnCredential struct {
-	ID           uint      `json:"id" gorm:"primaryKey"`
-	UserID       uint      `json:"user_id" gorm:"not null;index"`
-	CredentialID []byte    `json:"credential_id" gorm:"uniqueIndex;not null"`
-	PublicKey    []byte    `json:"public_key" gorm:"not null"`
-	Counter      uint32    `json:"counter" gorm:"not null;default:0"`
-	Name         string    `json:"name" gorm:"not null"`
-	CreatedAt    time.Time `json:"created_at"`
-	UpdatedAt    time.Time `json:"updated_at"`
+	ID             uint       `json:"id" gorm:"primaryKey"`
+	UserID         uint       `json:"user_id" gorm:"not null;index"`
+	CredentialID   []byte     `json:"credential_id" gorm:"uniqueIndex;not null"`
+	PublicKey      []byte     `json:"public_key" gorm:"not null"`
+	Counter        uint32     `json:"counter" gorm:"not null;default:0"`
+	Name           string     `json:"name" gorm:"not null"`
+	BackupEligible *bool      `json:"backup_eligible"`                             // BE flag, nil until known; should never change for a credential
+	BackupState    bool       `json:"backup_state" gorm:"not null;default:false"`  // BS flag; flips as a passkey is synced
+	UserVerified   bool       `json:"user_verified" gorm:"not null;default:false"` // UV flag from the latest ceremony
+	CloneWarning   bool       `json:"clone_warning" gorm:"not null;default:false"` // Sign counter went backwards at some point
+	DisabledAt     *time.Time `json:"disabled_at"`                                 // Disabled passkeys can't sign in
+	CreatedAt      time.Time  `json:"created_at"`
+	UpdatedAt      time.Time  `json:"updated_at"`
+
+	// Latest successful login with this passkey
+	LastUsedAt        *time.Time `json:"last_used_at"`
+	LastUsedIP        string     `json:"last_used_ip"`
+	LastUsedUserAgent string     `json:"last_used_user_agent"`
+
+	// Authenticator metadata from registration
+	AAGUID          []byte   `json:"aaguid"`                            // Authenticator model, all zeros when not disclosed
+	Transports      []string `json:"transports" gorm:"serializer:json"` // usb, nfc, ble, internal, hybrid
+	Attachment      string   `json:"attachment"`                        // platform or cross-platform
+	AttestationType string   `json:"attestation_type"`                  // Attestation statement format, e.g. packed, apple or none
+	PublicKeyAlg    int64    `json:"public_key_alg"`                    // COSE algorithm of the public key
+	// Raw attestation, kept so the credential can be re-verified against authenticator metadata later
+	AttestationObject     []byte `json:"-"`
+	AttestationClientData []byte `json:"-"`
 	// Remove or comment out the User field to avoid recursion/conflict
 	// User User `json:"user" gorm:"foreignKey:UserID"`
 }
 
 // CredentialResponse represents the credential for JSON responses
 type CredentialResponse struct {
-	ID           uint      `json:"id"`
-	UserID       uint      `json:"user_id"`
-	CredentialID string    `json:"credential_id"` // base64url encoded
-	PublicKey    string    `json:"public_key"`    // base64 encoded
-	Counter      uint32    `json:"counter"`
-	Name         string    `json:"name"`
-	CreatedAt    time.Time `json:"created_at"`
-	UpdatedAt    time.Time `json:"updated_at"`
+	ID                uint       `json:"id"`
+	UserID            uint       `json:"user_id"`
+	CredentialID      string     `json:"credential_id"` // base64url encoded
+	PublicKey         string     `json:"public_key"`    // base64 encoded
+	Counter           uint32     `json:"counter"`
+	Name              string     `json:"name"`
+	AAGUID            string     `json:"aaguid"`                        // UUID string
+	ProviderName      string     `json:"provider_name,omitempty"`       // e.g. iCloud Keychain, from the authenticator metadata file
+	ProviderIconLight string     `json:"provider_icon_light,omitempty"` // data: URL
+	ProviderIconDark  string     `json:"provider_icon_dark,omitempty"`  // data: URL
+	Transports        []string   `json:"transports"`
+	Attachment        string     `json:"attachment,omitempty"`
+	AttestationType   string     `json:"attestation_type"`
+	AttestationObject string     `json:"attestation_object,omitempty"` // base64url encoded
+	UserVerified      bool       `json:"user_verified"`
+	BackupEligible    *bool      `json:"backup_eligible"` // null for passkeys that haven't signed in since BE was recorded
+	BackupState       bool       `json:"backup_state"`
+	CloneWarning      bool       `json:"clone_warning"`
+	DisabledAt        *time.Time `json:"disabled_at,omitempty"`
+	LastUsedAt        *time.Time `json:"last_used_at,omitempty"`
+	LastUsedIP        string     `json:"last_used_ip,omitempty"`
+	LastUsedUserAgent string     `json:"last_used_user_agent,omitempty"`
+	CreatedAt         time.Time  `json:"created_at"`
+	UpdatedAt         time.Time  `json:"updated_at"`
+}
+
+// NewWebAuthnCredential builds the stored form of a credential the library just created
+func NewWebAuthnCredential(userID uint, name string, credential *webauthn.Credential) *WebAuthnCredential {
+	transports := make([]string, len(credential.Transport))
+	for i, t := range credential.Transport {
+		transports[i] = string(t)
+	}
+
+	backupEligible := credential.Flags.BackupEligible
+	return &WebAuthnCredential{
+		UserID:         userID,
+		CredentialID:   credential.ID,
+		PublicKey:      credential.PublicKey,
+		Counter:        credential.Authenticator.SignCount,
+		Name:           name,
+		BackupEligible: &backupEligible,
+		BackupState:    credential.Flags.BackupState,
+		UserVerified:   credential.Flags.UserVerified,
+
+		AAGUID:          credential.Authenticator.AAGUID,
+		Transports:      transports,
+		Attachment:      string(credential.Authenticator.Attachment),
+		AttestationType: credential.AttestationType,
+		PublicKeyAlg:    credential.Attestation.PublicKeyAlgorithm,
+
+		AttestationObject:     credential.Attestation.Object,
+		AttestationClientData: credential.Attestation.ClientDataJSON,
+	}
 }
 
 // ToResponse converts WebAuthnCredential to CredentialResponse
 func (c *WebAuthnCredential) ToResponse() CredentialResponse {
+	transports := c.Transports
+	if transports == nil {
+		transports = []string{}
+	}
+
 	return CredentialResponse{
-		ID:           c.ID,
-		UserID:       c.UserID,
-		CredentialID: base64.RawURLEncoding.EncodeToString(c.CredentialID), // No padding
-		PublicKey:    base64.StdEncoding.EncodeToString(c.PublicKey),
-		Counter:      c.Counter,
-		Name:         c.Name,
-		CreatedAt:    c.CreatedAt,
-		UpdatedAt:    c.UpdatedAt,
+		ID:                c.ID,
+		UserID:            c.UserID,
+		CredentialID:      base64.RawURLEncoding.EncodeToString(c.CredentialID), // No padding
+		PublicKey:         base64.StdEncoding.EncodeToString(c.PublicKey),
+		Counter:           c.Counter,
+		Name:              c.Name,
+		AAGUID:            c.AAGUIDString(),
+		Transports:        transports,
+		Attachment:        c.Attachment,
+		AttestationType:   c.AttestationType,
+		AttestationObject: base64.RawURLEncoding.EncodeToString(c.AttestationObject),
+		UserVerified:      c.UserVerified,
+		BackupEligible:    c.BackupEligible,
+		BackupState:       c.BackupState,
+		CloneWarning:      c.CloneWarning,
+		DisabledAt:        c.DisabledAt,
+		LastUsedAt:        c.LastUsedAt,
+		LastUsedIP:        c.LastUsedIP,
+		LastUsedUserAgent: c.LastUsedUserAgent,
+		CreatedAt:         c.CreatedAt,
+		UpdatedAt:         c.UpdatedAt,
 	}
 }
 
+// AAGUIDString formats the AAGUID as a UUID, the nil UUID when unknown
+func (c *WebAuthnCredential) AAGUIDString() string {
+	aaguid, err := uuid.FromBytes(c.AAGUID)
+	if err != nil {
+		return uuid.Nil.String()
+	}
+	return aaguid.String()
+}
+
 // Convert to webauthn.Credential
 func (c *WebAuthnCredential) ToWebAuthnCredential() webauthn.Credential {
+	// Credentials stored before metadata was kept have no AAGUID
+	aaguid := c.AAGUID
+	if len(aaguid) == 0 {
+		aaguid = make([]byte, 16)
+	}
+	attestationType := c.AttestationType
+	if attestationType == "" {
+		attestationType = "none"
+	}
+
+	transports := make([]protocol.AuthenticatorTransport, len(c.Transports))
+	for i, t := range c.Transports {
+		transports[i] = protocol.AuthenticatorTransport(t)
+	}
+
 	return webauthn.Credential{
 		ID:              c.CredentialID,
 		PublicKey:       c.PublicKey,
-		AttestationType: "none",
+		AttestationType: attestationType,
+		Transport:       transports,
+		Flags: webauthn.CredentialFlags{
+			UserVerified:   c.UserVerified,
+			BackupEligible: c.BackupEligible != nil && *c.BackupEligible,
+			BackupState:    c.BackupState,
+		},
 		Authenticator: webauthn.Authenticator{
-			AAGUID:    make([]byte, 16),
-			SignCount: c.Counter,
+			AAGUID:     aaguid,
+			SignCount:  c.Counter,
+			Attachment: protocol.AuthenticatorAttachment(c.Attachment),
+		},
+		Attestation: webauthn.CredentialAttestation{
+			ClientDataJSON:     c.AttestationClientData,
+			PublicKeyAlgorithm: c.PublicKeyAlg,
+			Object:             c.AttestationObject,
 		},
 	}
 }
@@ -0,0 +1,164 @@
+package authenticators
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+
+	"github.com/go-webauthn/webauthn/metadata"
+	"github.com/google/uuid"
+)
+
+// maxMetadataSize bounds a downloaded metadata file; the FIDO MDS3 blob is a few MB
+const maxMetadataSize = 64 << 20
+
+// Info describes an authenticator model
+type Info struct {
+	Name      string
+	IconLight string // data: URL, may be empty
+	IconDark  string // data: URL, may be empty
+}
+
+// Registry resolves AAGUIDs to authenticator models. A nil Registry knows no authenticators.
+type Registry struct {
+	entries map[uuid.UUID]Info
+}
+
+// Load reads a metadata file: the community passkey AAGUID JSON or a FIDO MDS3 blob
+func Load(path string) (*Registry, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	registry, err := Parse(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load %s: %w", path, err)
+	}
+	return registry, nil
+}
+
+// Parse detects the metadata format; an MDS3 blob is a JWT and its signature is verified
+func Parse(data []byte) (*Registry, error) {
+	data = bytes.TrimSpace(data)
+	if bytes.HasPrefix(data, []byte("{")) {
+		return parsePasskeyAAGUIDs(data)
+	}
+	return parseMDS3(data)
+}
+
+// parsePasskeyAAGUIDs parses https://github.com/passkeydeveloper/passkey-authenticator-aaguids
+func parsePasskeyAAGUIDs(data []byte) (*Registry, error) {
+	var list metadata.PasskeyAuthenticator
+	if err := json.Unmarshal(data, &list); err != nil {
+		return nil, fmt.Errorf("invalid AAGUID JSON: %w", err)
+	}
+
+	entries := make(map[uuid.UUID]Info, len(list))
+	for key, entry := range list {
+		aaguid, err := uuid.Parse(key)
+		if err != nil || entry.Name == "" {
+			continue
+		}
+		entries[aaguid] = Info{
+			Name:      entry.Name,
+			IconLight: entry.IconLight,
+			IconDark:  entry.IconDark,
+		}
+	}
+	return &Registry{entries: entries}, nil
+}
+
+func parseMDS3(data []byte) (*Registry, error) {
+	decoder, err := metadata.NewDecoder(metadata.WithIgnoreEntryParsingErrors())
+	if err != nil {
+		return nil, err
+	}
+	payload, err := decoder.DecodeBytes(data)
+	if err != nil {
+		return nil, fmt.Errorf("invalid MDS3 blob: %w", err)
+	}
+
+	entries := make(map[uuid.UUID]Info, len(payload.Entries))
+	for _, entry := range payload.Entries {
+		aaguid, err := uuid.Parse(entry.AaGUID)
+		if err != nil || aaguid == uuid.Nil || entry.MetadataStatement.Description == "" {
+			continue
+		}
+		// MDS3 has a single icon for both themes
+		entries[aaguid] = Info{
+			Name:      entry.MetadataStatement.Description,
+			IconLight: entry.MetadataStatement.Icon,
+			IconDark:  entry.MetadataStatement.Icon,
+		}
+	}
+	return &Registry{entries: entries}, nil
+}
+
+// Lookup returns the authenticator model for a raw 16 byte AAGUID
+func (r *Registry) Lookup(aaguid []byte) (Info, bool) {
+	if r == nil {
+		return Info{}, false
+	}
+	id, err := uuid.FromBytes(aaguid)
+	if err != nil || id == uuid.Nil {
+		return Info{}, false
+	}
+	info, ok := r.entries[id]
+	return info, ok
+}
+
+// Len returns the number of known authenticator models
+func (r *Registry) Len() int {
+	if r == nil {
+		return 0
+	}
+	return len(r.entries)
+}
+
+// Refresh downloads a metadata file, checks that it parses and atomically replaces the file at path
+func Refresh(ctx context.Context, url, path string) (*Registry, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to download %s: %w", url, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to download %s: %s", url, resp.Status)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxMetadataSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to download %s: %w", url, err)
+	}
+	if len(data) > maxMetadataSize {
+		return nil, errors.New("metadata file is too large")
+	}
+
+	registry, err := Parse(data)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create metadata directory: %w", err)
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return nil, fmt.Errorf("failed to write %s: %w", tmp, err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return nil, fmt.Errorf("failed to replace %s: %w", path, err)
+	}
+	return registry, nil
+}
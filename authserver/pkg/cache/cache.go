@@ -14,6 +14,12 @@ type CacheService interface {
 	Set(ctx context.Context, key string, value string, ttl time.Duration) error
 	Get(ctx context.Context, key string) (string, error)
 	Delete(ctx context.Context, key string) error
+	// Take gets and deletes a value in one step, so only one caller can get it; "" when missing
+	Take(ctx context.Context, key string) (string, error)
+	// DeleteIfValue deletes a key only while it still holds value, reporting whether it did
+	DeleteIfValue(ctx context.Context, key, value string) (bool, error)
+	// Increment adds one to a counter and returns the new value; ttl applies from the first increment
+	Increment(ctx context.Context, key string, ttl time.Duration) (int64, error)
 }
 
 type cacheService struct {
@@ -68,9 +74,50 @@ func (c *cacheService) Set(ctx context.Context, key string, value string, ttl ti
 }
 
 func (c *cacheService) Get(ctx context.Context, key string) (string, error) {
-	return c.client.Get(ctx, key).Result()
+	value, err := c.client.Get(ctx, key).Result()
+	if err == redis.Nil {
+		// Match the in-memory cache: a missing key is not an error
+		return "", nil
+	}
+	return value, err
 }
 
 func (c *cacheService) Delete(ctx context.Context, key string) error {
 	return c.client.Del(ctx, key).Err()
 }
+
+func (c *cacheService) Take(ctx context.Context, key string) (string, error) {
+	value, err := c.client.GetDel(ctx, key).Result()
+	if err == redis.Nil {
+		return "", nil
+	}
+	return value, err
+}
+
+// deleteIfValueScript compares and deletes in one step on the server
+var deleteIfValueScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0`)
+
+func (c *cacheService) DeleteIfValue(ctx context.Context, key, value string) (bool, error) {
+	deleted, err := deleteIfValueScript.Run(ctx, c.client, []string{key}, value).Int()
+	if err != nil {
+		return false, err
+	}
+	return deleted == 1, nil
+}
+
+func (c *cacheService) Increment(ctx context.Context, key string, ttl time.Duration) (int64, error) {
+	count, err := c.client.Incr(ctx, key).Result()
+	if err != nil {
+		return 0, err
+	}
+	if count == 1 {
+		if err := c.client.Expire(ctx, key, ttl).Err(); err != nil {
+			return 0, err
+		}
+	}
+	return count, nil
+}
@@ -2,7 +2,9 @@ package cache
 
 import (
 	"context"
+	"fmt"
 	"log/slog"
+	"strconv"
 	"sync"
 	"time"
 )
@@ -44,8 +46,7 @@ func (m *memoryCacheService) Get(ctx context.Context, key string) (string, error
 	}
 
 	if time.Now().After(item.expiration) {
-		// Item expired, clean it up
-		delete(m.data, key)
+		// Item expired; cleanup removes it, deleting here would race under the read lock
 		return "", nil
 	}
 
@@ -60,6 +61,54 @@ func (m *memoryCacheService) Delete(ctx context.Context, key string) error {
 	return nil
 }
 
+func (m *memoryCacheService) Take(ctx context.Context, key string) (string, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	item, exists := m.data[key]
+	if !exists {
+		return "", nil
+	}
+	delete(m.data, key)
+
+	if time.Now().After(item.expiration) {
+		return "", nil
+	}
+	return item.value, nil
+}
+
+func (m *memoryCacheService) DeleteIfValue(ctx context.Context, key, value string) (bool, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	item, exists := m.data[key]
+	if !exists || time.Now().After(item.expiration) || item.value != value {
+		return false, nil
+	}
+	delete(m.data, key)
+	return true, nil
+}
+
+func (m *memoryCacheService) Increment(ctx context.Context, key string, ttl time.Duration) (int64, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	item, exists := m.data[key]
+	if !exists || time.Now().After(item.expiration) {
+		item = cacheItem{value: "0", expiration: time.Now().Add(ttl)}
+	}
+
+	count, err := strconv.ParseInt(item.value, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("value of %s is not a counter: %w", key, err)
+	}
+	count++
+	item.value = strconv.FormatInt(count, 10)
+	m.data[key] = item
+
+	return count, nil
+}
+
 func (m *memoryCacheService) cleanup() {
 	m.mutex.Lock()
 	defer m.mutex.Unlock()
@@ -0,0 +1,124 @@
+package database
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/simple-auth-roles/internal/types"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// defaultPermissions and defaultRoles are created when missing. Existing rows are left
+// alone so admins can change what the built-in roles allow.
+var (
+	defaultPermissions = []types.Permission{
+		{Name: types.PermissionAll, Description: "Every permission"},
+		{Name: types.PermissionRead, Description: "Read content"},
+		{Name: types.PermissionWrite, Description: "Create and edit content"},
+		{Name: types.PermissionModerate, Description: "Moderate other users' content"},
+		{Name: types.PermissionCreateOrgs, Description: "Create organizations while sign-up is closed"},
+	}
+	defaultRoles = []struct {
+		name        string
+		description string
+		permissions []string
+		inherits    []string
+	}{
+		{types.RoleAdmin, "Full system access", []string{types.PermissionAll}, []string{types.RoleModerator}},
+		{types.RoleModerator, "Content management", []string{types.PermissionWrite, types.PermissionModerate}, []string{types.RoleUser}},
+		{types.RoleUser, "Basic access", []string{types.PermissionRead}, nil},
+	}
+)
+
+// seedRoles creates the built-in roles and their permissions. The admin ⊃ moderator ⊃ user
+// hierarchy is linked for roles created now, and for every built-in role when linkExisting is set.
+func seedRoles(db *gorm.DB, logger *log.Logger, linkExisting bool) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		for _, permission := range defaultPermissions {
+			if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&permission).Error; err != nil {
+				return fmt.Errorf("failed to seed permission %s: %w", permission.Name, err)
+			}
+		}
+
+		created := make(map[string]bool, len(defaultRoles))
+		for _, def := range defaultRoles {
+			role := types.Role{Name: def.name, Description: def.description, IsSystem: true}
+			result := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&role)
+			if result.Error != nil {
+				return fmt.Errorf("failed to seed role %s: %w", def.name, result.Error)
+			}
+			if result.RowsAffected == 0 {
+				continue
+			}
+			created[def.name] = true
+
+			var permissions []types.Permission
+			if err := tx.Where("name IN ?", def.permissions).Find(&permissions).Error; err != nil {
+				return fmt.Errorf("failed to find permissions: %w", err)
+			}
+			if err := tx.Model(&role).Omit("Permissions.*").Association("Permissions").Append(permissions); err != nil {
+				return fmt.Errorf("failed to seed permissions of role %s: %w", def.name, err)
+			}
+			logger.Printf("Seeded role %s", def.name)
+		}
+
+		// Inherited roles are linked once every role exists
+		for _, def := range defaultRoles {
+			if !created[def.name] && !linkExisting {
+				continue
+			}
+			var role types.Role
+			if err := tx.Where("name = ?", def.name).First(&role).Error; err != nil {
+				return fmt.Errorf("failed to find role %s: %w", def.name, err)
+			}
+			for _, name := range def.inherits {
+				var inherited types.Role
+				if err := tx.Where("name = ?", name).First(&inherited).Error; err != nil {
+					return fmt.Errorf("failed to find role %s: %w", name, err)
+				}
+				link := types.RoleInheritance{RoleID: role.ID, InheritedRoleID: inherited.ID}
+				if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&link).Error; err != nil {
+					return fmt.Errorf("failed to seed role inheritance: %w", err)
+				}
+			}
+		}
+		return nil
+	})
+}
+
+// migrateLegacyRoles assigns every user the role from the old users.role column. It runs while
+// no user has a role yet, and fails without assigning any if a value names no role. The column
+// is kept, no longer read or written, so the previous release can still run against the database.
+func migrateLegacyRoles(db *gorm.DB, logger *log.Logger) error {
+	if !db.Migrator().HasColumn(&types.User{}, "role") {
+		return nil
+	}
+	var assigned int64
+	if err := db.Model(&types.UserRole{}).Count(&assigned).Error; err != nil {
+		return fmt.Errorf("failed to check user roles: %w", err)
+	}
+	if assigned > 0 {
+		return nil
+	}
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		var unknown []string
+		if err := tx.Raw(`SELECT DISTINCT COALESCE(role, '') FROM users WHERE role IS NULL OR role NOT IN (SELECT name FROM roles)`).Scan(&unknown).Error; err != nil {
+			return fmt.Errorf("failed to check user roles: %w", err)
+		}
+		if len(unknown) > 0 {
+			return fmt.Errorf("users.role has values that name no role, create those roles or fix the users first: %q", unknown)
+		}
+
+		result := tx.Exec(`INSERT INTO user_roles (user_id, role_id, created_at)
+			SELECT u.id, r.id, ? FROM users u JOIN roles r ON r.name = u.role
+			ON CONFLICT DO NOTHING`, time.Now())
+		if result.Error != nil {
+			return fmt.Errorf("failed to migrate user roles: %w", result.Error)
+		}
+		logger.Printf("Assigned %d users their existing role", result.RowsAffected)
+		return nil
+	})
+}
@@ -3,16 +3,47 @@ package email
 import (
 	"context"
 	"fmt"
+	"html"
 	"log/slog"
+	"time"
 
 	"github.com/resend/resend-go/v2"
 	"github.com/simple-auth-roles/internal/config"
 )
 
+// LoginCodeEmail is the content of a login email
+type LoginCodeEmail struct {
+	Code        string
+	MagicLink   string
+	ApproveLink string
+	IPAddress   string // Of the device that asked to sign in
+	UserAgent   string
+}
+
+// SecurityAlertEmail tells a user about suspicious activity on their account
+type SecurityAlertEmail struct {
+	Subject   string
+	Message   string // Plain text, one paragraph
+	Action    string // What happened as a result, plain text
+	IPAddress string // Of the request that triggered the alert
+	UserAgent string
+}
+
+// InvitationEmail invites someone to join an organization
+type InvitationEmail struct {
+	OrgName     string
+	Role        string
+	InviterName string // Name or email of the admin who sent the invitation
+	AcceptLink  string
+	ExpiresAt   time.Time
+}
+
 // EmailService defines email operations
 type EmailService interface {
-	SendLoginCodeEmail(ctx context.Context, email, code string) error
+	SendLoginCodeEmail(ctx context.Context, email string, msg LoginCodeEmail) error
 	SendWelcomeEmail(ctx context.Context, email, name string) error
+	SendSecurityAlertEmail(ctx context.Context, email string, msg SecurityAlertEmail) error
+	SendInvitationEmail(ctx context.Context, email string, msg InvitationEmail) error
 }
 
 type emailService struct {
@@ -34,7 +65,7 @@ func NewEmailService(cfg *config.Config, logger *slog.Logger) EmailService {
 	}
 }
 
-func (e *emailService) SendLoginCodeEmail(ctx context.Context, email, code string) error {
+func (e *emailService) SendLoginCodeEmail(ctx context.Context, email string, msg LoginCodeEmail) error {
 	subject := "Your Login Code"
 	htmlBody := fmt.Sprintf(`
 <!DOCTYPE html>
@@ -46,6 +77,8 @@ func (e *emailService) SendLoginCodeEmail(ctx context.Context, email, code strin
         body { font-family: Arial, sans-serif; line-height: 1.6; color: #333; }
         .container { max-width: 600px; margin: 0 auto; padding: 20px; }
         .code { background: #f4f4f4; padding: 15px; font-size: 24px; font-weight: bold; text-align: center; margin: 20px 0; border-radius: 8px; }
+        .button { display: inline-block; background: #111827; color: #ffffff; padding: 12px 24px; text-decoration: none; border-radius: 8px; font-weight: bold; }
+        .request { background: #f9fafb; border: 1px solid #e5e7eb; padding: 15px; margin: 20px 0; border-radius: 8px; font-size: 14px; }
         .footer { margin-top: 30px; font-size: 14px; color: #666; }
     </style>
 </head>
@@ -53,9 +86,16 @@ func (e *emailService) SendLoginCodeEmail(ctx context.Context, email, code strin
     <div class="container">
         <h2>Your Login Code</h2>
         <p>Hello!</p>
-        <p>Your login code is:</p>
+        <p>Click the button below to sign in:</p>
+        <p style="text-align: center;"><a class="button" href="%s">Sign in</a></p>
+        <p>Or enter this login code:</p>
         <div class="code">%s</div>
-        <p>This code will expire in 10 minutes.</p>
+        <div class="request">
+            <p><strong>Signing in on another device?</strong> This sign-in was requested from:</p>
+            <p>IP address: %s<br>Device: %s</p>
+            <p><a href="%s">Approve this sign-in</a> and that device will be signed in.</p>
+        </div>
+        <p>The link and code expire in 10 minutes and can only be used once.</p>
         <p>If you didn't request this code, please ignore this email.</p>
         <div class="footer">
             <p>Best regards,<br>%s Team</p>
@@ -63,7 +103,9 @@ func (e *emailService) SendLoginCodeEmail(ctx context.Context, email, code strin
     </div>
 </body>
 </html>
-`, code, e.config.Email.FromName)
+`, html.EscapeString(msg.MagicLink), html.EscapeString(msg.Code),
+		html.EscapeString(msg.IPAddress), html.EscapeString(msg.UserAgent), html.EscapeString(msg.ApproveLink),
+		e.config.Email.FromName)
 
 	return e.sendEmail(email, subject, htmlBody)
 }
@@ -108,6 +150,82 @@ func (e *emailService) SendWelcomeEmail(ctx context.Context, email, name string)
 	return e.sendEmail(email, subject, htmlBody)
 }
 
+func (e *emailService) SendSecurityAlertEmail(ctx context.Context, email string, msg SecurityAlertEmail) error {
+	htmlBody := fmt.Sprintf(`
+<!DOCTYPE html>
+<html>
+<head>
+    <meta charset="UTF-8">
+    <title>%s</title>
+    <style>
+        body { font-family: Arial, sans-serif; line-height: 1.6; color: #333; }
+        .container { max-width: 600px; margin: 0 auto; padding: 20px; }
+        .alert { background: #fef2f2; border: 1px solid #fecaca; padding: 15px; margin: 20px 0; border-radius: 8px; }
+        .request { background: #f9fafb; border: 1px solid #e5e7eb; padding: 15px; margin: 20px 0; border-radius: 8px; font-size: 14px; }
+        .footer { margin-top: 30px; font-size: 14px; color: #666; }
+    </style>
+</head>
+<body>
+    <div class="container">
+        <h2>%s</h2>
+        <div class="alert">
+            <p>%s</p>
+            <p>%s</p>
+        </div>
+        <div class="request">
+            <p>IP address: %s<br>Device: %s</p>
+        </div>
+        <div class="footer">
+            <p>Best regards,<br>%s Team</p>
+        </div>
+    </div>
+</body>
+</html>
+`, html.EscapeString(msg.Subject), html.EscapeString(msg.Subject),
+		html.EscapeString(msg.Message), html.EscapeString(msg.Action),
+		html.EscapeString(msg.IPAddress), html.EscapeString(msg.UserAgent),
+		e.config.Email.FromName)
+
+	return e.sendEmail(email, msg.Subject, htmlBody)
+}
+
+func (e *emailService) SendInvitationEmail(ctx context.Context, email string, msg InvitationEmail) error {
+	subject := fmt.Sprintf("You're invited to join %s", msg.OrgName)
+	htmlBody := fmt.Sprintf(`
+<!DOCTYPE html>
+<html>
+<head>
+    <meta charset="UTF-8">
+    <title>%s</title>
+    <style>
+        body { font-family: Arial, sans-serif; line-height: 1.6; color: #333; }
+        .container { max-width: 600px; margin: 0 auto; padding: 20px; }
+        .button { display: inline-block; background: #111827; color: #ffffff; padding: 12px 24px; text-decoration: none; border-radius: 8px; font-weight: bold; }
+        .footer { margin-top: 30px; font-size: 14px; color: #666; }
+    </style>
+</head>
+<body>
+    <div class="container">
+        <h2>%s</h2>
+        <p>Hello!</p>
+        <p>%s invited you to join <strong>%s</strong> as %s.</p>
+        <p style="text-align: center;"><a class="button" href="%s">Accept invitation</a></p>
+        <p>You'll be asked to sign in with this email address first. The invitation expires on %s.</p>
+        <p>If you weren't expecting this invitation, you can ignore this email.</p>
+        <div class="footer">
+            <p>Best regards,<br>%s Team</p>
+        </div>
+    </div>
+</body>
+</html>
+`, html.EscapeString(subject), html.EscapeString(subject),
+		html.EscapeString(msg.InviterName), html.EscapeString(msg.OrgName), html.EscapeString(msg.Role),
+		html.EscapeString(msg.AcceptLink), msg.ExpiresAt.UTC().Format("January 2, 2006 15:04 MST"),
+		e.config.Email.FromName)
+
+	return e.sendEmail(email, subject, htmlBody)
+}
+
 func (e *emailService) sendEmail(to, subject, htmlBody string) error {
 	// If Resend is not configured, just log the email
 	if e.resendClient == nil {
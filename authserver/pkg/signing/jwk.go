@@ -0,0 +1,95 @@
+package signing
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+)
+
+// JWK is the public part of a signing key as published in a JWKS document
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid,omitempty"`
+	Use string `json:"use,omitempty"`
+	Alg string `json:"alg,omitempty"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+	Y   string `json:"y,omitempty"`
+}
+
+// JWKSet is the document served from /.well-known/jwks.json
+type JWKSet struct {
+	Keys []JWK `json:"keys"`
+}
+
+// PublicJWK returns the public key in JWK form. HMAC keys have no public form.
+func (k *Key) PublicJWK() (JWK, error) {
+	if k.IsSymmetric() {
+		return JWK{}, fmt.Errorf("symmetric key %s cannot be published", k.ID)
+	}
+
+	jwk := JWK{Kid: k.ID, Use: "sig", Alg: k.Algorithm}
+	switch pub := k.signer.Public().(type) {
+	case *rsa.PublicKey:
+		jwk.Kty = "RSA"
+		jwk.N = encodeSegment(pub.N.Bytes())
+		jwk.E = encodeSegment(big.NewInt(int64(pub.E)).Bytes())
+	case *ecdsa.PublicKey:
+		ecdhKey, err := pub.ECDH()
+		if err != nil {
+			return JWK{}, fmt.Errorf("failed to encode EC key: %w", err)
+		}
+		// Uncompressed point: 0x04 || X || Y
+		point := ecdhKey.Bytes()
+		size := (len(point) - 1) / 2
+		jwk.Kty = "EC"
+		jwk.Crv = pub.Curve.Params().Name
+		jwk.X = encodeSegment(point[1 : 1+size])
+		jwk.Y = encodeSegment(point[1+size:])
+	case ed25519.PublicKey:
+		jwk.Kty = "OKP"
+		jwk.Crv = "Ed25519"
+		jwk.X = encodeSegment(pub)
+	default:
+		return JWK{}, fmt.Errorf("unsupported public key type %T", pub)
+	}
+	return jwk, nil
+}
+
+// Thumbprint computes the RFC 7638 JWK thumbprint
+func (j JWK) Thumbprint() (string, error) {
+	// Only the required members take part, serialized with sorted keys
+	members := map[string]string{"kty": j.Kty}
+	switch j.Kty {
+	case "RSA":
+		members["e"] = j.E
+		members["n"] = j.N
+	case "EC":
+		members["crv"] = j.Crv
+		members["x"] = j.X
+		members["y"] = j.Y
+	case "OKP":
+		members["crv"] = j.Crv
+		members["x"] = j.X
+	default:
+		return "", fmt.Errorf("unsupported key type: %s", j.Kty)
+	}
+
+	canonical, err := json.Marshal(members)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(canonical)
+	return encodeSegment(sum[:]), nil
+}
+
+func encodeSegment(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
@@ -0,0 +1,215 @@
+package signing
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Supported signing algorithms
+const (
+	AlgorithmHS256 = "HS256" // Shared secret, kept for backward compatibility
+	AlgorithmRS256 = "RS256"
+	AlgorithmES256 = "ES256"
+	AlgorithmEdDSA = "EdDSA"
+)
+
+// Key is a JWT signing key identified by its kid
+type Key struct {
+	ID        string
+	Algorithm string
+
+	signer crypto.Signer // nil for HMAC keys
+	secret []byte        // only set for HMAC keys
+}
+
+// NewKey wraps an asymmetric private key for the given algorithm.
+// The key ID is the RFC 7638 thumbprint of the public key.
+func NewKey(algorithm string, signer crypto.Signer) (*Key, error) {
+	if err := checkKeyType(algorithm, signer); err != nil {
+		return nil, err
+	}
+
+	key := &Key{Algorithm: algorithm, signer: signer}
+	jwk, err := key.PublicJWK()
+	if err != nil {
+		return nil, err
+	}
+
+	key.ID, err = jwk.Thumbprint()
+	if err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// NewHMACKey wraps a shared secret used for HS256 signing
+func NewHMACKey(secret []byte) *Key {
+	sum := sha256.Sum256(secret)
+	return &Key{
+		ID:        "hs-" + base64.RawURLEncoding.EncodeToString(sum[:8]),
+		Algorithm: AlgorithmHS256,
+		secret:    secret,
+	}
+}
+
+// IsSymmetric reports whether the key is a shared secret that must never be published
+func (k *Key) IsSymmetric() bool {
+	return k.secret != nil
+}
+
+// SigningMethod returns the jwt signing method for the key's algorithm
+func (k *Key) SigningMethod() jwt.SigningMethod {
+	return jwt.GetSigningMethod(k.Algorithm)
+}
+
+// SigningKey returns the value to pass to jwt.Token.SignedString
+func (k *Key) SigningKey() interface{} {
+	if k.IsSymmetric() {
+		return k.secret
+	}
+	return k.signer
+}
+
+// VerificationKey returns the value to return from a jwt.Keyfunc
+func (k *Key) VerificationKey() interface{} {
+	if k.IsSymmetric() {
+		return k.secret
+	}
+	return k.signer.Public()
+}
+
+// Signer returns the asymmetric private key, or nil for HMAC keys
+func (k *Key) Signer() crypto.Signer {
+	return k.signer
+}
+
+// Secret returns the shared secret, or nil for asymmetric keys
+func (k *Key) Secret() []byte {
+	return k.secret
+}
+
+// GenerateSigner creates a new private key suitable for the algorithm
+func GenerateSigner(algorithm string) (crypto.Signer, error) {
+	switch algorithm {
+	case AlgorithmRS256:
+		return rsa.GenerateKey(rand.Reader, 2048)
+	case AlgorithmES256:
+		return ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	case AlgorithmEdDSA:
+		_, private, err := ed25519.GenerateKey(rand.Reader)
+		return private, err
+	default:
+		return nil, fmt.Errorf("unsupported signing algorithm: %s", algorithm)
+	}
+}
+
+// ParsePrivateKeyPEM parses a PKCS#8, PKCS#1 or SEC 1 encoded private key
+func ParsePrivateKeyPEM(data []byte) (crypto.Signer, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no PEM block found")
+	}
+
+	var (
+		parsed interface{}
+		err    error
+	)
+	switch block.Type {
+	case "PRIVATE KEY":
+		parsed, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "RSA PRIVATE KEY":
+		parsed, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "EC PRIVATE KEY":
+		parsed, err = x509.ParseECPrivateKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("unsupported PEM block type: %s", block.Type)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse private key: %w", err)
+	}
+
+	signer, ok := parsed.(crypto.Signer)
+	if !ok {
+		return nil, errors.New("private key cannot be used for signing")
+	}
+	return signer, nil
+}
+
+// MarshalPrivateKeyPEM encodes a private key as PKCS#8 PEM
+func MarshalPrivateKeyPEM(signer crypto.Signer) ([]byte, error) {
+	der, err := x509.MarshalPKCS8PrivateKey(signer)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal private key: %w", err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), nil
+}
+
+// LoadOrGenerateKey reads the private key at path, generating and saving a new one if the file does not exist
+func LoadOrGenerateKey(path, algorithm string) (*Key, bool, error) {
+	data, err := os.ReadFile(path)
+	if err == nil {
+		signer, err := ParsePrivateKeyPEM(data)
+		if err != nil {
+			return nil, false, fmt.Errorf("failed to load %s: %w", path, err)
+		}
+		key, err := NewKey(algorithm, signer)
+		return key, false, err
+	}
+	if !errors.Is(err, os.ErrNotExist) {
+		return nil, false, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+
+	signer, err := GenerateSigner(algorithm)
+	if err != nil {
+		return nil, false, err
+	}
+
+	encoded, err := MarshalPrivateKeyPEM(signer)
+	if err != nil {
+		return nil, false, err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return nil, false, fmt.Errorf("failed to create key directory: %w", err)
+	}
+	if err := os.WriteFile(path, encoded, 0o600); err != nil {
+		return nil, false, fmt.Errorf("failed to write %s: %w", path, err)
+	}
+
+	key, err := NewKey(algorithm, signer)
+	return key, true, err
+}
+
+// checkKeyType makes sure the private key matches the algorithm
+func checkKeyType(algorithm string, signer crypto.Signer) error {
+	switch algorithm {
+	case AlgorithmRS256:
+		if _, ok := signer.(*rsa.PrivateKey); ok {
+			return nil
+		}
+	case AlgorithmES256:
+		if k, ok := signer.(*ecdsa.PrivateKey); ok && k.Curve == elliptic.P256() {
+			return nil
+		}
+	case AlgorithmEdDSA:
+		if _, ok := signer.(ed25519.PrivateKey); ok {
+			return nil
+		}
+	default:
+		return fmt.Errorf("unsupported signing algorithm: %s", algorithm)
+	}
+	return fmt.Errorf("private key type %T does not match algorithm %s", signer, algorithm)
+}
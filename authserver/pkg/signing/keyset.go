@@ -0,0 +1,83 @@
+package signing
+
+import (
+	"fmt"
+	"sync"
+)
+
+// KeySet holds the key used to sign new tokens and every key still accepted for verification
+type KeySet struct {
+	mu     sync.RWMutex
+	active *Key
+	keys   map[string]*Key
+}
+
+// NewKeySet creates a key set that signs with active and also verifies with the extra keys
+func NewKeySet(active *Key, verifying ...*Key) *KeySet {
+	ks := &KeySet{}
+	ks.Replace(active, verifying...)
+	return ks
+}
+
+// Replace swaps the signing key and the set of verification keys atomically
+func (ks *KeySet) Replace(active *Key, verifying ...*Key) {
+	keys := make(map[string]*Key, len(verifying)+1)
+	keys[active.ID] = active
+	for _, key := range verifying {
+		keys[key.ID] = key
+	}
+
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+	ks.active = active
+	ks.keys = keys
+}
+
+// Active returns the key new tokens are signed with
+func (ks *KeySet) Active() *Key {
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+	return ks.active
+}
+
+// Lookup returns the verification key with the given kid
+func (ks *KeySet) Lookup(kid string) (*Key, error) {
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+	key, ok := ks.keys[kid]
+	if !ok {
+		return nil, fmt.Errorf("unknown signing key: %s", kid)
+	}
+	return key, nil
+}
+
+// Algorithms returns the distinct algorithms of all keys in the set
+func (ks *KeySet) Algorithms() []string {
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+	seen := make(map[string]bool)
+	var algs []string
+	for _, key := range ks.keys {
+		if !seen[key.Algorithm] {
+			seen[key.Algorithm] = true
+			algs = append(algs, key.Algorithm)
+		}
+	}
+	return algs
+}
+
+// PublicJWKS returns the public keys of the set; shared secrets are never included
+func (ks *KeySet) PublicJWKS() JWKSet {
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+	set := JWKSet{Keys: []JWK{}}
+	for _, key := range ks.keys {
+		if key.IsSymmetric() {
+			continue
+		}
+		if jwk, err := key.PublicJWK(); err == nil {
+			set.Keys = append(set.Keys, jwk)
+		}
+	}
+	return set
+}
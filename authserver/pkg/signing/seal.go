@@ -0,0 +1,68 @@
+package signing
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+)
+
+// sealedPrefix marks key material encrypted by a Sealer; older rows hold plaintext
+var sealedPrefix = []byte("aes-gcm:v1:")
+
+// Sealer encrypts private key material at rest with AES-256-GCM
+type Sealer struct {
+	aead cipher.AEAD
+}
+
+// NewSealer derives the encryption key from secret (KEY_ENCRYPTION_KEY)
+func NewSealer(secret string) (*Sealer, error) {
+	if secret == "" {
+		return nil, errors.New("key encryption key is required")
+	}
+	key := sha256.Sum256([]byte(secret))
+	block, err := aes.NewCipher(key[:])
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &Sealer{aead: aead}, nil
+}
+
+// Seal encrypts material, binding it to kid so it can't be swapped into another key's row
+func (s *Sealer) Seal(kid string, material []byte) ([]byte, error) {
+	nonce := make([]byte, s.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("failed to generate nonce: %w", err)
+	}
+	sealed := append(bytes.Clone(sealedPrefix), nonce...)
+	return s.aead.Seal(sealed, nonce, material, []byte(kid)), nil
+}
+
+// Open decrypts material sealed for kid; unsealed material is returned as is
+func (s *Sealer) Open(kid string, stored []byte) ([]byte, error) {
+	if !IsSealed(stored) {
+		return stored, nil
+	}
+	data := stored[len(sealedPrefix):]
+	if len(data) < s.aead.NonceSize() {
+		return nil, errors.New("sealed key is truncated")
+	}
+	nonce, ciphertext := data[:s.aead.NonceSize()], data[s.aead.NonceSize():]
+	material, err := s.aead.Open(nil, nonce, ciphertext, []byte(kid))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt key %s, check KEY_ENCRYPTION_KEY: %w", kid, err)
+	}
+	return material, nil
+}
+
+// IsSealed reports whether stored material was encrypted by a Sealer
+func IsSealed(stored []byte) bool {
+	return bytes.HasPrefix(stored, sealedPrefix)
+}
@@ -1,18 +1,11 @@
-import { NextRequest, NextResponse } from "next/server";
+import { NextResponse } from "next/server";
+import { fetchWithSession } from "@/lib/auth/api";
 
-const API_URL = process.env.API_URL || "http://localhost:8080";
-
-export async function POST(request: NextRequest) {
+// Reports whether the signed-in user has passkeys
+export async function POST() {
   try {
-    const body = await request.json();
-
-    const response = await fetch(`${API_URL}/api/v1/auth/check-user`, {
+    const response = await fetchWithSession("/api/v1/auth/check-user", {
       method: "POST",
-      headers: {
-        "Content-Type": "application/json",
-        "X-Client-Type": "nextjs",
-      },
-      body: JSON.stringify(body),
     });
 
     const data = await response.json();
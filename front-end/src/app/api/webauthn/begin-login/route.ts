@@ -1,4 +1,5 @@
 import { NextRequest, NextResponse } from "next/server";
+import { forwardedHeaders } from "@/lib/auth/api";
 
 const API_URL = process.env.API_URL || "http://localhost:8080";
 
@@ -10,6 +11,7 @@ export async function POST(request: NextRequest) {
       headers: {
         "Content-Type": "application/json",
         "X-Client-Type": "nextjs",
+        ...(await forwardedHeaders()),
       },
       body: JSON.stringify(body),
     });
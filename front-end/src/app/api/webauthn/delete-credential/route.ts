@@ -1,17 +1,12 @@
 import { NextRequest, NextResponse } from "next/server";
-
-const API_URL = process.env.API_URL || "http://localhost:8080";
+import { fetchWithSession } from "@/lib/auth/api";
 
 export async function POST(request: NextRequest) {
   try {
     const body = await request.json();
 
-    const response = await fetch(`${API_URL}/api/v1/webauthn/delete-credential`, {
+    const response = await fetchWithSession("/api/v1/webauthn/delete-credential", {
       method: "POST",
-      headers: {
-        "Content-Type": "application/json",
-        "X-Client-Type": "nextjs",
-      },
       body: JSON.stringify(body),
     });
 
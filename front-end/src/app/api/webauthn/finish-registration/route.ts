@@ -1,13 +1,11 @@
 import { NextRequest } from "next/server";
-
-const API_URL = process.env.API_URL || "http://localhost:8080";
+import { fetchWithSession } from "@/lib/auth/api";
 
 export async function POST(req: NextRequest) {
   try {
     const body = await req.json();
-    const resp = await fetch(`${API_URL}/api/v1/webauthn/finish-registration`, {
+    const resp = await fetchWithSession("/api/v1/webauthn/finish-registration", {
       method: "POST",
-      headers: { "Content-Type": "application/json" },
       body: JSON.stringify(body),
     });
     const data = await resp.json();
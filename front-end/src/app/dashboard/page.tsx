@@ -36,7 +36,7 @@ export default async function Dashboard() {
           </Card>
 
           {/* Passkey Setup Alert */}
-          <PasskeySetupAlert email={user.email} />
+          <PasskeySetupAlert />
 
           {/* User Info */}
           <Card>
@@ -54,10 +54,14 @@ export default async function Dashboard() {
                   <p className="font-medium">{user.name || "Not set"}</p>
                 </div>
                 <div>
-                  <p className="text-sm text-gray-600">Role</p>
-                  <Badge variant={user.role === "admin" ? "default" : user.role === "moderator" ? "secondary" : "outline"}>
-                    {user.role}
-                  </Badge>
+                  <p className="text-sm text-gray-600">Roles</p>
+                  <div className="flex flex-wrap gap-1">
+                    {user.roles.map((role) => (
+                      <Badge key={role} variant={role === "admin" ? "default" : role === "moderator" ? "secondary" : "outline"}>
+                        {role}
+                      </Badge>
+                    ))}
+                  </div>
                 </div>
                 <div>
                   <p className="text-sm text-gray-600">Status</p>
@@ -70,8 +74,8 @@ export default async function Dashboard() {
                   <p className="font-medium">{new Date(user.created_at).toLocaleDateString()}</p>
                 </div>
               </div>
-              <RegisterPasskeyButton userId={Number(user.id)} />
-              <WebAuthnCredentialsManager userId={Number(user.id)} />
+              <RegisterPasskeyButton />
+              <WebAuthnCredentialsManager />
             </CardContent>
           </Card>
 
@@ -81,7 +85,7 @@ export default async function Dashboard() {
               <CardTitle>Role-based Features</CardTitle>
             </CardHeader>
             <CardContent>
-              {user.role === "admin" && (
+              {user.roles.includes("admin") && (
                 <div className="border-l-4 border-red-500 bg-red-50 p-4 rounded-r-lg">
                   <h3 className="text-lg font-semibold text-red-800">Admin Panel</h3>
                   <p className="text-red-700 mb-4">🔧 You have admin access - you can manage users and system settings</p>
@@ -92,7 +96,7 @@ export default async function Dashboard() {
                 </div>
               )}
 
-              {user.role === "moderator" && (
+              {user.roles.includes("moderator") && (
                 <div className="border-l-4 border-blue-500 bg-blue-50 p-4 rounded-r-lg">
                   <h3 className="text-lg font-semibold text-blue-800">Moderator Panel</h3>
                   <p className="text-blue-700 mb-4">📝 You have moderator access - you can moderate content</p>
@@ -103,7 +107,7 @@ export default async function Dashboard() {
                 </div>
               )}
 
-              {user.role === "user" && (
+              {user.roles.includes("user") && (
                 <div className="border-l-4 border-green-500 bg-green-50 p-4 rounded-r-lg">
                   <h3 className="text-lg font-semibold text-green-800">User Panel</h3>
                   <p className="text-green-700 mb-4">👤 You have user access - basic features available</p>
@@ -0,0 +1,35 @@
+import { auth } from "@/auth"
+import { redirect } from "next/navigation"
+import { Card, CardContent, CardDescription, CardHeader, CardTitle } from "@/components/ui/card"
+import { DeviceAuthorizationForm } from "@/components/auth/device-authorization-form"
+
+interface DevicePageProps {
+  searchParams: Promise<{ user_code?: string }>
+}
+
+// Where a device that can't open a browser sends the user (OIDC_DEVICE_VERIFICATION_URL)
+export default async function DevicePage({ searchParams }: DevicePageProps) {
+  const { user_code: userCode } = await searchParams
+
+  const session = await auth()
+  if (!session) {
+    const returnTo = userCode ? `/device?user_code=${encodeURIComponent(userCode)}` : "/device"
+    redirect(`/login?return_to=${encodeURIComponent(returnTo)}`)
+  }
+
+  return (
+    <div className="min-h-screen flex items-center justify-center bg-gray-50">
+      <Card className="w-full max-w-md">
+        <CardHeader className="space-y-1">
+          <CardTitle className="text-2xl text-center">Connect a Device</CardTitle>
+          <CardDescription className="text-center">
+            Enter the code shown on your device to sign it in as {session.user.email}
+          </CardDescription>
+        </CardHeader>
+        <CardContent>
+          <DeviceAuthorizationForm initialUserCode={userCode} />
+        </CardContent>
+      </Card>
+    </div>
+  )
+}
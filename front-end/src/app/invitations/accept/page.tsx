@@ -0,0 +1,99 @@
+import { acceptInvitationAction, auth } from "@/auth"
+import Link from "next/link"
+import { redirect } from "next/navigation"
+import { forwardedHeaders } from "@/lib/auth/api"
+import { Button } from "@/components/ui/button"
+import { Card, CardContent, CardDescription, CardHeader, CardTitle } from "@/components/ui/card"
+import { Alert, AlertDescription } from "@/components/ui/alert"
+
+const API_URL = process.env.API_URL || "http://localhost:8080"
+
+interface AcceptInvitationPageProps {
+  searchParams: Promise<{ token?: string; error?: string }>
+}
+
+interface InvitationPreview {
+  org_name: string
+  email: string
+  role: string
+  expires_at: string
+}
+
+export default async function AcceptInvitationPage({ searchParams }: AcceptInvitationPageProps) {
+  const { token, error } = await searchParams
+
+  if (!token) {
+    redirect("/login")
+  }
+
+  async function handleAccept() {
+    "use server"
+    try {
+      await acceptInvitationAction(token!)
+    } catch (e) {
+      const message = e instanceof Error ? e.message : "Failed to accept invitation"
+      redirect(`/invitations/accept?token=${encodeURIComponent(token!)}&error=${encodeURIComponent(message)}`)
+    }
+    redirect("/dashboard")
+  }
+
+  const response = await fetch(`${API_URL}/api/v1/invitations/preview?token=${encodeURIComponent(token)}`, {
+    headers: { "X-Client-Type": "nextjs", ...(await forwardedHeaders()) },
+    cache: "no-store",
+  })
+  const data = await response.json()
+  const invitation: InvitationPreview | null = response.ok ? data : null
+  const session = await auth()
+
+  return (
+    <div className="min-h-screen flex items-center justify-center bg-gray-50">
+      <Card className="w-full max-w-md">
+        <CardHeader className="space-y-1">
+          <CardTitle className="text-2xl text-center">
+            {invitation ? `Join ${invitation.org_name}` : "Invitation"}
+          </CardTitle>
+          <CardDescription className="text-center">
+            {invitation
+              ? `You've been invited as ${invitation.role}`
+              : "This invitation can't be used"}
+          </CardDescription>
+        </CardHeader>
+        <CardContent className="space-y-4">
+          {error && (
+            <Alert variant="destructive">
+              <AlertDescription>{error}</AlertDescription>
+            </Alert>
+          )}
+          {!invitation ? (
+            <Alert variant="destructive">
+              <AlertDescription>{data.error || "This invitation link is invalid or has expired"}</AlertDescription>
+            </Alert>
+          ) : !session ? (
+            <>
+              <p className="text-sm text-center">
+                Sign in as <span className="font-medium">{invitation.email}</span>, then open the
+                invitation link again to accept it.
+              </p>
+              <Button asChild className="w-full">
+                <Link href="/login">Sign in</Link>
+              </Button>
+            </>
+          ) : session.user.email.toLowerCase() !== invitation.email ? (
+            <Alert variant="destructive">
+              <AlertDescription>
+                This invitation was sent to {invitation.email}, but you&apos;re signed in as{" "}
+                {session.user.email}. Sign out and sign in with the invited address.
+              </AlertDescription>
+            </Alert>
+          ) : (
+            <form action={handleAccept}>
+              <Button type="submit" className="w-full">
+                Accept invitation
+              </Button>
+            </form>
+          )}
+        </CardContent>
+      </Card>
+    </div>
+  )
+}
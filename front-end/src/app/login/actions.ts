@@ -4,7 +4,7 @@ import { sendCodeAction } from "@/auth";
 import { redirect } from "next/navigation";
 
 export async function handleSendCodeAction(email: string) {
-  await sendCodeAction(email);
+  const { nonce, pendingLoginId } = await sendCodeAction(email);
   // Redirect to code verification step
-  redirect(`/login/verify?email=${encodeURIComponent(email)}`);
+  redirect(`/login/verify?email=${encodeURIComponent(email)}&nonce=${encodeURIComponent(nonce)}&pending=${encodeURIComponent(pendingLoginId)}`);
 }
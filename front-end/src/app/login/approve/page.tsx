@@ -0,0 +1,97 @@
+import { approveLoginAction } from "@/auth"
+import { redirect } from "next/navigation"
+import { forwardedHeaders } from "@/lib/auth/api"
+import { Button } from "@/components/ui/button"
+import { Card, CardContent, CardDescription, CardHeader, CardTitle } from "@/components/ui/card"
+import { Alert, AlertDescription } from "@/components/ui/alert"
+
+const API_URL = process.env.API_URL || "http://localhost:8080"
+
+interface ApprovePageProps {
+  searchParams: Promise<{ token?: string; done?: string }>
+}
+
+interface LoginApproval {
+  email: string
+  ipAddress: string
+  userAgent: string
+  requestedAt: string
+}
+
+export default async function ApprovePage({ searchParams }: ApprovePageProps) {
+  const { token, done } = await searchParams
+
+  if (!token) {
+    redirect("/login")
+  }
+
+  async function handleDecision(formData: FormData) {
+    "use server"
+    const approve = formData.get("decision") === "approve"
+    await approveLoginAction(token!, approve)
+    redirect(`/login/approve?token=${encodeURIComponent(token!)}&done=${approve ? "approved" : "denied"}`)
+  }
+
+  if (done) {
+    return (
+      <div className="min-h-screen flex items-center justify-center bg-gray-50">
+        <Card className="w-full max-w-md">
+          <CardHeader className="space-y-1">
+            <CardTitle className="text-2xl text-center">
+              {done === "approved" ? "Sign-in Approved" : "Sign-in Denied"}
+            </CardTitle>
+            <CardDescription className="text-center">
+              {done === "approved"
+                ? "The other device will be signed in shortly. You can close this page."
+                : "The other device was not signed in. You can close this page."}
+            </CardDescription>
+          </CardHeader>
+        </Card>
+      </div>
+    )
+  }
+
+  const response = await fetch(`${API_URL}/api/v1/auth/approve?token=${encodeURIComponent(token)}`, {
+    headers: { "X-Client-Type": "nextjs", ...(await forwardedHeaders()) },
+    cache: "no-store",
+  })
+  const data = await response.json()
+  const approval: LoginApproval | null = response.ok ? data : null
+
+  return (
+    <div className="min-h-screen flex items-center justify-center bg-gray-50">
+      <Card className="w-full max-w-md">
+        <CardHeader className="space-y-1">
+          <CardTitle className="text-2xl text-center">Approve Sign-in</CardTitle>
+          <CardDescription className="text-center">
+            Only approve if you just tried to sign in on another device
+          </CardDescription>
+        </CardHeader>
+        <CardContent>
+          {approval ? (
+            <>
+              <div className="mb-4 space-y-1 text-sm">
+                <p><span className="font-medium">Account:</span> {approval.email}</p>
+                <p><span className="font-medium">IP address:</span> {approval.ipAddress}</p>
+                <p><span className="font-medium">Device:</span> {approval.userAgent}</p>
+                <p><span className="font-medium">Requested:</span> {new Date(approval.requestedAt).toLocaleString()}</p>
+              </div>
+              <form action={handleDecision} className="space-y-4">
+                <Button type="submit" name="decision" value="approve" className="w-full">
+                  Approve
+                </Button>
+                <Button type="submit" name="decision" value="deny" variant="outline" className="w-full">
+                  This wasn&apos;t me
+                </Button>
+              </form>
+            </>
+          ) : (
+            <Alert variant="destructive">
+              <AlertDescription>{data.error || "This approval link is invalid or has expired"}</AlertDescription>
+            </Alert>
+          )}
+        </CardContent>
+      </Card>
+    </div>
+  )
+}
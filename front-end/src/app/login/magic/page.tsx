@@ -0,0 +1,56 @@
+import { magicLinkAction } from "@/auth"
+import { redirect } from "next/navigation"
+import Link from "next/link"
+import { Button } from "@/components/ui/button"
+import { Card, CardContent, CardDescription, CardHeader, CardTitle } from "@/components/ui/card"
+import { Alert, AlertDescription } from "@/components/ui/alert"
+
+interface MagicLinkPageProps {
+  searchParams: Promise<{ token?: string; error?: string }>
+}
+
+export default async function MagicLinkPage({ searchParams }: MagicLinkPageProps) {
+  const { token, error } = await searchParams
+
+  if (!token) {
+    redirect("/login")
+  }
+
+  // Signing in needs a click: mail scanners open links and would use up the token
+  async function handleMagicLink() {
+    "use server"
+    await magicLinkAction(token!)
+    // Redirect happens automatically in magicLinkAction
+  }
+
+  return (
+    <div className="min-h-screen flex items-center justify-center bg-gray-50">
+      <Card className="w-full max-w-md">
+        <CardHeader className="space-y-1">
+          <CardTitle className="text-2xl text-center">Sign In</CardTitle>
+          <CardDescription className="text-center">
+            Continue to sign in with the link from your email
+          </CardDescription>
+        </CardHeader>
+        <CardContent>
+          <form action={handleMagicLink} className="space-y-4">
+            <Button type="submit" className="w-full">
+              Continue
+            </Button>
+            <Link href="/login">
+              <Button type="button" variant="outline" className="w-full">
+                Back
+              </Button>
+            </Link>
+          </form>
+
+          {error && (
+            <Alert variant="destructive" className="mt-4">
+              <AlertDescription>{error}</AlertDescription>
+            </Alert>
+          )}
+        </CardContent>
+      </Card>
+    </div>
+  )
+}
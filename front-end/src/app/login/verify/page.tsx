@@ -7,15 +7,16 @@ import { Label } from "@/components/ui/label"
 import { Card, CardContent, CardDescription, CardHeader, CardTitle } from "@/components/ui/card"
 import { Alert, AlertDescription } from "@/components/ui/alert"
 import { Checkbox } from "@/components/ui/checkbox"
+import { PendingLoginWatcher } from "@/components/auth/pending-login-watcher"
 
 interface VerifyPageProps {
-  searchParams: Promise<{ email?: string; error?: string }>
+  searchParams: Promise<{ email?: string; nonce?: string; pending?: string; error?: string }>
 }
 
 export default async function VerifyPage({ searchParams }: VerifyPageProps) {
-  const { email, error } = await searchParams
+  const { email, nonce, pending, error } = await searchParams
 
-  if (!email) {
+  if (!email || !nonce) {
     redirect("/login")
   }
 
@@ -24,7 +25,7 @@ export default async function VerifyPage({ searchParams }: VerifyPageProps) {
     const code = formData.get("code") as string
     const rememberMe = formData.get("rememberMe") === "on"
 
-    await signInAction(email!, code, rememberMe)
+    await signInAction(email!, nonce!, code, rememberMe)
     // Redirect happens automatically in signInAction
   }
 
@@ -43,6 +44,7 @@ export default async function VerifyPage({ searchParams }: VerifyPageProps) {
               💡 After signing in, you can set up a passkey for faster, more secure sign-ins in your dashboard.
             </AlertDescription>
           </Alert>
+          {pending && <PendingLoginWatcher pendingLoginId={pending} />}
           <form action={handleVerifyCode} className="space-y-4">
             <div className="space-y-2">
               <Label htmlFor="code">Verification Code</Label>
@@ -0,0 +1,102 @@
+import { auth, authorizeDecisionAction } from "@/auth"
+import { redirect } from "next/navigation"
+import { forwardedHeaders } from "@/lib/auth/api"
+import { Button } from "@/components/ui/button"
+import { Card, CardContent, CardDescription, CardHeader, CardTitle } from "@/components/ui/card"
+import { Alert, AlertDescription } from "@/components/ui/alert"
+import { describeScopes } from "@/lib/oauth/scopes"
+
+const API_URL = process.env.API_URL || "http://localhost:8080"
+
+interface ConsentPageProps {
+  searchParams: Promise<{ authorization_request?: string; error?: string }>
+}
+
+interface AuthorizationRequest {
+  request_id: string
+  client_id: string
+  client_name: string
+  scope: string
+  expires_at: string
+}
+
+// Asks the signed-in user whether an OAuth client may sign them in; the login page
+// returns here after OIDC_LOGIN_URL?authorization_request=<id>
+export default async function ConsentPage({ searchParams }: ConsentPageProps) {
+  const { authorization_request: requestId, error } = await searchParams
+
+  if (!requestId) {
+    redirect("/")
+  }
+
+  const session = await auth()
+  if (!session) {
+    redirect(`/login?authorization_request=${encodeURIComponent(requestId)}`)
+  }
+
+  async function handleDecision(formData: FormData) {
+    "use server"
+    const approve = formData.get("decision") === "approve"
+    let redirectTo: string
+    try {
+      redirectTo = await authorizeDecisionAction(requestId!, approve)
+    } catch (e) {
+      const message = e instanceof Error ? e.message : "Failed to complete authorization"
+      redirect(`/oauth/consent?authorization_request=${encodeURIComponent(requestId!)}&error=${encodeURIComponent(message)}`)
+    }
+    redirect(redirectTo)
+  }
+
+  const response = await fetch(`${API_URL}/api/v1/oauth/authorize/requests/${encodeURIComponent(requestId)}`, {
+    headers: { "X-Client-Type": "nextjs", ...(await forwardedHeaders()) },
+    cache: "no-store",
+  })
+  const data = await response.json()
+  const request: AuthorizationRequest | null = response.ok ? data : null
+
+  return (
+    <div className="min-h-screen flex items-center justify-center bg-gray-50">
+      <Card className="w-full max-w-md">
+        <CardHeader className="space-y-1">
+          <CardTitle className="text-2xl text-center">
+            {request ? `Sign in to ${request.client_name}` : "Sign in"}
+          </CardTitle>
+          <CardDescription className="text-center">
+            Signed in as {session.user.email}
+          </CardDescription>
+        </CardHeader>
+        <CardContent className="space-y-4">
+          {error && (
+            <Alert variant="destructive">
+              <AlertDescription>{error}</AlertDescription>
+            </Alert>
+          )}
+          {request ? (
+            <>
+              <div className="space-y-1 text-sm">
+                <p className="font-medium">{request.client_name} will be able to:</p>
+                <ul className="list-disc pl-5">
+                  {describeScopes(request.scope).map((description) => (
+                    <li key={description}>{description}</li>
+                  ))}
+                </ul>
+              </div>
+              <form action={handleDecision} className="space-y-4">
+                <Button type="submit" name="decision" value="approve" className="w-full">
+                  Allow
+                </Button>
+                <Button type="submit" name="decision" value="deny" variant="outline" className="w-full">
+                  Deny
+                </Button>
+              </form>
+            </>
+          ) : (
+            <Alert variant="destructive">
+              <AlertDescription>{data.error || "This sign-in request is invalid or has expired"}</AlertDescription>
+            </Alert>
+          )}
+        </CardContent>
+      </Card>
+    </div>
+  )
+}
@@ -25,7 +25,7 @@ export default async function Home() {
                 <div className="space-y-4">
                   <div className="text-center">
                     <p className="text-lg">Welcome back, <span className="font-semibold">{session.user.email}</span>!</p>
-                    <p className="text-sm text-gray-600">Role: {session.user.role}</p>
+                    <p className="text-sm text-gray-600">Roles: {session.user.roles.join(", ")}</p>
                   </div>
                   <div className="flex flex-col sm:flex-row gap-2 justify-center">
                     <Link href="/dashboard">
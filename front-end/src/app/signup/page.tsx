@@ -16,12 +16,14 @@ async function handleSignUp(formData: FormData) {
   const email = formData.get("email") as string
   const name = formData.get("name") as string
   
+  let nonce: string
+  let pendingLoginId: string
   try {
-    await sendCodeAction(email, name) // Modified to include name
-    redirect(`/login/verify?email=${encodeURIComponent(email)}&signup=true`)
+    ({ nonce, pendingLoginId } = await sendCodeAction(email, name)) // Modified to include name
   } catch (error) {
     redirect(`/signup?error=${encodeURIComponent(error instanceof Error ? error.message : "Sign up failed")}`)
   }
+  redirect(`/login/verify?email=${encodeURIComponent(email)}&nonce=${encodeURIComponent(nonce)}&pending=${encodeURIComponent(pendingLoginId)}&signup=true`)
 }
 
 export default async function SignUpPage({ searchParams }: SignUpPageProps) {
@@ -4,14 +4,21 @@ import {
   createSession,
   destroySession,
   requireAuth,
+  takeReturnTo,
 } from "@/lib/auth/session";
 import { redirect } from "next/navigation";
+import { fetchWithSession, forwardedHeaders } from "@/lib/auth/api";
 
 const API_URL = process.env.API_URL || "http://localhost:8080";
 
 // Server-side auth function (mirrors Auth.js v5 approach)
 export const auth = getSession;
 
+// Backend tokens from a successful login response
+function sessionTokens(data: { sessionToken: string; refreshToken: string }) {
+  return { sessionToken: data.sessionToken, refreshToken: data.refreshToken };
+}
+
 // Server action for sending code
 export async function sendCodeAction(email: string, name?: string) {
   const response = await fetch(`${API_URL}/api/v1/auth/send-code`, {
@@ -19,6 +26,7 @@ export async function sendCodeAction(email: string, name?: string) {
     headers: {
       "Content-Type": "application/json",
       "X-Client-Type": "nextjs",
+      ...(await forwardedHeaders()),
     },
     body: JSON.stringify({ email, name }),
   });
@@ -41,6 +49,7 @@ export async function sendCodeAction(email: string, name?: string) {
 // Server action for sign in
 export async function signInAction(
   email: string,
+  nonce: string,
   code: string,
   rememberMe: boolean = false
 ) {
@@ -50,8 +59,9 @@ export async function signInAction(
     headers: {
       "Content-Type": "application/json",
       "X-Client-Type": "nextjs",
+      ...(await forwardedHeaders()),
     },
-    body: JSON.stringify({ email, code }),
+    body: JSON.stringify({ email, nonce, code }),
   });
 
   const data = await response.json();
@@ -65,31 +75,189 @@ export async function signInAction(
     id: data.user.id, // keep as number
     email: data.user.email,
     name: data.user.name,
-    role: data.user.role,
+    roles: data.user.roles ?? [],
     is_active: data.user.is_active,
     created_at: data.user.created_at,
   };
 
-  await createSession(user, rememberMe);
-  redirect("/");
+  await createSession(user, rememberMe, sessionTokens(data));
+  redirect(await takeReturnTo("/"));
+}
+
+// Server action for exchanging a magic link token
+export async function magicLinkAction(token: string) {
+  const response = await fetch(`${API_URL}/api/v1/auth/magic`, {
+    method: "POST",
+    headers: {
+      "Content-Type": "application/json",
+      "X-Client-Type": "nextjs",
+      ...(await forwardedHeaders()),
+    },
+    body: JSON.stringify({ token }),
+  });
+
+  const data = await response.json();
+
+  if (!response.ok) {
+    throw new Error(data.error || "Sign-in link is invalid or has expired");
+  }
+
+  // Create session with user data
+  const user = {
+    id: data.user.id,
+    email: data.user.email,
+    name: data.user.name,
+    roles: data.user.roles ?? [],
+    is_active: data.user.is_active,
+    created_at: data.user.created_at,
+  };
+
+  await createSession(user, false, sessionTokens(data));
+  redirect(await takeReturnTo("/"));
+}
+
+// Server action for checking whether a login was approved from another device
+export async function pollPendingLoginAction(pendingLoginId: string) {
+  const response = await fetch(
+    `${API_URL}/api/v1/auth/pending/${encodeURIComponent(pendingLoginId)}`,
+    {
+      headers: { "X-Client-Type": "nextjs", ...(await forwardedHeaders()) },
+      cache: "no-store",
+    }
+  );
+
+  const data = await response.json();
+
+  if (response.status === 202) {
+    return { status: "pending" as const };
+  }
+  if (!response.ok) {
+    return { status: "failed" as const, error: data.error || "Sign-in request expired" };
+  }
+
+  const user = {
+    id: data.user.id,
+    email: data.user.email,
+    name: data.user.name,
+    roles: data.user.roles ?? [],
+    is_active: data.user.is_active,
+    created_at: data.user.created_at,
+  };
+
+  await createSession(user, false, sessionTokens(data));
+  return { status: "approved" as const, redirectTo: await takeReturnTo("/") };
+}
+
+// Server action for approving or denying a login from the emailed link
+export async function approveLoginAction(token: string, approve: boolean) {
+  const response = await fetch(`${API_URL}/api/v1/auth/approve`, {
+    method: "POST",
+    headers: {
+      "Content-Type": "application/json",
+      "X-Client-Type": "nextjs",
+      ...(await forwardedHeaders()),
+    },
+    body: JSON.stringify({ token, approve }),
+  });
+
+  const data = await response.json();
+
+  if (!response.ok) {
+    throw new Error(data.error || "Failed to update sign-in request");
+  }
+
+  return data;
+}
+
+// Server action for joining an organization from an emailed invite link
+export async function acceptInvitationAction(token: string) {
+  const response = await fetchWithSession("/api/v1/invitations/accept", {
+    method: "POST",
+    body: JSON.stringify({ token }),
+  });
+
+  const data = await response.json();
+
+  if (!response.ok) {
+    throw new Error(data.error || "Failed to accept invitation");
+  }
+
+  return data;
+}
+
+// Server action for approving or denying an OAuth client's authorization request;
+// returns where to send the browser back to the client
+export async function authorizeDecisionAction(requestId: string, approve: boolean): Promise<string> {
+  const response = await fetchWithSession("/api/v1/oauth/authorize/decision", {
+    method: "POST",
+    body: JSON.stringify({ request_id: requestId, approve }),
+  });
+
+  const data = await response.json();
+
+  if (!response.ok) {
+    throw new Error(data.error || "Failed to complete authorization");
+  }
+
+  return data.redirect_to;
+}
+
+// Server action for looking up what a device's user code asks for
+export async function getDeviceAuthorizationAction(userCode: string) {
+  const response = await fetchWithSession(
+    `/api/v1/oauth/device/requests/${encodeURIComponent(userCode)}`,
+    { cache: "no-store" }
+  );
+
+  const data = await response.json();
+
+  if (!response.ok) {
+    throw new Error(data.error || "Code not found or expired");
+  }
+
+  return data as { user_code: string; client_id: string; client_name: string; scope: string; expires_at: string };
+}
+
+// Server action for approving or denying a device that showed the user a code
+export async function deviceDecisionAction(userCode: string, approve: boolean) {
+  const response = await fetchWithSession("/api/v1/oauth/device/decision", {
+    method: "POST",
+    body: JSON.stringify({ user_code: userCode, approve }),
+  });
+
+  const data = await response.json();
+
+  if (!response.ok) {
+    throw new Error(data.error || "Failed to update device request");
+  }
+
+  return data;
 }
 
 // Server action for WebAuthn authentication
-export async function webAuthnLoginAction(userId: number, assertion: Record<string, unknown>) {
+export async function webAuthnLoginAction(ceremonyId: string, assertion: Record<string, unknown>) {
   const response = await fetch(`${API_URL}/api/v1/webauthn/finish-login`, {
     method: "POST",
     headers: {
       "Content-Type": "application/json",
       "X-Client-Type": "nextjs",
+      ...(await forwardedHeaders()),
     },
     body: JSON.stringify({
-      user_id: userId,
+      ceremony_id: ceremonyId,
       assertion
     }),
   });
 
   const data = await response.json();
 
+  // A passkey that may have been copied must be confirmed with an emailed code
+  if (data.errorCode === "step_up_required") {
+    redirect(
+      `/login/verify?email=${encodeURIComponent(data.email)}&nonce=${encodeURIComponent(data.nonce)}&pending=${encodeURIComponent(data.pendingLoginId)}`
+    );
+  }
+
   if (!response.ok) {
     throw new Error(data.error || "WebAuthn authentication failed");
   }
@@ -99,13 +267,13 @@ export async function webAuthnLoginAction(userId: number, assertion: Record<stri
     id: data.user.id,
     email: data.user.email,
     name: data.user.name,
-    role: data.user.role,
+    roles: data.user.roles ?? [],
     is_active: data.user.is_active,
     created_at: data.user.created_at,
   };
 
-  await createSession(user, true); // Always remember for WebAuthn
-  redirect("/dashboard");
+  await createSession(user, true, sessionTokens(data)); // Always remember for WebAuthn
+  redirect(await takeReturnTo("/dashboard"));
 }
 
 export async function signOutAction() {
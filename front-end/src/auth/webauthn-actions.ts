@@ -1,20 +1,13 @@
 "use server";
 import { bufferToBase64Url } from "./webauthn-browser";
+import { fetchWithSession } from "@/lib/auth/api";
+import { updateSessionTokens } from "@/lib/auth/session";
 
-export async function listWebAuthnCredentials(userId: number) {
-  const apiUrl = process.env.API_URL || "http://localhost:8080";
-  const res = await fetch(
-    `${apiUrl}/api/v1/webauthn/list-credentials`,
-    {
-      method: "POST",
-      headers: { 
-        "Content-Type": "application/json",
-        "X-Client-Type": "nextjs"
-      },
-      body: JSON.stringify({ user_id: userId }),
-      credentials: "include",
-    }
-  );
+export async function listWebAuthnCredentials() {
+  const res = await fetchWithSession("/api/v1/webauthn/list-credentials", {
+    method: "POST",
+    body: JSON.stringify({}),
+  });
   if (!res.ok) {
     throw new Error("Failed to fetch credentials");
   }
@@ -22,10 +15,10 @@ export async function listWebAuthnCredentials(userId: number) {
   return data.credentials;
 }
 
+// Returns errorCode insufficient_user_authentication when the user must step up first
 export async function deleteWebAuthnCredential(
-  userId: number,
   credentialId: string | ArrayBuffer
-) {
+): Promise<{ success: boolean; error?: string; errorCode?: string }> {
   // If credentialId is ArrayBuffer, convert to base64url
   let credIdStr: string;
   if (credentialId instanceof ArrayBuffer) {
@@ -33,21 +26,59 @@ export async function deleteWebAuthnCredential(
   } else {
     credIdStr = credentialId;
   }
-  const apiUrl = process.env.API_URL || "http://localhost:8080";
-  const res = await fetch(
-    `${apiUrl}/api/v1/webauthn/delete-credential`,
+  const res = await fetchWithSession("/api/v1/webauthn/delete-credential", {
+    method: "POST",
+    body: JSON.stringify({ credential_id: credIdStr }),
+  });
+  const data = await res.json();
+  if (!res.ok) {
+    // e.g. errorCode last_passkey when the account must keep a passkey
+    return {
+      success: false,
+      error: data.error || "Failed to delete credential",
+      errorCode: data.errorCode,
+    };
+  }
+  return { success: true };
+}
+
+export async function renameWebAuthnCredential(credentialId: string, name: string) {
+  const res = await fetchWithSession(
+    `/api/v1/webauthn/credentials/${encodeURIComponent(credentialId)}`,
     {
-      method: "POST",
-      headers: { 
-        "Content-Type": "application/json",
-        "X-Client-Type": "nextjs"
-      },
-      body: JSON.stringify({ user_id: userId, credential_id: credIdStr }),
-      credentials: "include",
+      method: "PATCH",
+      body: JSON.stringify({ name }),
     }
   );
+  const data = await res.json();
+  if (!res.ok) {
+    throw new Error(data.error || "Failed to rename credential");
+  }
+  return data;
+}
+
+// Starts a passkey assertion that re-authenticates the signed-in user
+export async function beginStepUpAction() {
+  const res = await fetchWithSession("/api/v1/auth/step-up/passkey/begin", {
+    method: "POST",
+    body: JSON.stringify({}),
+  });
+  const data = await res.json();
+  if (!res.ok) {
+    throw new Error(data.error || "Failed to start verification");
+  }
+  return data;
+}
+
+// Finishes the step-up and keeps the fresher tokens in the session
+export async function finishStepUpAction(ceremonyId: string, assertion: Record<string, unknown>) {
+  const res = await fetchWithSession("/api/v1/auth/step-up/passkey/finish", {
+    method: "POST",
+    body: JSON.stringify({ ceremony_id: ceremonyId, assertion }),
+  });
+  const data = await res.json();
   if (!res.ok) {
-    throw new Error("Failed to delete credential");
+    throw new Error(data.error || "Verification failed");
   }
-  return await res.json();
+  await updateSessionTokens({ sessionToken: data.sessionToken, refreshToken: data.refreshToken });
 }
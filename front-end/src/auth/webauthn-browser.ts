@@ -112,3 +112,35 @@ export function bufferToBase64Url(buffer: ArrayBuffer): string {
   }
   return btoa(str).replace(/\+/g, "-").replace(/\//g, "_").replace(/=+$/, "");
 }
+
+export function base64UrlToBuffer(base64url: string): ArrayBuffer {
+  const padding = "=".repeat((4 - (base64url.length % 4)) % 4);
+  const str = atob(base64url.replace(/-/g, "+").replace(/_/g, "/") + padding);
+  const bytes = new Uint8Array(str.length);
+  for (let i = 0; i < str.length; i++) bytes[i] = str.charCodeAt(i);
+  return bytes.buffer;
+}
+
+// Request options as returned by the server, with base64url encoded binary fields
+type RequestOptionsJSON = {
+  challenge: string;
+  allowCredentials?: { id: string; type: string; transports?: string[] }[];
+  [key: string]: unknown;
+};
+
+// Re-authenticates the signed-in user with a passkey before a sensitive action
+export async function stepUpWithPasskey(
+  begin: () => Promise<{ ceremonyId: string; publicKey: RequestOptionsJSON }>,
+  finish: (ceremonyId: string, assertion: Record<string, unknown>) => Promise<unknown>
+): Promise<void> {
+  const { ceremonyId, publicKey } = await begin();
+  const assertion = await getPasskey({
+    ...publicKey,
+    challenge: base64UrlToBuffer(publicKey.challenge),
+    allowCredentials: publicKey.allowCredentials?.map((cred) => ({
+      ...cred,
+      id: base64UrlToBuffer(cred.id),
+    })) as PublicKeyCredentialDescriptor[] | undefined,
+  } as PublicKeyCredentialRequestOptions);
+  await finish(ceremonyId, assertion);
+}
@@ -0,0 +1,128 @@
+"use client";
+import { useEffect, useState } from "react";
+import { Button } from "@/components/ui/button";
+import { Input } from "@/components/ui/input";
+import { Label } from "@/components/ui/label";
+import { Alert, AlertDescription } from "@/components/ui/alert";
+import { deviceDecisionAction, getDeviceAuthorizationAction } from "@/auth";
+import { describeScopes } from "@/lib/oauth/scopes";
+
+type DeviceAuthorization = Awaited<ReturnType<typeof getDeviceAuthorizationAction>>;
+
+interface DeviceAuthorizationFormProps {
+     initialUserCode?: string;
+}
+
+// Looks up the code a device shows and lets the signed-in user approve or deny it
+export function DeviceAuthorizationForm({ initialUserCode }: DeviceAuthorizationFormProps) {
+     const [userCode, setUserCode] = useState(initialUserCode ?? "");
+     const [authorization, setAuthorization] = useState<DeviceAuthorization | null>(null);
+     const [done, setDone] = useState<"approved" | "denied" | null>(null);
+     const [error, setError] = useState("");
+     const [loading, setLoading] = useState(false);
+
+     const lookUp = async (code: string) => {
+          setLoading(true);
+          setError("");
+          try {
+               setAuthorization(await getDeviceAuthorizationAction(code));
+          } catch (e) {
+               setError(e instanceof Error ? e.message : "Code not found or expired");
+          } finally {
+               setLoading(false);
+          }
+     };
+
+     // A code from the verification_uri_complete link is looked up right away
+     useEffect(() => {
+          if (initialUserCode) {
+               lookUp(initialUserCode);
+          }
+          // eslint-disable-next-line react-hooks/exhaustive-deps
+     }, [initialUserCode]);
+
+     const handleDecision = async (approve: boolean) => {
+          if (!authorization) return;
+          setLoading(true);
+          setError("");
+          try {
+               await deviceDecisionAction(authorization.user_code, approve);
+               setDone(approve ? "approved" : "denied");
+          } catch (e) {
+               setError(e instanceof Error ? e.message : "Failed to update device request");
+          } finally {
+               setLoading(false);
+          }
+     };
+
+     if (done) {
+          return (
+               <p className="text-sm text-center">
+                    {done === "approved"
+                         ? "Device approved. You can return to your device and close this page."
+                         : "Device denied. It was not signed in."}
+               </p>
+          );
+     }
+
+     if (authorization) {
+          return (
+               <div className="space-y-4">
+                    <p className="text-sm text-center">
+                         Only continue if <span className="font-mono font-medium">{authorization.user_code}</span> is
+                         the code shown on your device.
+                    </p>
+                    <div className="space-y-1 text-sm">
+                         <p className="font-medium">{authorization.client_name} will be able to:</p>
+                         <ul className="list-disc pl-5">
+                              {describeScopes(authorization.scope).map((description) => (
+                                   <li key={description}>{description}</li>
+                              ))}
+                         </ul>
+                    </div>
+                    {error && (
+                         <Alert variant="destructive">
+                              <AlertDescription>{error}</AlertDescription>
+                         </Alert>
+                    )}
+                    <Button onClick={() => handleDecision(true)} className="w-full" disabled={loading}>
+                         Allow
+                    </Button>
+                    <Button onClick={() => handleDecision(false)} className="w-full" variant="outline" disabled={loading}>
+                         Deny
+                    </Button>
+               </div>
+          );
+     }
+
+     return (
+          <form
+               onSubmit={(e) => {
+                    e.preventDefault();
+                    lookUp(userCode);
+               }}
+               className="space-y-4"
+          >
+               <div className="space-y-2">
+                    <Label htmlFor="user_code">Code</Label>
+                    <Input
+                         id="user_code"
+                         placeholder="XXXX-XXXX"
+                         value={userCode}
+                         onChange={(e) => setUserCode(e.target.value)}
+                         autoComplete="off"
+                         required
+                         disabled={loading}
+                    />
+               </div>
+               <Button type="submit" className="w-full" disabled={loading}>
+                    {loading ? "Checking..." : "Continue"}
+               </Button>
+               {error && (
+                    <Alert variant="destructive">
+                         <AlertDescription>{error}</AlertDescription>
+                    </Alert>
+               )}
+          </form>
+     );
+}
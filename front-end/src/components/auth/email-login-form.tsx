@@ -8,56 +8,17 @@ import { SignInWithPasskeyButton } from "@/components/auth/sign-in-with-passkey-
 
 type LoginState = "email" | "options" | "passkey";
 
-interface UserCheckResponse {
-     user_exists: boolean;
-     has_passkeys: boolean;
-     user_id?: number;
-}
-
 export function EmailLoginForm() {
      const [email, setEmail] = useState("");
      const [state, setState] = useState<LoginState>("email");
-     const [userData, setUserData] = useState<UserCheckResponse | null>(null);
      const [error, setError] = useState<string>("");
-     const [loading, setLoading] = useState(false);
 
-     const handleEmailSubmit = async (e: React.FormEvent) => {
+     // Both options are offered for every email: the server doesn't say who has an
+     // account or passkeys, and a passkey login for an unknown email simply fails
+     const handleEmailSubmit = (e: React.FormEvent) => {
           e.preventDefault();
-          setLoading(true);
           setError("");
-
-          try {
-               const response = await fetch("/api/auth/check-user", {
-                    method: "POST",
-                    headers: {
-                         "Content-Type": "application/json",
-                         "X-Client-Type": "nextjs"
-                    },
-                    body: JSON.stringify({ email }),
-               });
-
-               if (!response.ok) {
-                    console.error("Failed to check user:", response.status, response.statusText);
-                    throw new Error("Failed to check user");
-               }
-
-               const data: UserCheckResponse = await response.json();
-               setUserData(data);
-
-               if (!data.user_exists) {
-                    // User doesn't exist, show sign up option
-                    setError("User not found. Please sign up first.");
-                    return;
-               }
-
-               // Always show options - let user choose their preferred method
-               setState("options");
-          } catch (error) {
-               console.error("Error in handleEmailSubmit:", error);
-               setError("Failed to check user. Please try again.");
-          } finally {
-               setLoading(false);
-          }
+          setState("options");
      };
 
      const handlePasskeyLogin = () => {
@@ -85,7 +46,8 @@ export function EmailLoginForm() {
                     });
 
                     if (sendCodeResponse.ok) {
-                         window.location.href = `/login/verify?email=${encodeURIComponent(email)}`;
+                         const { nonce, pendingLoginId } = await sendCodeResponse.json();
+                         window.location.href = `/login/verify?email=${encodeURIComponent(email)}&nonce=${encodeURIComponent(nonce)}&pending=${encodeURIComponent(pendingLoginId)}`;
                     } else {
                          setError("Failed to send code. Please try again.");
                     }
@@ -99,7 +61,6 @@ export function EmailLoginForm() {
      const handleBack = () => {
           setState("email");
           setError("");
-          setUserData(null);
      };
 
      const handleBackToOptions = () => {
@@ -118,17 +79,18 @@ export function EmailLoginForm() {
                               value={email}
                               onChange={(e) => setEmail(e.target.value)}
                               required
-                              disabled={loading}
                          />
                     </div>
-                    <Button type="submit" className="w-full" disabled={loading}>
-                         {loading ? "Checking..." : "Continue"}
+                    <Button type="submit" className="w-full">
+                         Continue
                     </Button>
                     {error && (
                          <Alert variant="destructive">
                               <AlertDescription>{error}</AlertDescription>
                          </Alert>
                     )}
+                    <div className="text-center text-xs text-gray-500">or</div>
+                    <SignInWithPasskeyButton />
                </form>
           );
      }
@@ -141,32 +103,20 @@ export function EmailLoginForm() {
                               Sign in as <strong>{email}</strong>
                          </p>
                     </div>
-                    {userData?.has_passkeys ? (
-                         <>
-                              <Button
-                                   onClick={handlePasskeyLogin}
-                                   className="w-full"
-                                   variant="default"
-                              >
-                                   🔐 Sign in with Passkey
-                              </Button>
-                              <Button
-                                   onClick={handleCodeLogin}
-                                   className="w-full"
-                                   variant="outline"
-                              >
-                                   📧 Sign in with Code
-                              </Button>
-                         </>
-                    ) : (
-                         <Button
-                              onClick={handleCodeLogin}
-                              className="w-full"
-                              variant="default"
-                         >
-                              📧 Send Verification Code
-                         </Button>
-                    )}
+                    <Button
+                         onClick={handlePasskeyLogin}
+                         className="w-full"
+                         variant="default"
+                    >
+                         🔐 Sign in with Passkey
+                    </Button>
+                    <Button
+                         onClick={handleCodeLogin}
+                         className="w-full"
+                         variant="outline"
+                    >
+                         📧 Sign in with Code
+                    </Button>
                     <Button
                          onClick={handleBack}
                          className="w-full"
@@ -188,7 +138,7 @@ export function EmailLoginForm() {
                               <span className="text-xs text-gray-500">Click the button below to use your passkey</span>
                          </p>
                     </div>
-                    <SignInWithPasskeyButton email={email} userId={userData?.user_id} />
+                    <SignInWithPasskeyButton email={email} />
                     <Button onClick={handleCodeLogin} className="w-full" variant="outline">
                          Try code instead
                     </Button>
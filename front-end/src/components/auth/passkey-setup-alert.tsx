@@ -4,35 +4,24 @@ import { Alert, AlertDescription } from "@/components/ui/alert";
 import { Button } from "@/components/ui/button";
 import { RegisterPasskeyButton } from "@/components/auth/register-passkey-button";
 
-interface PasskeySetupAlertProps {
-     email: string;
-}
-
 interface UserCheckResponse {
-     user_exists: boolean;
      has_passkeys: boolean;
-     user_id?: number;
 }
 
-export function PasskeySetupAlert({ email }: PasskeySetupAlertProps) {
+// Suggests a passkey to the signed-in user
+export function PasskeySetupAlert() {
      const [hasPasskeys, setHasPasskeys] = useState<boolean | null>(null);
-     const [userId, setUserId] = useState<number | null>(null);
      const [loading, setLoading] = useState(true);
      const [showSetup, setShowSetup] = useState(false);
 
      useEffect(() => {
           const checkPasskeys = async () => {
                try {
-                    const response = await fetch("/api/auth/check-user", {
-                         method: "POST",
-                         headers: { "Content-Type": "application/json" },
-                         body: JSON.stringify({ email }),
-                    });
+                    const response = await fetch("/api/auth/check-user", { method: "POST" });
 
                     if (response.ok) {
                          const data: UserCheckResponse = await response.json();
                          setHasPasskeys(data.has_passkeys);
-                         setUserId(data.user_id || null);
                     }
                } catch (error) {
                     console.error("Failed to check passkeys:", error);
@@ -42,7 +31,7 @@ export function PasskeySetupAlert({ email }: PasskeySetupAlertProps) {
           };
 
           checkPasskeys();
-     }, [email]);
+     }, []);
 
      if (loading) {
           return null; // Don't show anything while loading
@@ -64,7 +53,7 @@ export function PasskeySetupAlert({ email }: PasskeySetupAlertProps) {
                                    Passkeys let you sign in with your fingerprint, face, or device PIN instead of typing a code.
                               </p>
                          </div>
-                         {userId && <RegisterPasskeyButton userId={userId} />}
+                         <RegisterPasskeyButton />
                          <Button
                               variant="ghost"
                               size="sm"
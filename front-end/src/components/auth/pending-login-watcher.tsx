@@ -0,0 +1,48 @@
+"use client";
+import { useEffect, useState } from "react";
+import { useRouter } from "next/navigation";
+import { Alert, AlertDescription } from "@/components/ui/alert";
+import { pollPendingLoginAction } from "@/auth";
+
+interface PendingLoginWatcherProps {
+     pendingLoginId: string;
+}
+
+// Signs this browser in when the login is approved from the link in the email, e.g. on a phone
+export function PendingLoginWatcher({ pendingLoginId }: PendingLoginWatcherProps) {
+     const router = useRouter();
+     const [error, setError] = useState("");
+
+     useEffect(() => {
+          let stopped = false;
+
+          const poll = async () => {
+               while (!stopped) {
+                    const result = await pollPendingLoginAction(pendingLoginId);
+                    if (result.status === "approved") {
+                         router.push(result.redirectTo);
+                         return;
+                    }
+                    if (result.status === "failed") {
+                         // The code may still work; only show why approval stopped
+                         setError(result.error);
+                         return;
+                    }
+                    await new Promise((resolve) => setTimeout(resolve, 2000));
+               }
+          };
+          poll();
+
+          return () => {
+               stopped = true;
+          };
+     }, [pendingLoginId, router]);
+
+     return (
+          <Alert className="mb-4">
+               <AlertDescription className="text-sm">
+                    {error || "You can also approve this sign-in from the link in the email on any device."}
+               </AlertDescription>
+          </Alert>
+     );
+}
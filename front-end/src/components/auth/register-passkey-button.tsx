@@ -12,15 +12,16 @@ function base64urlToBuffer(base64url: string): ArrayBuffer {
      return bytes.buffer;
 }
 
-export function RegisterPasskeyButton({ userId }: { userId: number }) {
+export function RegisterPasskeyButton() {
      const [status, setStatus] = useState<string>("");
+     const [name, setName] = useState("");
 
      async function handleRegister() {
           setStatus("Requesting registration options...");
           const response = await fetch("/api/webauthn/begin-registration", {
                method: "POST",
                headers: { "Content-Type": "application/json" },
-               body: JSON.stringify({ user_id: userId }),
+               body: JSON.stringify({}),
           });
           if (!response.ok) {
                setStatus("Failed to get registration options");
@@ -52,10 +53,12 @@ export function RegisterPasskeyButton({ userId }: { userId: number }) {
           const finishResp = await fetch("/api/webauthn/finish-registration", {
                method: "POST",
                headers: { "Content-Type": "application/json" },
-               body: JSON.stringify({ credential, user_id: userId }),
+               body: JSON.stringify({ credential, name: name.trim() || undefined }),
           });
           if (!finishResp.ok) {
-               setStatus("Failed to register passkey");
+               // Policy rejections explain which authenticators are allowed
+               const data = await finishResp.json().catch(() => ({}));
+               setStatus(data.error ? `Failed to register passkey: ${data.error}` : "Failed to register passkey");
                return;
           }
           setStatus("Passkey registered successfully!");
@@ -63,9 +66,18 @@ export function RegisterPasskeyButton({ userId }: { userId: number }) {
 
      return (
           <div className="mt-4">
-               <Button type="button" variant="default" onClick={handleRegister}>
-                    Register Passkey
-               </Button>
+               <div className="flex items-center gap-2">
+                    <input
+                         className="border rounded px-2 py-1 text-sm"
+                         placeholder="Name (optional)"
+                         value={name}
+                         maxLength={64}
+                         onChange={(e) => setName(e.target.value)}
+                    />
+                    <Button type="button" variant="default" onClick={handleRegister}>
+                         Register Passkey
+                    </Button>
+               </div>
                {status && <div className="mt-2 text-sm text-gray-600">{status}</div>}
           </div>
      );
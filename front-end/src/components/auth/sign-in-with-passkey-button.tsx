@@ -24,11 +24,11 @@ function base64UrlToBuffer(base64url: string): ArrayBuffer {
 }
 
 interface SignInWithPasskeyButtonProps {
-     email: string;
-     userId?: number;
+     // Without an email the browser offers every passkey saved for this site
+     email?: string;
 }
 
-export function SignInWithPasskeyButton({ email, userId }: SignInWithPasskeyButtonProps) {
+export function SignInWithPasskeyButton({ email }: SignInWithPasskeyButtonProps) {
      const [status, setStatus] = useState<string>("");
      const [isLoading, setIsLoading] = useState(false);
 
@@ -42,14 +42,14 @@ export function SignInWithPasskeyButton({ email, userId }: SignInWithPasskeyButt
                     "Content-Type": "application/json",
                     "X-Client-Type": "nextjs"
                },
-               body: JSON.stringify({ email }),
+               body: JSON.stringify(email ? { email } : {}),
           });
           if (!response.ok) {
                setStatus("Failed to get login options");
                setIsLoading(false);
                return;
           }
-          const options = await response.json();
+          const { ceremonyId, ...options } = await response.json();
 
           setStatus("Triggering browser passkey dialog...");
           let assertion;
@@ -73,10 +73,7 @@ export function SignInWithPasskeyButton({ email, userId }: SignInWithPasskeyButt
 
           setStatus("Authenticating with server...");
           try {
-               if (!userId) {
-                    throw new Error("User ID is required");
-               }
-               await webAuthnLoginAction(userId, assertion);
+               await webAuthnLoginAction(ceremonyId, assertion);
                setStatus("Signed in with passkey successfully!");
                // The server action will handle the redirect
           } catch (error) {
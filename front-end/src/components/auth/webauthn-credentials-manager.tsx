@@ -1,6 +1,13 @@
 "use client";
 import { useEffect, useState } from "react";
-import { listWebAuthnCredentials, deleteWebAuthnCredential } from "@/auth/webauthn-actions";
+import {
+     listWebAuthnCredentials,
+     deleteWebAuthnCredential,
+     renameWebAuthnCredential,
+     beginStepUpAction,
+     finishStepUpAction,
+} from "@/auth/webauthn-actions";
+import { stepUpWithPasskey } from "@/auth/webauthn-browser";
 
 type WebAuthnCredential = {
      credential_id: string;
@@ -8,58 +15,151 @@ type WebAuthnCredential = {
      public_key?: string;
      counter?: number;
      user_id?: number;
+     aaguid?: string;
+     provider_name?: string;
+     provider_icon_light?: string;
+     transports?: string[];
+     attachment?: string;
+     attestation_type?: string;
+     user_verified?: boolean;
+     backup_eligible?: boolean | null;
+     backup_state?: boolean;
+     created_at?: string;
+     last_used_at?: string;
+     last_used_ip?: string;
+     last_used_user_agent?: string;
 };
 
-export default function WebAuthnCredentialsManager({ userId }: { userId: number }) {
+export default function WebAuthnCredentialsManager() {
      const [credentials, setCredentials] = useState<WebAuthnCredential[]>([]);
      const [loading, setLoading] = useState(true);
      const [error, setError] = useState<string | null>(null);
+     const [actionError, setActionError] = useState<string | null>(null);
      const [deleting, setDeleting] = useState<string | null>(null);
+     const [editing, setEditing] = useState<string | null>(null);
+     const [draftName, setDraftName] = useState("");
 
      useEffect(() => {
           setLoading(true);
-          listWebAuthnCredentials(userId)
+          listWebAuthnCredentials()
                .then(setCredentials)
                .catch((e) => setError(e.message))
                .finally(() => setLoading(false));
-     }, [userId]);
+     }, []);
 
      const handleDelete = async (credentialId: string) => {
           setDeleting(credentialId);
+          setActionError(null);
           try {
-               await deleteWebAuthnCredential(userId, credentialId);
+               let result = await deleteWebAuthnCredential(credentialId);
+               // Deleting a passkey needs a recent sign-in; confirm with a passkey and retry
+               if (result.errorCode === "insufficient_user_authentication") {
+                    await stepUpWithPasskey(beginStepUpAction, finishStepUpAction);
+                    result = await deleteWebAuthnCredential(credentialId);
+               }
+               if (!result.success) {
+                    setActionError(result.error ?? "Failed to delete credential");
+                    return;
+               }
                setCredentials((creds) => creds.filter((c) => c.credential_id !== credentialId));
           } catch (e: unknown) {
+               // Keep the list visible, e.g. when the last passkey can't be deleted
                if (e instanceof Error) {
-                    setError(e.message);
+                    setActionError(e.message);
                } else {
-                    setError("Unknown error");
+                    setActionError("Unknown error");
                }
           } finally {
                setDeleting(null);
           }
      };
 
+     const handleRename = async (credentialId: string) => {
+          setActionError(null);
+          try {
+               await renameWebAuthnCredential(credentialId, draftName);
+               setCredentials((creds) =>
+                    creds.map((c) => (c.credential_id === credentialId ? { ...c, name: draftName.trim() } : c))
+               );
+               setEditing(null);
+          } catch (e: unknown) {
+               setActionError(e instanceof Error ? e.message : "Unknown error");
+          }
+     };
+
      if (loading) return <div>Loading credentials...</div>;
      if (error) return <div className="text-red-500">Error: {error}</div>;
 
      return (
           <div className="space-y-2">
                <h3 className="font-semibold">Passkeys / WebAuthn Credentials</h3>
+               {actionError && <div className="text-sm text-red-500">{actionError}</div>}
                {credentials.length === 0 ? (
                     <div>No passkeys registered.</div>
                ) : (
                     <ul className="space-y-2">
                          {credentials.map((cred) => (
                               <li key={cred.credential_id} className="flex items-center justify-between border rounded p-2">
-                                   <span>{cred.name || "Unnamed Device"} <span className="text-xs text-gray-500">({cred.credential_id.slice(0, 8)}...)</span></span>
-                                   <button
-                                        className="text-red-600 hover:underline disabled:opacity-50"
-                                        onClick={() => handleDelete(cred.credential_id)}
-                                        disabled={deleting === cred.credential_id}
-                                   >
-                                        {deleting === cred.credential_id ? "Deleting..." : "Delete"}
-                                   </button>
+                                   <span className="flex flex-col">
+                                        <span className="flex items-center gap-2">
+                                             {cred.provider_icon_light && (
+                                                  // eslint-disable-next-line @next/next/no-img-element
+                                                  <img src={cred.provider_icon_light} alt={cred.provider_name || ""} className="h-5 w-5" />
+                                             )}
+                                             {editing === cred.credential_id ? (
+                                                  <input
+                                                       className="border rounded px-1 text-sm"
+                                                       value={draftName}
+                                                       maxLength={64}
+                                                       autoFocus
+                                                       onChange={(e) => setDraftName(e.target.value)}
+                                                       onKeyDown={(e) => {
+                                                            if (e.key === "Enter") handleRename(cred.credential_id);
+                                                            if (e.key === "Escape") setEditing(null);
+                                                       }}
+                                                  />
+                                             ) : (
+                                                  cred.name || cred.provider_name || "Unnamed Device"
+                                             )}{" "}
+                                             <span className="text-xs text-gray-500">({cred.credential_id.slice(0, 8)}...)</span>
+                                             {cred.backup_state && <span className="ml-2 text-xs text-gray-500">Synced</span>}
+                                        </span>
+                                        <span className="text-xs text-gray-500">
+                                             {cred.last_used_at
+                                                  ? `Last used ${new Date(cred.last_used_at).toLocaleString()}${cred.last_used_ip ? ` from ${cred.last_used_ip}` : ""}`
+                                                  : "Never used"}
+                                             {cred.created_at && ` · Added ${new Date(cred.created_at).toLocaleDateString()}`}
+                                        </span>
+                                   </span>
+                                   <span className="flex items-center gap-3">
+                                        {editing === cred.credential_id ? (
+                                             <>
+                                                  <button className="hover:underline" onClick={() => handleRename(cred.credential_id)}>
+                                                       Save
+                                                  </button>
+                                                  <button className="text-gray-500 hover:underline" onClick={() => setEditing(null)}>
+                                                       Cancel
+                                                  </button>
+                                             </>
+                                        ) : (
+                                             <button
+                                                  className="hover:underline"
+                                                  onClick={() => {
+                                                       setEditing(cred.credential_id);
+                                                       setDraftName(cred.name || "");
+                                                  }}
+                                             >
+                                                  Rename
+                                             </button>
+                                        )}
+                                        <button
+                                             className="text-red-600 hover:underline disabled:opacity-50"
+                                             onClick={() => handleDelete(cred.credential_id)}
+                                             disabled={deleting === cred.credential_id}
+                                        >
+                                             {deleting === cred.credential_id ? "Deleting..." : "Delete"}
+                                        </button>
+                                   </span>
                               </li>
                          ))}
                     </ul>
@@ -0,0 +1,65 @@
+import { headers } from "next/headers";
+import { getSession, updateSessionTokens } from "@/lib/auth/session";
+
+const API_URL = process.env.API_URL || "http://localhost:8080";
+
+// Passes on who the browser is, so the backend's per-IP limits and login approvals see the
+// user instead of this server. The X-Forwarded-For chain is forwarded as received: the backend
+// reads it right to left and only trusts entries added by its TRUSTED_PROXIES.
+export async function forwardedHeaders(): Promise<Record<string, string>> {
+  const incoming = await headers();
+  const forwarded: Record<string, string> = {};
+  const forwardedFor = incoming.get("x-forwarded-for");
+  if (forwardedFor) {
+    forwarded["X-Forwarded-For"] = forwardedFor;
+  }
+  const userAgent = incoming.get("user-agent");
+  if (userAgent) {
+    forwarded["User-Agent"] = userAgent;
+  }
+  return forwarded;
+}
+
+// Calls an authenticated backend route with the session's access token,
+// refreshing the token once if it has expired
+export async function fetchWithSession(path: string, init: RequestInit = {}): Promise<Response> {
+  const session = await getSession();
+  if (!session?.tokens) {
+    return Response.json({ error: "Authentication required" }, { status: 401 });
+  }
+
+  const forwarded = await forwardedHeaders();
+  const send = (sessionToken: string) =>
+    fetch(`${API_URL}${path}`, {
+      ...init,
+      headers: {
+        "Content-Type": "application/json",
+        "X-Client-Type": "nextjs",
+        ...forwarded,
+        ...init.headers,
+        Authorization: `Bearer ${sessionToken}`,
+      },
+    });
+
+  const response = await send(session.tokens.sessionToken);
+  if (response.status !== 401) {
+    return response;
+  }
+
+  const refresh = await fetch(`${API_URL}/api/v1/auth/refresh`, {
+    method: "POST",
+    headers: {
+      "Content-Type": "application/json",
+      "X-Client-Type": "nextjs",
+      ...forwarded,
+    },
+    body: JSON.stringify({ refresh_token: session.tokens.refreshToken }),
+  });
+  if (!refresh.ok) {
+    return response;
+  }
+
+  const data = await refresh.json();
+  await updateSessionTokens({ sessionToken: data.sessionToken, refreshToken: data.refreshToken });
+  return send(data.sessionToken);
+}
@@ -0,0 +1,18 @@
+// Page to open after signing in, set when sign-in interrupts another flow (e.g. OAuth consent)
+export const RETURN_TO_COOKIE = "return_to";
+
+// Only same-site paths may be returned to, never another origin
+export function isLocalPath(path: string | null | undefined): path is string {
+  return !!path && path.startsWith("/") && !path.startsWith("//") && !path.startsWith("/\\");
+}
+
+// Where the login page should return to: the consent page for an OAuth authorization
+// request, otherwise a local return_to path
+export function loginReturnTo(searchParams: URLSearchParams): string | null {
+  const authorizationRequest = searchParams.get("authorization_request");
+  if (authorizationRequest) {
+    return `/oauth/consent?authorization_request=${encodeURIComponent(authorizationRequest)}`;
+  }
+  const returnTo = searchParams.get("return_to");
+  return isLocalPath(returnTo) ? returnTo : null;
+}
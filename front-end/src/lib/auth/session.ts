@@ -1,17 +1,25 @@
 import jwt from "jsonwebtoken";
 import { cookies } from "next/headers";
+import { RETURN_TO_COOKIE, isLocalPath } from "./return-to";
 
 export interface User {
   id: string;
   email: string;
   name?: string;
-  role: string;
+  roles: string[];
   is_active: boolean;
   created_at: string;
 }
 
+// Backend tokens used to call authenticated API routes on the user's behalf
+export interface SessionTokens {
+  sessionToken: string;
+  refreshToken: string;
+}
+
 export interface SessionData {
   user: User;
+  tokens?: SessionTokens;
   exp: number;
   iat: number;
 }
@@ -19,10 +27,15 @@ export interface SessionData {
 const JWT_SECRET =
   process.env.JWT_SECRET || "your-secret-key-change-in-production";
 
-export async function createSession(user: User, rememberMe: boolean = false): Promise<void> {
+export async function createSession(
+  user: User,
+  rememberMe: boolean = false,
+  tokens?: SessionTokens
+): Promise<void> {
   const expirationTime = rememberMe ? 30 * 24 * 60 * 60 : 24 * 60 * 60; // 30 days or 24 hours
   const payload = {
     user,
+    tokens,
     exp: Math.floor(Date.now() / 1000) + expirationTime,
     iat: Math.floor(Date.now() / 1000),
   };
@@ -55,6 +68,12 @@ export async function getSession(): Promise<SessionData | null> {
       return null;
     }
 
+    // Sessions created before users could have several roles only carry `role`
+    const legacy = decoded.user as User & { role?: string };
+    if (!decoded.user.roles) {
+      decoded.user.roles = legacy.role ? [legacy.role] : [];
+    }
+
     return decoded;
   } catch {
     // Don't call destroySession here - just return null  
@@ -62,6 +81,34 @@ export async function getSession(): Promise<SessionData | null> {
   }
 }
 
+// Replaces the backend tokens after a refresh, keeping the session's expiry
+export async function updateSessionTokens(tokens: SessionTokens): Promise<void> {
+  const session = await getSession();
+  if (!session) return;
+
+  const token = jwt.sign({ ...session, tokens }, JWT_SECRET);
+
+  const cookieStore = await cookies();
+  cookieStore.set("session", token, {
+    httpOnly: true,
+    secure: process.env.NODE_ENV === "production",
+    sameSite: "lax",
+    maxAge: session.exp - Math.floor(Date.now() / 1000),
+    path: "/",
+  });
+}
+
+// Returns the page saved by the login page to go back to after signing in, or fallback.
+// The saved page is used once.
+export async function takeReturnTo(fallback: string): Promise<string> {
+  const cookieStore = await cookies();
+  const returnTo = cookieStore.get(RETURN_TO_COOKIE)?.value;
+  if (!returnTo) return fallback;
+
+  cookieStore.delete(RETURN_TO_COOKIE);
+  return isLocalPath(returnTo) ? returnTo : fallback;
+}
+
 export async function destroySession(): Promise<void> {
   "use server";
   const cookieStore = await cookies();
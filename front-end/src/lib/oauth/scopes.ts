@@ -0,0 +1,14 @@
+// What each OAuth scope lets a client see, shown when the user is asked to approve it
+const scopeDescriptions: Record<string, string> = {
+  openid: "Confirm who you are",
+  profile: "See your name",
+  email: "See your email address",
+  roles: "See your roles",
+};
+
+export function describeScopes(scope: string): string[] {
+  return scope
+    .split(" ")
+    .filter(Boolean)
+    .map((name) => scopeDescriptions[name] ?? name);
+}
@@ -1,11 +1,25 @@
 import { NextResponse } from "next/server";
 import type { NextRequest } from "next/server";
+import { RETURN_TO_COOKIE, loginReturnTo } from "@/lib/auth/return-to";
 
-// eslint-disable-next-line @typescript-eslint/no-unused-vars
-export function middleware(_request: NextRequest) {
-  // For now, just let all requests through
-  // In the future, you could add route protection here
-  return NextResponse.next();
+export function middleware(request: NextRequest) {
+  const response = NextResponse.next();
+
+  // Remember where to go after signing in, whichever sign-in method is used
+  if (request.nextUrl.pathname === "/login") {
+    const returnTo = loginReturnTo(request.nextUrl.searchParams);
+    if (returnTo) {
+      response.cookies.set(RETURN_TO_COOKIE, returnTo, {
+        httpOnly: true,
+        secure: process.env.NODE_ENV === "production",
+        sameSite: "lax",
+        maxAge: 15 * 60,
+        path: "/",
+      });
+    }
+  }
+
+  return response;
 }
 
 export const config = {